@@ -0,0 +1,726 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Fel från API:et tillsammans med den HTTP-status som ska skickas
+type apiError struct {
+	status int
+	err    error
+}
+
+func (e *apiError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(err error) error {
+	return &apiError{status: http.StatusBadRequest, err: err}
+}
+
+func notFound(err error) error {
+	return &apiError{status: http.StatusNotFound, err: err}
+}
+
+func conflict(err error) error {
+	return &apiError{status: http.StatusConflict, err: err}
+}
+
+// Skriv ett fel med den status felet anger, övriga fel räknas som serverfel
+func writeAPIError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var ae *apiError
+	if errors.As(err, &ae) {
+		status = ae.status
+	}
+	writeJSONError(w, status, err)
+}
+
+// Fil med nyckeln som krävs för att ändra något via API:et
+func apiTokenFilename() string {
+	return dataPath("api_token.txt")
+}
+
+// Läs evenemangets API-nyckel, en ny skapas första gången
+func loadAPIToken() (string, error) {
+	data, err := os.ReadFile(apiTokenFilename())
+	if err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("kunde inte läsa API-nyckel: %v", err)
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("kunde inte skapa API-nyckel: %v", err)
+	}
+	token := hex.EncodeToString(b)
+	if err := writeFileAtomic(apiTokenFilename(), []byte(token+"\n")); err != nil {
+		return "", fmt.Errorf("kunde inte spara API-nyckel: %v", err)
+	}
+	if err := os.Chmod(apiTokenFilename(), 0600); err != nil {
+		getLogger().Log("Kunde inte begränsa behörigheten för API-nyckeln: %v", err)
+	}
+	getLogger().Log("Skapade ny API-nyckel i %s", apiTokenFilename())
+	return token, nil
+}
+
+// Släpp bara igenom anrop med rätt API-nyckel i Authorization: Bearer
+func (s *timingServer) requireToken(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || s.token == "" || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="tidtagning"`)
+			writeJSONError(w, http.StatusUnauthorized, fmt.Errorf("ogiltig eller saknad API-nyckel"))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// Läs JSON från anropet, okända fält räknas som fel så att felstavningar märks
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return badRequest(fmt.Errorf("ogiltig JSON: %v", err))
+	}
+	return nil
+}
+
+// Läs in loppen från disk, låt change ändra dem och spara, under samma lås som gränssnittet
+func (s *timingServer) writeRaces(change func(races []Race) ([]Race, error)) error {
+	return updateRaces(change)
+}
+
+// Ändra ett lopp och spara det
+func (s *timingServer) changeRace(raceID string, change func(race *Race) error) (Race, error) {
+	var changed Race
+	err := s.writeRaces(func(races []Race) ([]Race, error) {
+		for i := range races {
+			if races[i].ID != raceID {
+				continue
+			}
+			if err := change(&races[i]); err != nil {
+				return nil, err
+			}
+			changed = races[i]
+			return races, nil
+		}
+		return nil, notFound(fmt.Errorf("hittade inget lopp med ID %s", raceID))
+	})
+	if err != nil {
+		return Race{}, err
+	}
+	s.afterWrite(raceID)
+	return changed, nil
+}
+
+// Läs om loppen efter en ändring och berätta för gränssnittet att något ändrats
+func (s *timingServer) afterWrite(raceID string) {
+	if err := s.reload(); err != nil {
+		getLogger().Log("Kunde inte läsa in loppen efter ändring: %v", err)
+	}
+	if s.onChange != nil {
+		s.onChange(raceID)
+	}
+}
+
+// Fel om gränssnittet har loppet öppet och skulle skriva över ändringen
+func (s *timingServer) checkRaceOpen(race Race) error {
+	if s.editGuard == nil {
+		return nil
+	}
+	return s.editGuard(race)
+}
+
+// Inställningar och deltagare kan bara ändras när resultaten inte är låsta
+// och inget resultatfönster har loppet öppet
+func (s *timingServer) checkRaceSettingsEditable(race Race) error {
+	if !raceResultsEditable(race) {
+		return conflict(raceLockedError(race))
+	}
+	if err := s.checkRaceOpen(race); err != nil {
+		return conflict(err)
+	}
+	return nil
+}
+
+// Inställningar för ett lopp som skickas till API:et, fält som saknas lämnas orörda
+type RaceInput struct {
+	Name          *string                 `json:"name"`
+	StartTime     *string                 `json:"startTime"`
+	MinTime       *string                 `json:"minTime"`
+	SilenceAlarm  *string                 `json:"silenceAlarm"`
+	ResultsFile   *string                 `json:"resultsFile"`
+	StartChip     *string                 `json:"startChip"`
+	SpreadsheetId *string                 `json:"spreadsheetId"`
+	SheetName     *string                 `json:"sheetName"`
+	Participants  map[string]*Participant `json:"participants"`
+}
+
+// Starttid från API:et, antingen "2006-01-02 15:04:05" som i gränssnittet eller RFC3339.
+// Läsarfilens tider saknar tidszon, så starttiden sparas som samma väggklocka i UTC. Från
+// RFC3339 används klockslaget i den angivna tidszonen, så en starttid som hämtats från
+// API:et kan skickas tillbaka oförändrad.
+func parseAPIStartTime(text string) (time.Time, error) {
+	text = strings.TrimSpace(text)
+	if startTime, err := time.Parse(time.RFC3339Nano, text); err == nil {
+		return startTimeFromClock(startTime), nil
+	}
+	if date, clock, ok := strings.Cut(text, " "); ok {
+		if startTime, err := parseStartTime(date, clock, time.UTC); err == nil {
+			return startTime, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("ogiltig starttid %q, ange t.ex. 2026-05-17 10:00:00", text)
+}
+
+// För över de angivna inställningarna till loppet. Anges deltagare ersätter de loppets startnummer.
+func (input RaceInput) apply(race *Race) error {
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" {
+			return badRequest(fmt.Errorf("loppet måste ha ett namn"))
+		}
+		race.Name = name
+	}
+	if input.StartTime != nil {
+		startTime, err := parseAPIStartTime(*input.StartTime)
+		if err != nil {
+			return badRequest(err)
+		}
+		race.StartTime = startTime
+	}
+	if input.MinTime != nil {
+		minTime, err := parseOptionalDuration(*input.MinTime)
+		if err != nil || minTime < 0 {
+			return badRequest(fmt.Errorf("ogiltig minsta tid %q, ange t.ex. 10m", *input.MinTime))
+		}
+		race.MinTime = minTime
+	}
+	if input.SilenceAlarm != nil {
+		silenceAlarm, err := parseOptionalDuration(*input.SilenceAlarm)
+		if err != nil || silenceAlarm < 0 {
+			return badRequest(fmt.Errorf("ogiltig gräns för tyst läsare %q, ange t.ex. 5m", *input.SilenceAlarm))
+		}
+		race.SilenceAlarm = silenceAlarm
+	}
+	if input.ResultsFile != nil {
+		race.ResultsFile = strings.TrimSpace(*input.ResultsFile)
+	}
+	if input.StartChip != nil {
+		race.StartChip = strings.TrimSpace(*input.StartChip)
+	}
+	if input.SpreadsheetId != nil {
+		race.SpreadsheetId = *input.SpreadsheetId
+	}
+	if input.SheetName != nil {
+		race.SheetName = *input.SheetName
+	}
+
+	if input.Participants != nil {
+		chips := make(map[string]bool)
+		participants := make(map[string]Participant)
+		for chip, participant := range input.Participants {
+			chip = strings.TrimSpace(chip)
+			if chip == "" {
+				return badRequest(fmt.Errorf("startnummer får inte vara tomt"))
+			}
+			chips[chip] = true
+			if participant != nil && (participant.Name != "" || participant.Class != "") {
+				participants[chip] = *participant
+			}
+		}
+		race.Chips = chips
+		race.Participants = participants
+
+		// DNS gäller bara startnummer som fortfarande finns kvar i loppet
+		for chip := range race.DNS {
+			if !chips[chip] {
+				delete(race.DNS, chip)
+			}
+		}
+	}
+
+	if race.StartChip != "" && race.Chips[race.StartChip] {
+		return badRequest(fmt.Errorf("startchipet %s kan inte också vara ett startnummer i loppet", race.StartChip))
+	}
+	return nil
+}
+
+// En deltagare i API:et
+type ParticipantInfo struct {
+	Chip  string `json:"chip"`
+	Name  string `json:"name"`
+	Class string `json:"class,omitempty"`
+	DNS   bool   `json:"dns"`
+}
+
+// Ny eller ändrad deltagare
+type ParticipantInput struct {
+	Name  string `json:"name"`
+	Class string `json:"class"`
+	DNS   bool   `json:"dns"`
+}
+
+// Ny manuell tid, tiden anges som i gränssnittet: löptid, dag N HH:MM:SS eller datum och klockslag.
+// ID kan anges av klienten så att en tid som skickas igen efter ett avbrott bara sparas en gång.
+type ManualTimeInput struct {
+	ID   string `json:"id"`
+	Chip string `json:"chip"`
+	Time string `json:"time"`
+	User string `json:"user"`
+}
+
+// Klientens ID för en manuell tid får bara innehålla bokstäver, siffror, - och _
+func validClientID(id string) bool {
+	if len(id) == 0 || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// Markera en läsning som felaktig eller giltig. Tiden är läsningens tidpunkt,
+// antingen som i results?all=true eller i samma format som en manuell tid.
+type ReadMarkInput struct {
+	Chip    string `json:"chip"`
+	Time    string `json:"time"`
+	Invalid bool   `json:"invalid"`
+	User    string `json:"user"`
+}
+
+// Statusbyte för ett lopp
+type RaceStatusInput struct {
+	Status string `json:"status"`
+}
+
+// Användaren som sparas i journalen för ändringar via API:et
+func apiUser(user string) string {
+	if user = strings.TrimSpace(user); user != "" {
+		return user
+	}
+	return "api"
+}
+
+func (s *timingServer) handleRaceSettings(w http.ResponseWriter, r *http.Request) {
+	race, ok := s.raceFromRequest(w, r)
+	if !ok {
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, race)
+}
+
+func (s *timingServer) handleCreateRace(w http.ResponseWriter, r *http.Request) {
+	var input RaceInput
+	if err := decodeJSONBody(w, r, &input); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if input.Name == nil {
+		writeAPIError(w, badRequest(fmt.Errorf("loppet måste ha ett namn")))
+		return
+	}
+	if input.StartTime == nil {
+		writeAPIError(w, badRequest(fmt.Errorf("loppet måste ha en starttid")))
+		return
+	}
+
+	race := Race{
+		ID:           newID(),
+		Status:       RaceStatusPlanned,
+		Chips:        make(map[string]bool),
+		Participants: make(map[string]Participant),
+		InvalidTimes: make(map[string]bool),
+	}
+	if err := input.apply(&race); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	if err := s.writeRaces(func(races []Race) ([]Race, error) {
+		return append(races, race), nil
+	}); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	getLogger().Log("API: la till lopp %s", race.Name)
+	s.afterWrite(race.ID)
+	writeJSONResponse(w, http.StatusCreated, race)
+}
+
+func (s *timingServer) handleUpdateRace(w http.ResponseWriter, r *http.Request) {
+	var input RaceInput
+	if err := decodeJSONBody(w, r, &input); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	race, err := s.changeRace(r.PathValue("id"), func(race *Race) error {
+		if err := s.checkRaceSettingsEditable(*race); err != nil {
+			return err
+		}
+		edited := *race
+		if err := input.apply(&edited); err != nil {
+			return err
+		}
+		if exportedResultsChanged(edited) {
+			getLogger().Log("API: ändringen av %s ger andra resultat än de som exporterades %s",
+				edited.Name, edited.ExportedAt.Format("2006-01-02 15:04"))
+		}
+		*race = edited
+		os.Remove(resultsCacheFilename(race.ID))
+		return nil
+	})
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	getLogger().Log("API: ändrade lopp %s", race.Name)
+	writeJSONResponse(w, http.StatusOK, race)
+}
+
+func (s *timingServer) handleDeleteRace(w http.ResponseWriter, r *http.Request) {
+	raceID := r.PathValue("id")
+	var deleted Race
+	err := s.writeRaces(func(races []Race) ([]Race, error) {
+		for i, race := range races {
+			if race.ID != raceID {
+				continue
+			}
+			if err := s.checkRaceSettingsEditable(race); err != nil {
+				return nil, err
+			}
+			deleted = race
+			return append(races[:i], races[i+1:]...), nil
+		}
+		return nil, notFound(fmt.Errorf("hittade inget lopp med ID %s", raceID))
+	})
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	s.state.RemoveStopWatcher(raceID)
+	os.Remove(resultsCacheFilename(raceID))
+	getLogger().Log("API: tog bort lopp %s", deleted.Name)
+	s.afterWrite(raceID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *timingServer) handleRaceStatus(w http.ResponseWriter, r *http.Request) {
+	var input RaceStatusInput
+	if err := decodeJSONBody(w, r, &input); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	race, err := s.changeRace(r.PathValue("id"), func(race *Race) error {
+		from := raceStatus(*race)
+		if err := s.checkRaceOpen(*race); err != nil {
+			return conflict(err)
+		}
+		if !canTransitionRace(*race, input.Status) {
+			return conflict(fmt.Errorf("%s kan inte gå från %s till %s",
+				race.Name, raceStatusLabel(from), raceStatusLabel(input.Status)))
+		}
+		race.Status = input.Status
+
+		// Läsarfilen övervakas bara medan loppet pågår
+		race.LiveUpdate = input.Status == RaceStatusStarted && race.ResultsFile != ""
+		getLogger().Log("API: lopp %s bytte status från %s till %s", race.Name, from, input.Status)
+		return nil
+	})
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, race)
+}
+
+func (s *timingServer) handleParticipants(w http.ResponseWriter, r *http.Request) {
+	race, ok := s.raceFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	chips := make([]string, 0, len(race.Chips))
+	for chip := range race.Chips {
+		chips = append(chips, chip)
+	}
+	sortChipsNumerically(chips)
+
+	participants := []ParticipantInfo{}
+	for _, chip := range chips {
+		participants = append(participants, ParticipantInfo{
+			Chip:  chip,
+			Name:  participantName(race, chip),
+			Class: participantClass(race, chip),
+			DNS:   race.DNS[chip],
+		})
+	}
+	writeJSONResponse(w, http.StatusOK, participants)
+}
+
+func (s *timingServer) handlePutParticipant(w http.ResponseWriter, r *http.Request) {
+	var input ParticipantInput
+	if err := decodeJSONBody(w, r, &input); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	chip := strings.TrimSpace(r.PathValue("chip"))
+
+	_, err := s.changeRace(r.PathValue("id"), func(race *Race) error {
+		if err := s.checkRaceSettingsEditable(*race); err != nil {
+			return err
+		}
+		if chip == race.StartChip {
+			return badRequest(fmt.Errorf("startchipet %s kan inte också vara ett startnummer i loppet", chip))
+		}
+
+		if race.Chips == nil {
+			race.Chips = make(map[string]bool)
+		}
+		race.Chips[chip] = true
+
+		if race.Participants == nil {
+			race.Participants = make(map[string]Participant)
+		}
+		if input.Name != "" || input.Class != "" {
+			race.Participants[chip] = Participant{Name: strings.TrimSpace(input.Name), Class: strings.TrimSpace(input.Class)}
+		} else {
+			delete(race.Participants, chip)
+		}
+
+		if input.DNS {
+			if race.DNS == nil {
+				race.DNS = make(map[string]bool)
+			}
+			race.DNS[chip] = true
+		} else {
+			delete(race.DNS, chip)
+		}
+		os.Remove(resultsCacheFilename(race.ID))
+		return nil
+	})
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	race, _ := s.getRace(r.PathValue("id"))
+	writeJSONResponse(w, http.StatusOK, ParticipantInfo{
+		Chip:  chip,
+		Name:  participantName(race, chip),
+		Class: participantClass(race, chip),
+		DNS:   race.DNS[chip],
+	})
+}
+
+func (s *timingServer) handleDeleteParticipant(w http.ResponseWriter, r *http.Request) {
+	chip := r.PathValue("chip")
+	_, err := s.changeRace(r.PathValue("id"), func(race *Race) error {
+		if err := s.checkRaceSettingsEditable(*race); err != nil {
+			return err
+		}
+		if !race.Chips[chip] {
+			return notFound(fmt.Errorf("startnummer %s finns inte i loppet", chip))
+		}
+		delete(race.Chips, chip)
+		delete(race.Participants, chip)
+		delete(race.DNS, chip)
+		os.Remove(resultsCacheFilename(race.ID))
+		return nil
+	})
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *timingServer) handleManualTimes(w http.ResponseWriter, r *http.Request) {
+	race, ok := s.raceFromRequest(w, r)
+	if !ok {
+		return
+	}
+	manualTimes, err := loadManualTimes(race.ID)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if manualTimes == nil {
+		manualTimes = []ManualTime{}
+	}
+	writeJSONResponse(w, http.StatusOK, manualTimes)
+}
+
+func (s *timingServer) handleAddManualTime(w http.ResponseWriter, r *http.Request) {
+	var input ManualTimeInput
+	if err := decodeJSONBody(w, r, &input); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	if input.ID != "" && !validClientID(input.ID) {
+		writeAPIError(w, badRequest(fmt.Errorf("ogiltigt ID %q", input.ID)))
+		return
+	}
+
+	var added ManualTime
+	duplicate := false
+	_, err := s.changeRace(r.PathValue("id"), func(race *Race) error {
+		// Tiden har redan sparats, klienten fick troligen inget svar förra gången
+		if input.ID != "" {
+			manualTimes, err := loadManualTimes(race.ID)
+			if err != nil {
+				return err
+			}
+			for _, mt := range manualTimes {
+				if mt.ID == input.ID {
+					added = mt
+					duplicate = true
+					return nil
+				}
+			}
+		}
+
+		// Ett öppet resultatfönster skulle skriva över felmarkeringarna
+		if err := s.checkRaceOpen(*race); err != nil {
+			return conflict(err)
+		}
+		chip, recordTime, err := validateManualTime(*race, input.Chip, input.Time)
+		if err != nil {
+			return badRequest(err)
+		}
+		newEntry := newManualTimeEntry(*race, chip, recordTime, apiUser(input.User))
+		if input.ID != "" {
+			newEntry.Manual.ID = input.ID
+		}
+		entry, err := recordJournalEntry(race, newEntry)
+		if err != nil {
+			if !raceResultsEditable(*race) {
+				return conflict(err)
+			}
+			return err
+		}
+		added = *entry.Manual
+		return nil
+	})
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if duplicate {
+		writeJSONResponse(w, http.StatusOK, added)
+		return
+	}
+	writeJSONResponse(w, http.StatusCreated, added)
+}
+
+func (s *timingServer) handleDeleteManualTime(w http.ResponseWriter, r *http.Request) {
+	manualID := r.PathValue("mid")
+	_, err := s.changeRace(r.PathValue("id"), func(race *Race) error {
+		if err := s.checkRaceOpen(*race); err != nil {
+			return conflict(err)
+		}
+		manualTimes, err := loadManualTimes(race.ID)
+		if err != nil {
+			return err
+		}
+		for _, mt := range manualTimes {
+			if mt.ID != manualID {
+				continue
+			}
+			deleted := mt
+			if _, err := recordJournalEntry(race, JournalEntry{
+				User:   apiUser(r.URL.Query().Get("user")),
+				Type:   journalManualDelete,
+				Chip:   mt.Chip,
+				Manual: &deleted,
+			}); err != nil {
+				if !raceResultsEditable(*race) {
+					return conflict(err)
+				}
+				return err
+			}
+			return nil
+		}
+		return notFound(fmt.Errorf("hittade ingen manuell tid med ID %s", manualID))
+	})
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *timingServer) handleMarkRead(w http.ResponseWriter, r *http.Request) {
+	var input ReadMarkInput
+	if err := decodeJSONBody(w, r, &input); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	var result ChipResult
+	_, err := s.changeRace(r.PathValue("id"), func(race *Race) error {
+		chip := strings.TrimSpace(input.Chip)
+		readTime, err := time.Parse(time.RFC3339Nano, input.Time)
+		if err != nil {
+			if readTime, err = parseManualTime(*race, input.Time); err != nil {
+				return badRequest(err)
+			}
+		}
+
+		read, err := findChipRead(*race, chip, readTime)
+		if err != nil {
+			return notFound(err)
+		}
+		result = read
+		if read.Invalid == input.Invalid {
+			return nil
+		}
+		if err := s.checkRaceOpen(*race); err != nil {
+			return conflict(err)
+		}
+
+		entryType := journalValidate
+		if input.Invalid {
+			entryType = journalInvalidate
+		}
+		if _, err := recordJournalEntry(race, JournalEntry{
+			User:     apiUser(input.User),
+			Type:     entryType,
+			Chip:     chip,
+			ReadTime: &read.Time,
+		}); err != nil {
+			if !raceResultsEditable(*race) {
+				return conflict(err)
+			}
+			return err
+		}
+		result.Invalid = input.Invalid
+		return nil
+	})
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, result)
+}
@@ -7,13 +7,12 @@ import (
 	"sync"
 )
 
-type AppState struct {
-	mu             sync.RWMutex
-	stopWatchers   map[string]func()
-	activeSearches map[string]string
-	resultWindows  map[string]*ResultWindow
-	raceFileSrc    string
-	logger         *Logger
+// Filövervakningar och läsarstatus för loppen, utan koppling till något gränssnitt.
+// Används av både gränssnittet och serverläget.
+type WatchState struct {
+	mu           sync.RWMutex
+	stopWatchers map[string]func()
+	readerHealth map[string]ReaderHealth
 }
 
 var (
@@ -21,80 +20,92 @@ var (
 	once      sync.Once
 )
 
-func NewAppState() *AppState {
-	return &AppState{
-		stopWatchers:   make(map[string]func()),
-		activeSearches: make(map[string]string),
-		resultWindows:  make(map[string]*ResultWindow),
-		logger:         getLogger(),
+func NewWatchState() *WatchState {
+	return &WatchState{
+		stopWatchers: make(map[string]func()),
+		readerHealth: make(map[string]ReaderHealth),
 	}
 }
 
-func (s *AppState) AddStopWatcher(raceName string, stopFunc func()) {
+func (s *WatchState) AddStopWatcher(raceID string, stopFunc func()) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.stopWatchers[raceName] = stopFunc
+	s.stopWatchers[raceID] = stopFunc
 }
 
-func (s *AppState) RemoveStopWatcher(raceName string) {
+// Stoppa loppets filövervakning, returnerar om det fanns någon. Övervakningen stoppas
+// utan låset, eftersom den väntar på att en pågående uppdatering av läsarstatus blir klar.
+func (s *WatchState) RemoveStopWatcher(raceID string) bool {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	if stopFunc, exists := s.stopWatchers[raceName]; exists {
+	stopFunc, exists := s.stopWatchers[raceID]
+	delete(s.stopWatchers, raceID)
+	s.mu.Unlock()
+
+	if exists {
 		stopFunc()
-		delete(s.stopWatchers, raceName)
 	}
+	return exists
 }
 
-// Metoder för att hantera activeSearches
-func (s *AppState) SetActiveSearch(windowID, searchText string) {
+func (s *WatchState) HasStopWatcher(raceID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, exists := s.stopWatchers[raceID]
+	return exists
+}
+
+// Metoder för att hantera läsarstatus
+func (s *WatchState) SetReaderHealth(raceID string, health ReaderHealth) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.activeSearches[windowID] = searchText
+	s.readerHealth[raceID] = health
 }
 
-func (s *AppState) GetActiveSearch(windowID string) string {
+func (s *WatchState) GetReaderHealth(raceID string) (ReaderHealth, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.activeSearches[windowID]
+	health, exists := s.readerHealth[raceID]
+	return health, exists
 }
 
-// Metoder för att hantera resultWindows
-func (s *AppState) AddResultWindow(windowID string, rw *ResultWindow) {
+func (s *WatchState) RemoveReaderHealth(raceID string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.resultWindows[windowID] = rw
+	delete(s.readerHealth, raceID)
 }
 
-func (s *AppState) RemoveResultWindow(windowID string) {
+// Stoppa alla filövervakningar och glöm läsarstatus
+func (s *WatchState) StopAll() {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	delete(s.resultWindows, windowID)
-}
+	stopFuncs := s.stopWatchers
+	s.stopWatchers = make(map[string]func())
+	s.mu.Unlock()
 
-func (s *AppState) GetResultWindow(windowID string) (*ResultWindow, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	rw, exists := s.resultWindows[windowID]
-	return rw, exists
+	for _, stopFunc := range stopFuncs {
+		stopFunc()
+	}
+
+	s.mu.Lock()
+	s.readerHealth = make(map[string]ReaderHealth)
+	s.mu.Unlock()
 }
 
 func initializeEmptyDataIfNeeded() error {
 	// Grundläggande datastruktur för appen
-	initialData := struct {
-		Races []Race `json:"races"`
-	}{
-		Races: []Race{},
+	initialData := racesFile{
+		SchemaVersion: currentSchemaVersion,
+		Races:         []Race{},
 	}
 
 	// Kontrollera om filen finns
-	if _, err := os.Stat("races.json"); os.IsNotExist(err) {
+	if _, err := os.Stat(racesFilename()); os.IsNotExist(err) {
 		// Filen finns inte, skapa en ny med tom datastruktur
 		jsonData, err := json.MarshalIndent(initialData, "", "    ")
 		if err != nil {
 			return fmt.Errorf("kunde inte marshalla initial data: %v", err)
 		}
 
-		err = os.WriteFile("races.json", jsonData, 0644)
+		err = writeFileAtomic(racesFilename(), jsonData)
 		if err != nil {
 			return fmt.Errorf("kunde inte skriva initial data till fil: %v", err)
 		}
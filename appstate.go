@@ -0,0 +1,109 @@
+//go:build !headless
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2/widget"
+)
+
+// Gränssnittets tillstånd: filövervakningar och läsarstatus samt öppna resultatfönster och sökningar
+type AppState struct {
+	*WatchState
+	mu             sync.RWMutex
+	activeSearches map[string]string
+	resultWindows  map[string]*ResultWindow
+	healthLabels   map[string]*widget.Label
+	logger         *Logger
+}
+
+func NewAppState() *AppState {
+	return &AppState{
+		WatchState:     NewWatchState(),
+		activeSearches: make(map[string]string),
+		resultWindows:  make(map[string]*ResultWindow),
+		healthLabels:   make(map[string]*widget.Label),
+		logger:         getLogger(),
+	}
+}
+
+// Metoder för att hantera activeSearches
+func (s *AppState) SetActiveSearch(windowID, searchText string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activeSearches[windowID] = searchText
+}
+
+func (s *AppState) GetActiveSearch(windowID string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.activeSearches[windowID]
+}
+
+// Metoder för att hantera resultWindows
+func (s *AppState) AddResultWindow(windowID string, rw *ResultWindow) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resultWindows[windowID] = rw
+}
+
+func (s *AppState) RemoveResultWindow(windowID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.resultWindows, windowID)
+}
+
+func (s *AppState) GetResultWindow(windowID string) (*ResultWindow, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rw, exists := s.resultWindows[windowID]
+	return rw, exists
+}
+
+// Etiketten med läsarstatus för loppet i huvudfönstret
+func (s *AppState) SetHealthLabel(raceID string, label *widget.Label) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.healthLabels[raceID] = label
+}
+
+// Uppdatera etiketterna med läsarstatus utan att bygga om listan över lopp
+func (s *AppState) RefreshReaderHealth(races []Race) {
+	now := time.Now()
+	for _, race := range races {
+		s.mu.RLock()
+		label, exists := s.healthLabels[race.ID]
+		s.mu.RUnlock()
+		if !exists {
+			continue
+		}
+
+		health, exists := s.GetReaderHealth(race.ID)
+		if !exists || !isRaceRunning(race, now) {
+			label.Hide()
+			continue
+		}
+		label.SetText(formatReaderHealth(health))
+		label.Show()
+	}
+}
+
+// Stoppa alla filövervakningar och stäng alla resultatfönster, används när evenemanget byts
+func (s *AppState) CloseAll() {
+	s.StopAll()
+
+	s.mu.Lock()
+	var windows []*ResultWindow
+	for _, rw := range s.resultWindows {
+		windows = append(windows, rw)
+	}
+	s.activeSearches = make(map[string]string)
+	s.mu.Unlock()
+
+	// Fönstren tar bort sig själva från resultWindows när de stängs
+	for _, rw := range windows {
+		rw.window.Close()
+	}
+}
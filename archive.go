@@ -0,0 +1,452 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jimmitjoo/hogby-tidtagning/internal/services/sheets"
+	"github.com/jimmitjoo/hogby-tidtagning/internal/timeformat"
+)
+
+// Version av arkivformatet, höjs om innehållet ändras på ett sätt som äldre versioner inte klarar
+const archiveFormatVersion = 1
+
+const archiveManifestName = "manifest.json"
+
+type ArchiveFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type ArchiveRace struct {
+	ID                  string `json:"id"`
+	Name                string `json:"name"`
+	ReaderFile          string `json:"readerFile,omitempty"`
+	OriginalResultsFile string `json:"originalResultsFile,omitempty"`
+	ResultsCSV          string `json:"resultsCsv"`
+}
+
+type ArchiveManifest struct {
+	FormatVersion int           `json:"formatVersion"`
+	SchemaVersion int           `json:"schemaVersion"`
+	EventName     string        `json:"eventName"`
+	ExportedAt    time.Time     `json:"exportedAt"`
+	Races         []ArchiveRace `json:"races"`
+	Files         []ArchiveFile `json:"files"`
+}
+
+// Välj slutresultatet ur redan beräknade resultat
+func selectFinishResults(race Race, results []ChipResult) []ChipResult {
+	var finished []ChipResult
+	for _, result := range results {
+		if !result.Invalid && !race.DNS[result.Chip] {
+			finished = append(finished, result)
+		}
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].Duration < finished[j].Duration
+	})
+	return finished
+}
+
+// Loppets slutresultat med placering och namn
+func buildResultRows(race Race) []ResultRow {
+	return resultRowsFrom(race, readAllResults(race))
+}
+
+// Slutresultat med placering och namn ur redan beräknade resultat
+func resultRowsFrom(race Race, results []ChipResult) []ResultRow {
+	rows := []ResultRow{}
+	classPlaces := make(map[string]int)
+	for i, result := range selectFinishResults(race, results) {
+		row := ResultRow{
+			Place:    i + 1,
+			Chip:     result.Chip,
+			Name:     participantName(race, result.Chip),
+			Class:    participantClass(race, result.Chip),
+			Time:     timeformat.Duration(result.Duration),
+			Duration: result.Duration.Milliseconds(),
+			Manual:   result.Manual,
+		}
+		if row.Class != "" {
+			classPlaces[row.Class]++
+			row.ClassPlace = classPlaces[row.Class]
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Skriv loppets slutresultat som CSV med placering, startnummer, namn och tid
+func writeResultsCSV(w io.Writer, race Race) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"Placering", "Startnr", "Namn", "Tid", "Manuell"}); err != nil {
+		return err
+	}
+
+	for _, row := range buildResultRows(race) {
+		manual := ""
+		if row.Manual {
+			manual = "ja"
+		}
+		if err := writer.Write([]string{
+			fmt.Sprintf("%d", row.Place),
+			row.Chip,
+			row.Name,
+			row.Time,
+			manual,
+		}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// Packa hela evenemanget i ett zip-arkiv: lopp, deltagare, manuella tider,
+// felmarkeringar med journal, läsarfiler och slutresultat
+func exportEventArchive(w io.Writer, races []Race) error {
+	zipWriter := zip.NewWriter(w)
+	manifest := ArchiveManifest{
+		FormatVersion: archiveFormatVersion,
+		SchemaVersion: currentSchemaVersion,
+		EventName:     workspaceName(),
+		ExportedAt:    time.Now(),
+	}
+
+	// Lägg till en fil i arkivet och i manifestet, modified sparas om den är satt
+	addFile := func(name string, data []byte, modified time.Time) error {
+		fileWriter, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: modified,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := fileWriter.Write(data); err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		manifest.Files = append(manifest.Files, ArchiveFile{
+			Path:   name,
+			Size:   int64(len(data)),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+		return nil
+	}
+
+	// Lägg till en fil från disk om den finns, returnerar om filen kom med. Ändringstiden
+	// följer med eftersom läsarfiler med bara klockslag placeras ut på dygnet utifrån den.
+	addExistingFile := func(name, filename string) (bool, error) {
+		info, err := os.Stat(filename)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return false, err
+		}
+		return true, addFile(name, data, info.ModTime())
+	}
+
+	racesData, err := json.MarshalIndent(racesFile{
+		SchemaVersion: currentSchemaVersion,
+		Races:         races,
+	}, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := addFile("races.json", racesData, time.Time{}); err != nil {
+		return err
+	}
+
+	// Flera lopp kan dela samma läsarfil, den packas bara en gång
+	readerFiles := make(map[string]string)
+
+	for _, race := range races {
+		archiveRace := ArchiveRace{
+			ID:                  race.ID,
+			Name:                race.Name,
+			OriginalResultsFile: race.ResultsFile,
+		}
+
+		if _, err := addExistingFile(filepath.Base(manualTimesFilename(race.ID)), manualTimesFilename(race.ID)); err != nil {
+			return fmt.Errorf("kunde inte packa manuella tider för %s: %v", race.Name, err)
+		}
+		if _, err := addExistingFile(filepath.Base(journalFilename(race.ID)), journalFilename(race.ID)); err != nil {
+			return fmt.Errorf("kunde inte packa journal för %s: %v", race.Name, err)
+		}
+		if _, err := addExistingFile(filepath.Base(finishStampsFilename(race.ID)), finishStampsFilename(race.ID)); err != nil {
+			return fmt.Errorf("kunde inte packa måltider för %s: %v", race.Name, err)
+		}
+
+		if race.ResultsFile != "" {
+			name, exists := readerFiles[race.ResultsFile]
+			if !exists {
+				name = fmt.Sprintf("readers/%s_%s", race.ID, filepath.Base(race.ResultsFile))
+				added, err := addExistingFile(name, race.ResultsFile)
+				if err != nil {
+					return fmt.Errorf("kunde inte packa läsarfil för %s: %v", race.Name, err)
+				}
+				if !added {
+					getLogger().Log("Läsarfilen %s för %s finns inte och packas inte med", race.ResultsFile, race.Name)
+					name = ""
+				}
+				readerFiles[race.ResultsFile] = name
+			}
+			archiveRace.ReaderFile = name
+		}
+
+		var results strings.Builder
+		if err := writeResultsCSV(&results, race); err != nil {
+			return fmt.Errorf("kunde inte skapa resultat för %s: %v", race.Name, err)
+		}
+		archiveRace.ResultsCSV = fmt.Sprintf("results/%s.csv", race.ID)
+		if err := addFile(archiveRace.ResultsCSV, []byte(results.String()), time.Time{}); err != nil {
+			return err
+		}
+
+		manifest.Races = append(manifest.Races, archiveRace)
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+	manifestWriter, err := zipWriter.Create(archiveManifestName)
+	if err != nil {
+		return err
+	}
+	if _, err := manifestWriter.Write(manifestData); err != nil {
+		return err
+	}
+
+	getLogger().Log("Exporterade evenemang %s med %d lopp och %d filer", manifest.EventName, len(races), len(manifest.Files))
+	return zipWriter.Close()
+}
+
+// Läs manifestet i ett evenemangsarkiv
+func readArchiveManifest(zipReader *zip.Reader) (ArchiveManifest, error) {
+	var manifest ArchiveManifest
+
+	manifestFile, err := zipReader.Open(archiveManifestName)
+	if err != nil {
+		return manifest, fmt.Errorf("arkivet saknar manifest: %v", err)
+	}
+	defer manifestFile.Close()
+
+	if err := json.NewDecoder(manifestFile).Decode(&manifest); err != nil {
+		return manifest, fmt.Errorf("kunde inte läsa manifest: %v", err)
+	}
+	if manifest.FormatVersion > archiveFormatVersion {
+		return manifest, fmt.Errorf("arkivet har version %d men programmet stödjer bara till version %d",
+			manifest.FormatVersion, archiveFormatVersion)
+	}
+	return manifest, nil
+}
+
+// Packa upp ett evenemangsarkiv i destDir och peka om loppens läsarfiler till de uppackade kopiorna
+func importEventArchive(archiveFile string, destDir string) (ArchiveManifest, error) {
+	zipReader, err := zip.OpenReader(archiveFile)
+	if err != nil {
+		return ArchiveManifest{}, fmt.Errorf("kunde inte öppna arkiv: %v", err)
+	}
+	defer zipReader.Close()
+
+	manifest, err := readArchiveManifest(&zipReader.Reader)
+	if err != nil {
+		return manifest, err
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return manifest, err
+	}
+
+	for _, archived := range manifest.Files {
+		if err := extractArchiveFile(&zipReader.Reader, archived, destDir); err != nil {
+			return manifest, err
+		}
+	}
+
+	// Läs in loppen och skriv om sökvägarna till läsarfilerna
+	racesData, err := os.ReadFile(filepath.Join(destDir, "races.json"))
+	if err != nil {
+		return manifest, fmt.Errorf("arkivet saknar races.json: %v", err)
+	}
+	races, _, err := parseRacesData(racesData)
+	if err != nil {
+		return manifest, err
+	}
+
+	readerFiles := make(map[string]string)
+	for _, archiveRace := range manifest.Races {
+		if archiveRace.ReaderFile != "" {
+			readerFiles[archiveRace.ID] = filepath.Join(destDir, filepath.FromSlash(archiveRace.ReaderFile))
+		}
+	}
+	// Lopp vars läsarfil inte fanns vid exporten behåller sin ursprungliga sökväg
+	for i := range races {
+		if readerFile, exists := readerFiles[races[i].ID]; exists {
+			races[i].ResultsFile = readerFile
+		}
+		races[i].LiveUpdate = false
+	}
+
+	if err := writeJSONAtomic(filepath.Join(destDir, "races.json"), racesFile{
+		SchemaVersion: currentSchemaVersion,
+		Races:         races,
+	}); err != nil {
+		return manifest, err
+	}
+
+	getLogger().Log("Importerade evenemang %s till %s", manifest.EventName, destDir)
+	return manifest, nil
+}
+
+// Packa upp en fil ur arkivet och kontrollera att innehållet stämmer med manifestet
+func extractArchiveFile(zipReader *zip.Reader, archived ArchiveFile, destDir string) error {
+	// Tillåt inga sökvägar som pekar utanför evenemangsmappen. Bakåtsnedstreck och kolon
+	// avvisas eftersom de är avgränsare på Windows.
+	cleaned := path.Clean(archived.Path)
+	if strings.ContainsAny(archived.Path, `\:`) || !filepath.IsLocal(filepath.FromSlash(cleaned)) {
+		return fmt.Errorf("ogiltig sökväg i arkivet: %s", archived.Path)
+	}
+
+	src, err := zipReader.Open(cleaned)
+	if err != nil {
+		return fmt.Errorf("arkivet saknar %s: %v", archived.Path, err)
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != archived.SHA256 {
+		return fmt.Errorf("filen %s i arkivet är skadad", archived.Path)
+	}
+
+	target := filepath.Join(destDir, filepath.FromSlash(cleaned))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(target, data); err != nil {
+		return err
+	}
+
+	// Återställ ändringstiden från arkivet, läsarfiler placeras ut på dygnet utifrån den
+	for _, f := range zipReader.File {
+		if f.Name == cleaned && !f.Modified.IsZero() {
+			return os.Chtimes(target, f.Modified, f.Modified)
+		}
+	}
+	return nil
+}
+
+// Läs evenemangets namn ur ett arkiv utan att packa upp det
+func archiveEventName(archiveFile string) (string, error) {
+	zipReader, err := zip.OpenReader(archiveFile)
+	if err != nil {
+		return "", fmt.Errorf("kunde inte öppna arkiv: %v", err)
+	}
+	defer zipReader.Close()
+
+	manifest, err := readArchiveManifest(&zipReader.Reader)
+	if err != nil {
+		return "", err
+	}
+	return manifest.EventName, nil
+}
+
+// Hitta en ledig mapp för ett importerat evenemang
+func importDestination(eventName string) (string, error) {
+	root, err := defaultWorkspaceRoot()
+	if err != nil {
+		return "", err
+	}
+
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:`, r) {
+			return '_'
+		}
+		return r
+	}, eventName)
+	if name == "" || name == "." || name == ".." {
+		name = "Importerat evenemang"
+	}
+
+	dest := filepath.Join(root, name)
+	for i := 2; ; i++ {
+		if _, err := os.Stat(dest); os.IsNotExist(err) {
+			return dest, nil
+		}
+		dest = filepath.Join(root, fmt.Sprintf("%s (%d)", name, i))
+	}
+}
+
+// Första giltiga tiden för varje startnummer i formatet som Sheets-exporten använder
+func sheetsResultsForRace(race Race) []sheets.Result {
+	// Konvertera resultat till sheets.Result
+	results := readAllResults(race)
+
+	// Skapa en map för att hålla alla tider för varje startnummer
+	chipTimes := make(map[string][]sheets.Result)
+
+	// Samla alla tider per startnummer
+	for _, r := range results {
+		chipTimes[r.Chip] = append(chipTimes[r.Chip], sheets.Result{
+			Chip:     r.Chip,
+			Time:     r.Time,
+			Duration: r.Duration,
+			Invalid:  r.Invalid,
+			Manual:   r.Manual,
+		})
+	}
+
+	// Välj den första giltiga tiden för varje startnummer
+	var sheetsResults []sheets.Result
+	for _, times := range chipTimes {
+		// Sortera tider för detta startnummer efter tidpunkt
+		sort.Slice(times, func(i, j int) bool {
+			return times[i].Time.Before(times[j].Time)
+		})
+
+		// Hitta första giltiga tiden
+		for _, time := range times {
+			if !time.Invalid {
+				sheetsResults = append(sheetsResults, time)
+				break
+			}
+		}
+	}
+
+	// Sortera resultaten efter startnummer
+	sort.Slice(sheetsResults, func(i, j int) bool {
+		ni, _ := strconv.Atoi(sheetsResults[i].Chip)
+		nj, _ := strconv.Atoi(sheetsResults[j].Chip)
+		return ni < nj
+	})
+
+	return sheetsResults
+}
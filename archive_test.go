@@ -0,0 +1,119 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEventArchiveRoundTrip(t *testing.T) {
+	dir := useTestWorkspace(t)
+
+	readerFile := filepath.Join(dir, "lasare.txt")
+	if err := os.WriteFile(readerFile, []byte("1\t2026-05-17 10:40:00.000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	readerModTime := time.Date(2026, 5, 17, 11, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(readerFile, readerModTime, readerModTime); err != nil {
+		t.Fatal(err)
+	}
+	missingReader := filepath.Join(dir, "saknas.txt")
+	milen := testRace("")
+	milen.ResultsFile = readerFile
+	milen.LiveUpdate = true
+	femman := testRace("")
+	femman.ID, femman.Name, femman.ResultsFile = "lopp2", "Femman", missingReader
+	races := []Race{milen, femman}
+	if err := saveRaces(races); err != nil {
+		t.Fatal(err)
+	}
+
+	archiveFile := filepath.Join(t.TempDir(), "evenemang.zip")
+	file, err := os.Create(archiveFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exportEventArchive(file, races); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	// Exporten läser bara, resultatcachen skrivs inte
+	for _, race := range races {
+		if _, err := os.Stat(resultsCacheFilename(race.ID)); !os.IsNotExist(err) {
+			t.Errorf("exporten skrev resultatcachen för %s", race.Name)
+		}
+	}
+
+	dest := filepath.Join(t.TempDir(), "importerat")
+	if _, err := importEventArchive(archiveFile, dest); err != nil {
+		t.Fatal(err)
+	}
+	if err := useWorkspace(dest); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := loadRaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 2 {
+		t.Fatalf("väntade 2 lopp, fick %d", len(imported))
+	}
+
+	if !filepath.IsAbs(imported[0].ResultsFile) || filepath.Dir(filepath.Dir(imported[0].ResultsFile)) != dest {
+		t.Errorf("läsarfilen pekar inte på den uppackade kopian: %s", imported[0].ResultsFile)
+	}
+	if data, err := os.ReadFile(imported[0].ResultsFile); err != nil || len(data) == 0 {
+		t.Errorf("den uppackade läsarfilen går inte att läsa: %v", err)
+	}
+	if modTime, err := getFileModTime(imported[0].ResultsFile); err != nil || !modTime.Equal(readerModTime) {
+		t.Errorf("läsarfilens ändringstid följde inte med: %s, väntade %s", modTime, readerModTime)
+	}
+	if imported[0].LiveUpdate {
+		t.Errorf("importerat lopp övervakas")
+	}
+	if imported[1].ResultsFile != missingReader {
+		t.Errorf("saknad läsarfil fick sökvägen %q, väntade %q", imported[1].ResultsFile, missingReader)
+	}
+}
+
+func TestExtractArchiveFileRejectsPathsOutsideEvent(t *testing.T) {
+	names := []string{"../x", `..\..\x`, "/etc/x", "C:x", "readers/../../x", `readers\a.txt`, "readers/a.txt"}
+
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	for _, name := range names {
+		fileWriter, err := zipWriter.CreateHeader(&zip.FileHeader{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fileWriter.Write([]byte("data"))
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zipReader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte("data"))
+	destDir := t.TempDir()
+	for _, name := range names {
+		err := extractArchiveFile(zipReader, ArchiveFile{Path: name, SHA256: hex.EncodeToString(sum[:])}, destDir)
+		if name == "readers/a.txt" {
+			if err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s packades upp", name)
+		}
+	}
+}
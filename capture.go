@@ -0,0 +1,319 @@
+//go:build !headless
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/jimmitjoo/hogby-tidtagning/internal/timeformat"
+)
+
+// En måltid som registrerats med en knapptryckning och som får sitt startnummer efteråt.
+// ManualTimeID sätts när tiden sparats som manuell tid.
+type FinishStamp struct {
+	ID           string    `json:"id"`
+	Time         time.Time `json:"time"`
+	Chip         string    `json:"chip"`
+	ManualTimeID string    `json:"manualTimeId,omitempty"`
+}
+
+// Läs loppets registrerade måltider
+func loadFinishStamps(raceID string) ([]FinishStamp, error) {
+	data, err := os.ReadFile(finishStampsFilename(raceID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var stamps []FinishStamp
+	if err := json.Unmarshal(data, &stamps); err != nil {
+		return nil, &corruptFileError{filename: finishStampsFilename(raceID), err: err}
+	}
+	return stamps, nil
+}
+
+// Spara loppets registrerade måltider
+func saveFinishStamps(raceID string, stamps []FinishStamp) error {
+	return writeJSONAtomic(finishStampsFilename(raceID), stamps)
+}
+
+// Ge startnummer i målordning till de måltider som ännu saknar startnummer.
+// Returnerar hur många startnummer som användes.
+func assignBibOrder(stamps []FinishStamp, bibs []string) int {
+	used := 0
+	for i := range stamps {
+		if used == len(bibs) {
+			break
+		}
+		if stamps[i].Chip != "" || stamps[i].ManualTimeID != "" {
+			continue
+		}
+		stamps[i].Chip = bibs[used]
+		used++
+	}
+	return used
+}
+
+// Spara måltider med startnummer som manuella tider. Måltidens ID används som den
+// manuella tidens ID så att samma måltid aldrig sparas två gånger. Returnerar antalet
+// sparade tider och ett fel per måltid som inte kunde sparas.
+func commitFinishStamps(race *Race, stamps []FinishStamp) (int, []string) {
+	committed := 0
+	var problems []string
+
+	// Ett startnummer kan bara ha en måltid
+	firstStamp := make(map[string]int)
+	for i, stamp := range stamps {
+		if stamp.Chip == "" {
+			continue
+		}
+		if _, exists := firstStamp[stamp.Chip]; !exists {
+			firstStamp[stamp.Chip] = i
+		}
+	}
+
+	for i := range stamps {
+		stamp := &stamps[i]
+		if stamp.Chip == "" || stamp.ManualTimeID != "" {
+			continue
+		}
+
+		var err error
+		switch {
+		case !race.Chips[stamp.Chip]:
+			err = fmt.Errorf("Startnummer %s finns inte registrerat i loppet", stamp.Chip)
+		case firstStamp[stamp.Chip] != i:
+			err = fmt.Errorf("Startnummer %s har redan måltid #%d", stamp.Chip, firstStamp[stamp.Chip]+1)
+		default:
+			err = checkManualTimeLimit(*race, stamp.Time)
+		}
+		if err == nil {
+			entry := newManualTimeEntry(*race, stamp.Chip, stamp.Time, "")
+			entry.Manual.ID = stamp.ID
+			_, err = recordJournalEntry(race, entry)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("#%d %s: %v", i+1, timeformat.Duration(stamp.Time.Sub(race.StartTime)), err))
+			continue
+		}
+
+		stamp.ManualTimeID = stamp.ID
+		committed++
+	}
+
+	return committed, problems
+}
+
+// Registrera måltider med mellanslag eller knappen och ge dem startnummer efteråt,
+// ett i taget eller från en lista i målordning från fållan
+func showFinishCapture(race *Race, races []Race, index int, app fyne.App, onChange func()) {
+	window := app.NewWindow(fmt.Sprintf("Målfångst - %s", race.Name))
+
+	stamps, err := loadFinishStamps(race.ID)
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("kunde inte läsa måltider: %v", err), window)
+	}
+
+	persist := func() {
+		if err := saveFinishStamps(race.ID, stamps); err != nil {
+			dialog.ShowError(fmt.Errorf("kunde inte spara måltider: %v", err), window)
+		}
+	}
+
+	statusLabel := widget.NewLabel("")
+	list := container.NewVBox()
+	scroll := container.NewVScroll(list)
+	var chipEntries []*widget.Entry
+
+	updateStatus := func() {
+		waiting, assigned, saved := 0, 0, 0
+		for _, stamp := range stamps {
+			switch {
+			case stamp.ManualTimeID != "":
+				saved++
+			case stamp.Chip != "":
+				assigned++
+			default:
+				waiting++
+			}
+		}
+		statusLabel.SetText(fmt.Sprintf("%d utan startnummer, %d klara att spara, %d sparade", waiting, assigned, saved))
+	}
+
+	// Flytta markören till nästa måltid som saknar startnummer
+	focusNextWaiting := func(from int) {
+		for i := from; i < len(stamps); i++ {
+			if stamps[i].Chip == "" && stamps[i].ManualTimeID == "" {
+				window.Canvas().Focus(chipEntries[i])
+				return
+			}
+		}
+		window.Canvas().Unfocus()
+	}
+
+	var refresh func()
+	refresh = func() {
+		list.RemoveAll()
+		chipEntries = make([]*widget.Entry, len(stamps))
+
+		for i := range stamps {
+			i := i
+			stamp := stamps[i]
+
+			nameLabel := widget.NewLabel(participantName(*race, stamp.Chip))
+			chipEntry := widget.NewEntry()
+			chipEntry.SetPlaceHolder("Startnummer")
+			chipEntry.SetText(stamp.Chip)
+			chipEntry.OnChanged = func(text string) {
+				stamps[i].Chip = strings.TrimSpace(text)
+				switch {
+				case stamps[i].Chip == "":
+					nameLabel.SetText("")
+				case !race.Chips[stamps[i].Chip]:
+					nameLabel.SetText("Okänt startnummer")
+				default:
+					nameLabel.SetText(participantName(*race, stamps[i].Chip))
+				}
+				persist()
+				updateStatus()
+			}
+			chipEntry.OnSubmitted = func(string) {
+				focusNextWaiting(i + 1)
+			}
+			chipEntries[i] = chipEntry
+
+			deleteButton := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+				dialog.ShowConfirm("Ta bort måltid",
+					fmt.Sprintf("Vill du ta bort måltid #%d %s?", i+1, timeformat.Duration(stamp.Time.Sub(race.StartTime))),
+					func(ok bool) {
+						if !ok {
+							return
+						}
+						stamps = append(stamps[:i], stamps[i+1:]...)
+						persist()
+						refresh()
+					}, window)
+			})
+			deleteButton.Importance = widget.DangerImportance
+
+			if stamp.ManualTimeID != "" {
+				chipEntry.Disable()
+				deleteButton.Disable()
+				nameLabel.SetText(participantName(*race, stamp.Chip) + " (sparad)")
+			}
+
+			row := container.NewBorder(nil, nil,
+				container.NewHBox(
+					widget.NewLabel(fmt.Sprintf("#%d", i+1)),
+					widget.NewLabel(timeformat.Duration(stamp.Time.Sub(race.StartTime))),
+					container.NewGridWrap(fyne.NewSize(140, chipEntry.MinSize().Height), chipEntry),
+				),
+				deleteButton,
+				nameLabel)
+			list.Add(row)
+		}
+		list.Refresh()
+		updateStatus()
+	}
+
+	// Knappen är avstängd för låsta lopp, men mellanslag kommer hit ändå
+	capture := func() {
+		if !raceResultsEditable(*race) {
+			return
+		}
+		stamps = append(stamps, FinishStamp{
+			ID:   newID(),
+			Time: startTimeFromClock(time.Now()),
+		})
+		persist()
+		refresh()
+		scroll.ScrollToBottom()
+	}
+
+	captureButton := widget.NewButtonWithIcon("Mål (mellanslag)", theme.MediaRecordIcon(), capture)
+	captureButton.Importance = widget.HighImportance
+
+	// Mellanslag registrerar en måltid när inget startnummerfält är markerat
+	window.Canvas().SetOnTypedKey(func(event *fyne.KeyEvent) {
+		if event.Name == fyne.KeySpace {
+			capture()
+		}
+	})
+
+	importButton := widget.NewButton("Importera målordning...", func() {
+		bibsEntry := widget.NewMultiLineEntry()
+		bibsEntry.SetPlaceHolder("Startnummer i målordning, ett per rad eller åtskilda med mellanslag")
+
+		d := dialog.NewForm("Importera målordning", "Tilldela", "Avbryt", []*widget.FormItem{
+			{Text: "Startnummer", Widget: bibsEntry},
+		}, func(submitted bool) {
+			if !submitted {
+				return
+			}
+			bibs := strings.Fields(bibsEntry.Text)
+			used := assignBibOrder(stamps, bibs)
+			persist()
+			refresh()
+
+			message := fmt.Sprintf("Tilldelade %d startnummer till måltider i ordning", used)
+			if used < len(bibs) {
+				message += fmt.Sprintf("\n%d startnummer blev över, det finns inte fler måltider utan startnummer", len(bibs)-used)
+			}
+			dialog.ShowInformation("Importera målordning", message, window)
+		}, window)
+		d.Resize(fyne.NewSize(400, 500))
+		d.Show()
+	})
+
+	commitButton := widget.NewButtonWithIcon("Spara som resultat", theme.DocumentSaveIcon(), func() {
+		committed, problems := commitFinishStamps(race, stamps)
+		persist()
+		if committed > 0 {
+			races[index] = *race
+			if err := saveRace(*race); err != nil {
+				dialog.ShowError(err, window)
+			}
+			onChange()
+		}
+		refresh()
+
+		message := fmt.Sprintf("Sparade %d måltider som manuella tider", committed)
+		if len(problems) > 0 {
+			message += "\n\nKunde inte spara:\n" + strings.Join(problems, "\n")
+		}
+		dialog.ShowInformation("Spara som resultat", message, window)
+	})
+	commitButton.Importance = widget.SuccessImportance
+
+	if !raceResultsEditable(*race) {
+		captureButton.Disable()
+		importButton.Disable()
+		commitButton.Disable()
+	}
+
+	refresh()
+
+	window.SetContent(container.NewPadded(container.NewBorder(
+		container.NewVBox(
+			widget.NewLabel("Tryck mellanslag eller Mål när en löpare passerar mållinjen. Skriv startnumret och tryck Enter för att gå till nästa."),
+			captureButton,
+			statusLabel,
+		),
+		container.NewHBox(importButton, commitButton),
+		nil, nil,
+		scroll,
+	)))
+	window.Resize(fyne.NewSize(700, 700))
+	window.Show()
+}
@@ -0,0 +1,249 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Visa chipkontroll där löparna testar sina chip på en testmatta innan start.
+// Läsningarna hålls bara i minnet och sparas aldrig i något lopp.
+func showChipCheck(races []Race, app fyne.App) {
+	checkWindow := app.NewWindow("Chipkontroll")
+
+	// Alla registrerade startnummer och vilka lopp de tillhör
+	registered := make(map[string][]string)
+	names := make(map[string]string)
+	for _, race := range races {
+		for chip := range race.Chips {
+			registered[chip] = append(registered[chip], race.Name)
+			if name := participantName(race, chip); name != "" {
+				names[chip] = name
+			}
+		}
+	}
+
+	// Läsningarna kommer från filens egen tråd, så listorna läses och ändras under mu
+	var mu sync.Mutex
+	tested := make(map[string]int)
+	var readLog []string
+	var untested []string
+
+	// Stora texter som syns på avstånd
+	bibText := canvas.NewText("-", theme.ForegroundColor())
+	bibText.TextSize = 96
+	bibText.TextStyle = fyne.TextStyle{Bold: true}
+	bibText.Alignment = fyne.TextAlignCenter
+
+	nameText := canvas.NewText("", theme.ForegroundColor())
+	nameText.TextSize = 40
+	nameText.Alignment = fyne.TextAlignCenter
+
+	statusText := canvas.NewText("Välj läsarfil för att starta", theme.ForegroundColor())
+	statusText.TextSize = 32
+	statusText.TextStyle = fyne.TextStyle{Bold: true}
+	statusText.Alignment = fyne.TextAlignCenter
+
+	background := canvas.NewRectangle(theme.BackgroundColor())
+
+	untestedLabel := widget.NewLabel("")
+	untestedList := widget.NewList(
+		func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(untested)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			mu.Lock()
+			if id >= len(untested) {
+				mu.Unlock()
+				return
+			}
+			chip := untested[id]
+			mu.Unlock()
+			text := chip
+			if name := names[chip]; name != "" {
+				text = fmt.Sprintf("%s %s", chip, name)
+			}
+			obj.(*widget.Label).SetText(text)
+		})
+
+	logList := widget.NewList(
+		func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(readLog)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			mu.Lock()
+			if id >= len(readLog) {
+				mu.Unlock()
+				return
+			}
+			text := readLog[id]
+			mu.Unlock()
+			obj.(*widget.Label).SetText(text)
+		})
+
+	// Räkna om listan med startnummer som ännu inte testats, anropas med mu låst
+	computeUntested := func() int {
+		untested = nil
+		for chip := range registered {
+			if tested[chip] == 0 {
+				untested = append(untested, chip)
+			}
+		}
+		sortChipsNumerically(untested)
+		return len(untested)
+	}
+
+	// Uppdatera listan med startnummer som ännu inte testats
+	updateUntested := func() {
+		mu.Lock()
+		count := computeUntested()
+		mu.Unlock()
+
+		untestedLabel.SetText(fmt.Sprintf("Ej testade: %d av %d", count, len(registered)))
+		untestedList.Refresh()
+	}
+	updateUntested()
+
+	handleRead := func(chip string, readTime time.Time) {
+		mu.Lock()
+		tested[chip]++
+		count := tested[chip]
+
+		var status string
+		var fill color.Color
+		switch {
+		case len(registered[chip]) == 0:
+			status = "OKÄNT STARTNUMMER"
+			fill = color.NRGBA{R: 255, G: 80, B: 80, A: 255}
+		case count > 1:
+			status = fmt.Sprintf("REDAN TESTAD (%d gånger)", count)
+			fill = color.NRGBA{R: 255, G: 170, B: 60, A: 255}
+		default:
+			status = fmt.Sprintf("OK - %s", strings.Join(registered[chip], ", "))
+			fill = color.NRGBA{R: 120, G: 220, B: 120, A: 255}
+		}
+
+		readLog = append([]string{fmt.Sprintf("%s  %s  %s %s",
+			readTime.Format("15:04:05"), status, chip, names[chip])}, readLog...)
+		if len(readLog) > 100 {
+			readLog = readLog[:100]
+		}
+		mu.Unlock()
+
+		bibText.Text = chip
+		nameText.Text = names[chip]
+		statusText.Text = status
+		background.FillColor = fill
+
+		bibText.Refresh()
+		nameText.Refresh()
+		statusText.Refresh()
+		background.Refresh()
+		logList.Refresh()
+		updateUntested()
+	}
+
+	var stopTail func()
+
+	fileButton := widget.NewButton("Välj läsarfil", func() {
+		d := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, checkWindow)
+				return
+			}
+			if reader == nil {
+				return
+			}
+
+			filename := reader.URI().Path()
+			reader.Close()
+
+			if stopTail != nil {
+				stopTail()
+				stopTail = nil
+			}
+
+			stop, err := tailReaderFile(filename, handleRead)
+			if err != nil {
+				dialog.ShowError(err, checkWindow)
+				return
+			}
+			stopTail = stop
+			statusText.Text = "Väntar på läsningar..."
+			statusText.Refresh()
+
+			// Varna om filen även används som resultatfil för ett lopp
+			for _, race := range races {
+				if race.ResultsFile == filename {
+					dialog.ShowInformation("Chipkontroll",
+						fmt.Sprintf("Filen används också som resultatfil för %s. Läsningar efter starten räknas i resultaten, använd en separat läsare för testmattan.", race.Name),
+						checkWindow)
+					break
+				}
+			}
+		}, checkWindow)
+		d.Resize(fyne.NewSize(1200, 800))
+		d.Show()
+	})
+
+	resetButton := widget.NewButton("Nollställ testade", func() {
+		mu.Lock()
+		tested = make(map[string]int)
+		readLog = nil
+		mu.Unlock()
+		logList.Refresh()
+		updateUntested()
+	})
+
+	display := container.NewStack(background, container.NewVBox(
+		layoutSpacer(),
+		bibText,
+		nameText,
+		statusText,
+		layoutSpacer(),
+	))
+
+	checkWindow.SetContent(container.NewBorder(
+		container.NewHBox(fileButton, resetButton),
+		nil,
+		nil,
+		container.NewBorder(untestedLabel, nil, nil, nil, untestedList),
+		container.NewVSplit(display, logList),
+	))
+	checkWindow.SetOnClosed(func() {
+		if stopTail != nil {
+			stopTail()
+		}
+	})
+	checkWindow.Resize(fyne.NewSize(1200, 800))
+	checkWindow.CenterOnScreen()
+	checkWindow.Show()
+}
+
+// Hjälpfunktion för luft ovanför och under de stora texterna
+func layoutSpacer() fyne.CanvasObject {
+	spacer := canvas.NewRectangle(color.Transparent)
+	spacer.SetMinSize(fyne.NewSize(0, 40))
+	return spacer
+}
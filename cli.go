@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jimmitjoo/hogby-tidtagning/internal/services/sheets"
+	"github.com/jimmitjoo/hogby-tidtagning/internal/timeformat"
+)
+
+// Ett kommando som kan köras från kommandoraden utan grafiskt gränssnitt
+type cliCommand struct {
+	name        string
+	usage       string
+	description string
+	run         func(args []string, stdout io.Writer) error
+	// Kommandon som bara läser kräver ett befintligt evenemang, övriga skapar det vid behov
+	readOnly bool
+}
+
+// Alla kommandon i den ordning de visas i hjälptexten
+func cliCommands() []cliCommand {
+	return []cliCommand{
+		{"races", "races [-archived]", "Lista loppen i evenemanget", cliRaces, true},
+		{"results", "results [-format csv|json] [-all] <lopp>", "Skriv loppets resultat till stdout", cliResults, true},
+		{"add-time", "add-time [-user namn] <lopp> <startnummer> <tid>", "Lägg till en manuell tid", cliAddTime, false},
+		{"invalidate", "invalidate [-user namn] <lopp> <startnummer> <tid>", "Markera en läsning som felaktig", cliMarkRead(journalInvalidate), false},
+		{"validate", "validate [-user namn] <lopp> <startnummer> <tid>", "Markera en läsning som giltig igen", cliMarkRead(journalValidate), false},
+		{"export-sheets", "export-sheets [-spreadsheet id] [-sheet namn] <lopp>", "Exportera resultaten till Google Sheets", cliExportSheets, false},
+		{"serve", "serve [-addr adress] [-token nyckel]", "Kör tidtagningen utan skärm och visa läget över HTTP", cliServe, false},
+	}
+}
+
+// Skriv hjälptexten för programmet och dess kommandon
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Användning: %s [-workspace mapp] [kommando] [argument]\n\n", os.Args[0])
+	fmt.Fprintln(w, "Utan kommando startar det grafiska gränssnittet. Kommandon:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, command := range cliCommands() {
+		fmt.Fprintf(tw, "  %s\t%s\n", command.usage, command.description)
+	}
+	tw.Flush()
+	fmt.Fprintln(w, "\nFlaggor:")
+	flag.CommandLine.SetOutput(w)
+	flag.PrintDefaults()
+}
+
+// Kör ett kommando mot evenemanget i workspace, eller mot det senast öppnade om inget anges.
+// Returnerar programmets slutkod.
+func runCLI(workspace string, args []string, stdout, stderr io.Writer) int {
+	for _, command := range cliCommands() {
+		if command.name != args[0] {
+			continue
+		}
+
+		workspace, err := cliWorkspace(workspace, command.readOnly)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		if err := useWorkspace(workspace); err != nil {
+			fmt.Fprintf(stderr, "kunde inte öppna evenemang %s: %v\n", workspace, err)
+			return 1
+		}
+		getLogger().Log("Kör kommando: %s", strings.Join(args, " "))
+
+		if err := command.run(args[1:], stdout); err != nil {
+			if err == flag.ErrHelp {
+				return 2
+			}
+			fmt.Fprintf(stderr, "%s: %v\n", command.name, err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(stderr, "okänt kommando: %s\n\n", args[0])
+	printUsage(stderr)
+	return 2
+}
+
+// Evenemanget som kommandot körs mot, det senast öppnade om inget anges. Ett nytt evenemang
+// skapas bara när mappen anges uttryckligen och kommandot ändrar något.
+func cliWorkspace(workspace string, readOnly bool) (string, error) {
+	if workspace == "" {
+		recent, err := loadRecentWorkspaces()
+		if err != nil || len(recent) == 0 {
+			return "", fmt.Errorf("inget evenemang har öppnats än, ange evenemangets mapp med -workspace")
+		}
+		workspace = recent[0].Path
+		// Ett evenemang som flyttats eller tagits bort ska inte skapas på nytt
+		readOnly = true
+	}
+	if readOnly && !workspaceExists(workspace) {
+		return "", fmt.Errorf("hittade inget evenemang i %s", workspace)
+	}
+	return workspace, nil
+}
+
+// Skapa flaggorna för ett kommando, fel i argumenten skrivs ut med kommandots användning
+func newCommandFlags(name, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Användning: %s\n", usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// Kontrollera antalet argument efter flaggorna
+func requireArgs(flags *flag.FlagSet, count int) error {
+	if flags.NArg() != count {
+		flags.Usage()
+		return fmt.Errorf("förväntade %d argument men fick %d", count, flags.NArg())
+	}
+	return nil
+}
+
+// Hitta ett lopp på ID eller namn
+func findRace(races []Race, ref string) (int, error) {
+	for i, race := range races {
+		if race.ID == ref {
+			return i, nil
+		}
+	}
+
+	found := -1
+	for i, race := range races {
+		if strings.EqualFold(race.Name, ref) {
+			if found >= 0 {
+				return -1, fmt.Errorf("flera lopp heter %s, ange loppets ID istället", ref)
+			}
+			found = i
+		}
+	}
+	if found < 0 {
+		return -1, fmt.Errorf("hittade inget lopp med ID eller namn %s", ref)
+	}
+	return found, nil
+}
+
+// Läs in loppen och hitta det angivna loppet
+func loadRaceForCLI(ref string) ([]Race, int, error) {
+	races, err := loadRaces()
+	if err != nil {
+		return nil, -1, err
+	}
+	index, err := findRace(races, ref)
+	if err != nil {
+		return nil, -1, err
+	}
+	return races, index, nil
+}
+
+func cliRaces(args []string, stdout io.Writer) error {
+	flags := newCommandFlags("races", "races [-archived]")
+	archived := flags.Bool("archived", false, "visa även arkiverade lopp")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireArgs(flags, 0); err != nil {
+		return err
+	}
+
+	races, err := loadRaces()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNamn\tStatus\tStarttid\tAnmälda\tLäsarfil")
+	for _, race := range races {
+		if raceStatus(race) == RaceStatusArchived && !*archived {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", race.ID, race.Name, raceStatusLabel(raceStatus(race)),
+			race.StartTime.Format("2006-01-02 15:04:05"), len(race.Chips), race.ResultsFile)
+	}
+	return tw.Flush()
+}
+
+func cliResults(args []string, stdout io.Writer) error {
+	flags := newCommandFlags("results", "results [-format csv|json] [-all] <lopp>")
+	format := flags.String("format", "csv", "utdataformat, csv eller json")
+	all := flags.Bool("all", false, "skriv alla läsningar inklusive felaktiga istället för slutresultatet")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireArgs(flags, 1); err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("okänt format %s, använd csv eller json", *format)
+	}
+
+	races, index, err := loadRaceForCLI(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	race := races[index]
+
+	if !*all {
+		if *format == "json" {
+			return writeJSONTo(stdout, buildResultRows(race))
+		}
+		return writeResultsCSV(stdout, race)
+	}
+
+	results := readAllResults(race)
+	if *format == "json" {
+		return writeJSONTo(stdout, results)
+	}
+
+	writer := csv.NewWriter(stdout)
+	if err := writer.Write([]string{"Startnr", "Namn", "Klockslag", "Tid", "Status", "Manuell"}); err != nil {
+		return err
+	}
+	for _, result := range results {
+		status := "OK"
+		if result.Invalid {
+			status = "Felaktig"
+		}
+		manual := ""
+		if result.Manual {
+			manual = "ja"
+		}
+		if err := writer.Write([]string{
+			result.Chip,
+			participantName(race, result.Chip),
+			result.Time.Format(readerTimeLayout),
+			timeformat.Duration(result.Duration),
+			status,
+			manual,
+		}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Skriv indenterad JSON
+func writeJSONTo(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(v)
+}
+
+func cliAddTime(args []string, stdout io.Writer) error {
+	flags := newCommandFlags("add-time", "add-time [-user namn] <lopp> <startnummer> <tid>")
+	user := flags.String("user", currentUser(), "namn som sparas i journalen")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireArgs(flags, 3); err != nil {
+		return err
+	}
+
+	races, index, err := loadRaceForCLI(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	race := races[index]
+
+	chip, recordTime, err := validateManualTime(race, flags.Arg(1), flags.Arg(2))
+	if err != nil {
+		return err
+	}
+
+	if _, err := recordJournalEntry(&race, newManualTimeEntry(race, chip, recordTime, *user)); err != nil {
+		return err
+	}
+
+	races[index] = race
+	if err := saveRace(race); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "La till %s för %s i %s\n", timeformat.Duration(recordTime.Sub(race.StartTime)), chip, race.Name)
+	return nil
+}
+
+// Kommando som markerar en läsning som felaktig eller giltig
+func cliMarkRead(entryType string) func(args []string, stdout io.Writer) error {
+	return func(args []string, stdout io.Writer) error {
+		name := "invalidate"
+		if entryType == journalValidate {
+			name = "validate"
+		}
+		flags := newCommandFlags(name, name+" [-user namn] <lopp> <startnummer> <tid>")
+		user := flags.String("user", currentUser(), "namn som sparas i journalen")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if err := requireArgs(flags, 3); err != nil {
+			return err
+		}
+
+		races, index, err := loadRaceForCLI(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		race := races[index]
+		chip := strings.TrimSpace(flags.Arg(1))
+
+		readTime, err := parseManualTime(race, flags.Arg(2))
+		if err != nil {
+			return err
+		}
+
+		// Läsningen måste finnas bland loppets tider
+		read, err := findChipRead(race, chip, readTime)
+		if err != nil {
+			return err
+		}
+		if read.Invalid == (entryType == journalInvalidate) {
+			fmt.Fprintf(stdout, "Läsningen av %s vid %s är redan markerad så\n", chip, readTime.Format("15:04:05"))
+			return nil
+		}
+
+		entry, err := recordJournalEntry(&race, JournalEntry{
+			User:     *user,
+			Type:     entryType,
+			Chip:     chip,
+			ReadTime: &read.Time,
+		})
+		if err != nil {
+			return err
+		}
+
+		races[index] = race
+		if err := saveRace(race); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, describeJournalEntry(entry))
+		return nil
+	}
+}
+
+func cliExportSheets(args []string, stdout io.Writer) error {
+	flags := newCommandFlags("export-sheets", "export-sheets [-spreadsheet id] [-sheet namn] <lopp>")
+	spreadsheetID := flags.String("spreadsheet", "", "kalkylarkets ID, annars används loppets sparade")
+	sheetName := flags.String("sheet", "", "bladets namn, annars används loppets sparade")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireArgs(flags, 1); err != nil {
+		return err
+	}
+
+	races, index, err := loadRaceForCLI(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	race := races[index]
+
+	if *spreadsheetID != "" {
+		race.SpreadsheetId = *spreadsheetID
+	}
+	if *sheetName != "" {
+		race.SheetName = *sheetName
+	}
+	if race.SpreadsheetId == "" || race.SheetName == "" {
+		return fmt.Errorf("kalkylark och blad måste anges med -spreadsheet och -sheet första gången")
+	}
+
+	// Första gången måste kontot godkännas i webbläsaren och koden klistras in här
+	sheetsService, err := sheets.NewSheetsService("", func(authURL string, onCode func(string) error) {
+		fmt.Fprintf(os.Stderr, "Öppna länken nedan, godkänn åtkomsten och klistra in koden:\n%s\nKod: ", authURL)
+		go func() {
+			code, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			onCode(strings.TrimSpace(code))
+		}()
+	})
+	if err != nil {
+		return fmt.Errorf("kunde inte skapa Sheets-service: %v", err)
+	}
+
+	results := sheetsResultsForRace(race)
+	if err := sheetsService.ExportResults(race.SpreadsheetId, race.SheetName, results); err != nil {
+		return fmt.Errorf("kunde inte exportera resultat: %v", err)
+	}
+
+	markResultsExported(&race)
+	races[index] = race
+	if err := saveRace(race); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Exporterade %d resultat för %s till bladet %s\n", len(results), race.Name, race.SheetName)
+	return nil
+}
+
+func cliServe(args []string, stdout io.Writer) error {
+	flags := newCommandFlags("serve", "serve [-addr adress] [-token nyckel]")
+	addr := flags.String("addr", "127.0.0.1:8080", "adress och port som HTTP-API:et lyssnar på")
+	token := flags.String("token", "", "API-nyckel för ändringar, annars används den som sparats i evenemanget")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireArgs(flags, 0); err != nil {
+		return err
+	}
+	return runServer(*addr, *token, stdout)
+}
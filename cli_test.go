@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunCLIReadOnlyCommandRequiresEvent(t *testing.T) {
+	useTestWorkspace(t)
+	dir := t.TempDir()
+
+	var stdout, stderr bytes.Buffer
+	if code := runCLI(dir, []string{"races"}, &stdout, &stderr); code != 1 {
+		t.Errorf("slutkod %d, väntade 1", code)
+	}
+	if !strings.Contains(stderr.String(), "hittade inget evenemang") {
+		t.Errorf("oväntat fel: %q", stderr.String())
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("kommandot skapade filer i mappen: %v", entries)
+	}
+}
+
+func TestRunCLIWithoutWorkspaceUsesRecentEvent(t *testing.T) {
+	dir := useTestWorkspace(t)
+	saveTestRace(t, RaceStatusStarted)
+
+	var stdout, stderr bytes.Buffer
+	if code := runCLI("", []string{"races"}, &stdout, &stderr); code != 1 {
+		t.Errorf("utan senaste evenemang: slutkod %d, väntade 1", code)
+	}
+
+	if err := rememberWorkspace(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := runCLI("", []string{"races"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("slutkod %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Milen") {
+		t.Errorf("loppet saknas i listan: %q", stdout.String())
+	}
+}
+
+func TestRunCLIAddTimeAndResults(t *testing.T) {
+	dir := useTestWorkspace(t)
+	saveTestRace(t, RaceStatusStarted)
+
+	var stdout, stderr bytes.Buffer
+	if code := runCLI(dir, []string{"add-time", "-user", "test", "Milen", "1", "2026-05-17 10:40:00"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("add-time: slutkod %d: %s", code, stderr.String())
+	}
+	cacheFile := filepath.Join(dir, "results_lopp1.json")
+	os.Remove(cacheFile)
+
+	for _, args := range [][]string{
+		{"results", "Milen"},
+		{"results", "-all", "Milen"},
+		{"results", "-format", "json", "lopp1"},
+	} {
+		stdout.Reset()
+		stderr.Reset()
+		if code := runCLI(dir, args, &stdout, &stderr); code != 0 {
+			t.Errorf("%v: slutkod %d: %s", args, code, stderr.String())
+			continue
+		}
+		if !strings.Contains(stdout.String(), "40:00") {
+			t.Errorf("%v: tiden saknas i resultatet: %q", args, stdout.String())
+		}
+	}
+
+	if _, err := os.Stat(cacheFile); !os.IsNotExist(err) {
+		t.Errorf("resultatkommandot skrev resultatcachen")
+	}
+}
+
+// Skrivare som alltid misslyckas, som en stängd pipe
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("stängd pipe")
+}
+
+func TestCLIResultsReportsWriteErrors(t *testing.T) {
+	useTestWorkspace(t)
+	saveTestRace(t, RaceStatusStarted)
+
+	for _, args := range [][]string{{"Milen"}, {"-all", "Milen"}} {
+		if err := cliResults(args, failingWriter{}); err == nil {
+			t.Errorf("%v: väntade fel när utdata inte kan skrivas", args)
+		}
+	}
+}
@@ -8,13 +8,9 @@ import (
 // MarshalJSON för Race
 func (r Race) MarshalJSON() ([]byte, error) {
 	return json.Marshal(DurationRace{
-		Name:         r.Name,
-		StartTime:    r.StartTime,
+		raceFields:   raceFields(r),
 		MinTime:      r.MinTime.String(),
-		Chips:        r.Chips,
-		ResultsFile:  r.ResultsFile,
-		InvalidTimes: r.InvalidTimes,
-		LiveUpdate:   r.LiveUpdate,
+		SilenceAlarm: formatOptionalDuration(r.SilenceAlarm),
 	})
 }
 
@@ -25,27 +21,43 @@ func (r *Race) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	minTime, err := time.ParseDuration(dr.MinTime)
+	minTime, err := parseOptionalDuration(dr.MinTime)
 	if err != nil {
 		return err
 	}
 
-	r.Name = dr.Name
-	r.StartTime = dr.StartTime
+	silenceAlarm, err := parseOptionalDuration(dr.SilenceAlarm)
+	if err != nil {
+		return err
+	}
+
+	*r = Race(dr.raceFields)
 	r.MinTime = minTime
-	r.Chips = dr.Chips
-	r.ResultsFile = dr.ResultsFile
-	r.InvalidTimes = dr.InvalidTimes
-	r.LiveUpdate = dr.LiveUpdate
+	r.SilenceAlarm = silenceAlarm
 	return nil
 }
 
+// Hjälpfunktion för att inte skriva ut tomma tidsinställningar
+func formatOptionalDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// Hjälpfunktion för att läsa tidsinställningar som kan saknas
+func parseOptionalDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
 // MarshalJSON för ChipResult
 func (cr ChipResult) MarshalJSON() ([]byte, error) {
 	return json.Marshal(DurationChipResult{
-		Chip:     cr.Chip,
-		Time:     cr.Time,
-		Duration: cr.Duration.String(),
+		chipResultFields: chipResultFields(cr),
+		Duration:         cr.Duration.String(),
 	})
 }
 
@@ -61,8 +73,7 @@ func (cr *ChipResult) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	cr.Chip = dcr.Chip
-	cr.Time = dcr.Time
+	*cr = ChipResult(dcr.chipResultFields)
 	cr.Duration = duration
 	return nil
 }
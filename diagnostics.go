@@ -0,0 +1,258 @@
+//go:build !headless
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Gå igenom läsarfilen och samla rader som inte kan användas i resultaten
+func analyzeReaderFile(race Race, races []Race) (ReadDiagnostics, error) {
+	diagnostics := ReadDiagnostics{}
+
+	file, err := os.Open(race.ResultsFile)
+	if err != nil {
+		return diagnostics, fmt.Errorf("kunde inte öppna läsarfil: %v", err)
+	}
+	defer file.Close()
+
+	// Alla startnummer som finns registrerade i något lopp
+	registered := make(map[string]bool)
+	for _, r := range races {
+		for chip := range r.Chips {
+			registered[chip] = true
+		}
+	}
+	for chip := range race.Chips {
+		registered[chip] = true
+	}
+
+	// Startchipet läses vid startskottet och är inget okänt startnummer
+	for _, r := range races {
+		if r.StartChip != "" {
+			registered[r.StartChip] = true
+		}
+	}
+
+	unknown := make(map[string]*ChipReadSummary)
+	early := make(map[string]*ChipReadSummary)
+
+	reader := csv.NewReader(file)
+	reader.Comma = '\t'
+	reader.FieldsPerRecord = -1
+	parser := newReaderRecordParser(race.ResultsFile, race.StartTime)
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		diagnostics.TotalLines++
+
+		if err != nil {
+			line := diagnostics.TotalLines
+			if parseErr, ok := err.(*csv.ParseError); ok {
+				line = parseErr.StartLine
+			}
+			diagnostics.ParseErrors = append(diagnostics.ParseErrors, ReaderLineError{
+				Line:   line,
+				Text:   strings.Join(record, "\t"),
+				Reason: err.Error(),
+			})
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		chip, recordTime, err := parser.parse(record)
+		if err != nil {
+			diagnostics.ParseErrors = append(diagnostics.ParseErrors, ReaderLineError{
+				Line:   line,
+				Text:   strings.Join(record, "\t"),
+				Reason: err.Error(),
+			})
+			continue
+		}
+
+		if !registered[chip] {
+			addChipRead(unknown, chip, recordTime)
+			continue
+		}
+
+		if race.Chips[chip] && !roundUpToSecond(recordTime).After(race.StartTime) {
+			addChipRead(early, chip, recordTime)
+		}
+	}
+
+	diagnostics.UnknownChips = sortedChipReads(unknown)
+	diagnostics.EarlyReads = sortedChipReads(early)
+
+	return diagnostics, nil
+}
+
+// Hjälpfunktion för att räkna läsningar per startnummer
+func addChipRead(reads map[string]*ChipReadSummary, chip string, recordTime time.Time) {
+	summary, exists := reads[chip]
+	if !exists {
+		reads[chip] = &ChipReadSummary{
+			Chip:  chip,
+			Count: 1,
+			First: recordTime,
+			Last:  recordTime,
+		}
+		return
+	}
+
+	summary.Count++
+	if recordTime.Before(summary.First) {
+		summary.First = recordTime
+	}
+	if recordTime.After(summary.Last) {
+		summary.Last = recordTime
+	}
+}
+
+// Hjälpfunktion för att sortera läsningarna på första lästid
+func sortedChipReads(reads map[string]*ChipReadSummary) []ChipReadSummary {
+	sorted := make([]ChipReadSummary, 0, len(reads))
+	for _, summary := range reads {
+		sorted = append(sorted, *summary)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].First.Before(sorted[j].First)
+	})
+	return sorted
+}
+
+// Visa diagnostik för loppets läsarfil
+func showDiagnostics(race *Race, races []Race, index int, app fyne.App, onChange func()) {
+	diagWindow := app.NewWindow(fmt.Sprintf("Diagnostik - %s", race.Name))
+
+	if race.ResultsFile == "" {
+		dialog.ShowInformation("Diagnostik", "Loppet har ingen resultatfil vald", diagWindow)
+	}
+
+	var diagnostics ReadDiagnostics
+	var refresh func()
+	summaryLabel := widget.NewLabel("")
+
+	parseErrorList := widget.NewList(
+		func() int {
+			return len(diagnostics.ParseErrors)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			parseErr := diagnostics.ParseErrors[id]
+			obj.(*widget.Label).SetText(fmt.Sprintf("Rad %d: %s (%s)", parseErr.Line, parseErr.Text, parseErr.Reason))
+		})
+
+	unknownList := widget.NewList(
+		func() int {
+			return len(diagnostics.UnknownChips)
+		},
+		func() fyne.CanvasObject {
+			return container.NewBorder(nil, nil, nil, widget.NewButton("Lägg till i loppet", nil), widget.NewLabel(""))
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			summary := diagnostics.UnknownChips[id]
+			row := obj.(*fyne.Container)
+			label := row.Objects[0].(*widget.Label)
+			button := row.Objects[1].(*widget.Button)
+
+			label.SetText(fmt.Sprintf("%s - %d läsningar (första %s, sista %s)",
+				summary.Chip, summary.Count,
+				summary.First.Format("15:04:05"), summary.Last.Format("15:04:05")))
+
+			// Startnummer kan inte läggas till i ett lopp med låsta resultat
+			if raceResultsEditable(*race) {
+				button.Enable()
+			} else {
+				button.Disable()
+			}
+			button.OnTapped = func() {
+				if !raceResultsEditable(*race) {
+					dialog.ShowError(raceLockedError(*race), diagWindow)
+					return
+				}
+				if race.Chips == nil {
+					race.Chips = make(map[string]bool)
+				}
+				race.Chips[summary.Chip] = true
+				races[index] = *race
+				if err := saveRace(*race); err != nil {
+					dialog.ShowError(err, diagWindow)
+					return
+				}
+				getLogger().Log("Lade till okänt startnummer %s i lopp %s", summary.Chip, race.Name)
+				refresh()
+				onChange()
+			}
+		})
+
+	earlyList := widget.NewList(
+		func() int {
+			return len(diagnostics.EarlyReads)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			summary := diagnostics.EarlyReads[id]
+			obj.(*widget.Label).SetText(fmt.Sprintf("%s - %d läsningar (sista %s)",
+				summary.Chip, summary.Count, summary.Last.Format("15:04:05")))
+		})
+
+	tabs := container.NewAppTabs(
+		container.NewTabItem("Tolkningsfel", parseErrorList),
+		container.NewTabItem("Okända startnummer", unknownList),
+		container.NewTabItem("Före start", earlyList),
+	)
+
+	// Läs om filen och uppdatera alla listor
+	refresh = func() {
+		if race.ResultsFile == "" {
+			return
+		}
+		result, err := analyzeReaderFile(*race, races)
+		if err != nil {
+			dialog.ShowError(err, diagWindow)
+			return
+		}
+		diagnostics = result
+
+		summaryLabel.SetText(fmt.Sprintf("%d rader lästa från %s", diagnostics.TotalLines, race.ResultsFile))
+		tabs.Items[0].Text = fmt.Sprintf("Tolkningsfel (%d)", len(diagnostics.ParseErrors))
+		tabs.Items[1].Text = fmt.Sprintf("Okända startnummer (%d)", len(diagnostics.UnknownChips))
+		tabs.Items[2].Text = fmt.Sprintf("Före start (%d)", len(diagnostics.EarlyReads))
+		tabs.Refresh()
+		parseErrorList.Refresh()
+		unknownList.Refresh()
+		earlyList.Refresh()
+	}
+
+	refreshButton := widget.NewButton("Läs om filen", refresh)
+
+	diagWindow.SetContent(container.NewBorder(
+		container.NewVBox(summaryLabel, refreshButton),
+		nil, nil, nil,
+		tabs,
+	))
+	diagWindow.Resize(fyne.NewSize(800, 600))
+	diagWindow.CenterOnScreen()
+	diagWindow.Show()
+
+	refresh()
+}
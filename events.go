@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Typer av händelser som skickas till anslutna klienter
+const (
+	raceEventFinish       = "finish"
+	raceEventCorrection   = "correction"
+	raceEventRemoved      = "removed"
+	raceEventInvalidate   = "invalidate"
+	raceEventValidate     = "validate"
+	raceEventManualAdd    = "manualTimeAdded"
+	raceEventManualEdit   = "manualTimeChanged"
+	raceEventManualDelete = "manualTimeRemoved"
+	raceEventReset        = "reset"
+)
+
+// Hur många händelser som sparas för klienter som ansluter igen
+const eventBufferSize = 10000
+
+// Hur ofta en tom rad skickas så att anslutningen hålls vid liv
+const eventKeepAlive = 15 * time.Second
+
+// Hur många händelser en klient får ligga efter innan den kopplas bort
+const eventSubscriberBuffer = 256
+
+// En ändring i ett lopps resultat
+type RaceEvent struct {
+	Seq      int64       `json:"seq"`
+	Type     string      `json:"type"`
+	RaceID   string      `json:"raceId"`
+	At       time.Time   `json:"at"`
+	Chip     string      `json:"chip,omitempty"`
+	ReadTime *time.Time  `json:"readTime,omitempty"`
+	Result   *ResultRow  `json:"result,omitempty"`
+	Previous *ResultRow  `json:"previous,omitempty"`
+	Manual   *ManualTime `json:"manualTime,omitempty"`
+}
+
+// Numrerar händelser och skickar dem till anslutna klienter. De senaste händelserna
+// sparas så att en klient som tappat anslutningen kan fortsätta där den var. Numreringen
+// börjar om för varje körning av servern, epoch skiljer körningarna åt.
+type eventHub struct {
+	mu          sync.Mutex
+	epoch       string
+	seq         int64
+	trimmed     int64
+	events      []RaceEvent
+	subscribers map[chan RaceEvent]string
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		epoch:       newID(),
+		subscribers: make(map[chan RaceEvent]string),
+	}
+}
+
+// ID för en händelse i händelseströmmen, "<epoch>-<seq>"
+func (h *eventHub) eventID(event RaceEvent) string {
+	return fmt.Sprintf("%s-%d", h.epoch, event.Seq)
+}
+
+// Tolka ett ID från händelseströmmen. Ett ID utan epoch, som ?since=N, räknas till den
+// pågående körningen.
+func parseEventID(text string) (string, int64, error) {
+	epoch, seqText, found := strings.Cut(text, "-")
+	if !found {
+		epoch, seqText = "", text
+	}
+	seq, err := strconv.ParseInt(seqText, 10, 64)
+	if err != nil || seq < 0 {
+		return "", 0, fmt.Errorf("ogiltigt händelse-ID: %s", text)
+	}
+	return epoch, seq, nil
+}
+
+// Numrera och skicka ut nya händelser
+func (h *eventHub) publish(events []RaceEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, event := range events {
+		h.seq++
+		event.Seq = h.seq
+		h.events = append(h.events, event)
+
+		for ch, raceID := range h.subscribers {
+			if raceID != event.RaceID {
+				continue
+			}
+			select {
+			case ch <- event:
+			default:
+				// Klienten hinner inte med, den får ansluta igen och ta igen det den missat
+				close(ch)
+				delete(h.subscribers, ch)
+			}
+		}
+	}
+
+	if len(h.events) > eventBufferSize {
+		drop := len(h.events) - eventBufferSize
+		h.trimmed = h.events[drop-1].Seq
+		h.events = append([]RaceEvent{}, h.events[drop:]...)
+	}
+}
+
+// Börja ta emot händelser för ett lopp. Med since >= 0 returneras även sparade händelser
+// efter det numret, eller en reset-händelse om de inte längre finns kvar. En tom epoch
+// räknas till den pågående körningen.
+func (h *eventHub) subscribe(raceID string, epoch string, since int64) ([]RaceEvent, chan RaceEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var replay []RaceEvent
+	switch {
+	case since < 0:
+	case (epoch != "" && epoch != h.epoch) || since < h.trimmed || since > h.seq:
+		// Händelserna är från en tidigare körning av servern eller finns inte kvar
+		replay = append(replay, RaceEvent{Seq: h.seq, Type: raceEventReset, RaceID: raceID, At: time.Now()})
+	default:
+		for _, event := range h.events {
+			if event.Seq > since && event.RaceID == raceID {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	ch := make(chan RaceEvent, eventSubscriberBuffer)
+	h.subscribers[ch] = raceID
+	return replay, ch
+}
+
+// Sluta ta emot händelser
+func (h *eventHub) unsubscribe(ch chan RaceEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, exists := h.subscribers[ch]; exists {
+		close(ch)
+		delete(h.subscribers, ch)
+	}
+}
+
+// Koppla bort alla klienter, används när servern stängs
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		close(ch)
+		delete(h.subscribers, ch)
+	}
+}
+
+// Jämför två uppsättningar resultat och manuella tider och beskriv skillnaderna som händelser
+func diffRaceEvents(race Race, prevResults, nextResults []ChipResult, prevManual, nextManual []ManualTime, now time.Time) []RaceEvent {
+	var events []RaceEvent
+	newEvent := func(eventType, chip string) RaceEvent {
+		return RaceEvent{Type: eventType, RaceID: race.ID, At: now, Chip: chip}
+	}
+
+	// Manuella tider jämförs på ID
+	prevManualByID := make(map[string]ManualTime)
+	for _, mt := range prevManual {
+		prevManualByID[mt.ID] = mt
+	}
+	nextManualByID := make(map[string]bool)
+	for _, mt := range nextManual {
+		mt := mt
+		nextManualByID[mt.ID] = true
+		previous, existed := prevManualByID[mt.ID]
+		switch {
+		case !existed:
+			event := newEvent(raceEventManualAdd, mt.Chip)
+			event.Manual = &mt
+			events = append(events, event)
+		case previous.Chip != mt.Chip || !previous.Time.Equal(mt.Time):
+			event := newEvent(raceEventManualEdit, mt.Chip)
+			event.Manual = &mt
+			events = append(events, event)
+		}
+	}
+	for _, mt := range prevManual {
+		mt := mt
+		if !nextManualByID[mt.ID] {
+			event := newEvent(raceEventManualDelete, mt.Chip)
+			event.Manual = &mt
+			events = append(events, event)
+		}
+	}
+
+	// Läsningar som markerats som felaktiga eller giltiga igen
+	prevInvalid := make(map[string]bool)
+	for _, result := range prevResults {
+		prevInvalid[makeInvalidTimeKey(result.Chip, result.Time)] = result.Invalid
+	}
+	var marked []RaceEvent
+	for _, result := range nextResults {
+		wasInvalid, existed := prevInvalid[makeInvalidTimeKey(result.Chip, result.Time)]
+		readTime := result.Time
+		switch {
+		case result.Invalid && (!existed || !wasInvalid):
+			event := newEvent(raceEventInvalidate, result.Chip)
+			event.ReadTime = &readTime
+			marked = append(marked, event)
+		case !result.Invalid && existed && wasInvalid:
+			event := newEvent(raceEventValidate, result.Chip)
+			event.ReadTime = &readTime
+			marked = append(marked, event)
+		}
+	}
+	sort.SliceStable(marked, func(i, j int) bool {
+		return marked[i].ReadTime.Before(*marked[j].ReadTime)
+	})
+	events = append(events, marked...)
+
+	// Nya, ändrade och borttagna måltider i slutresultatet
+	prevRows := make(map[string]ResultRow)
+	for _, row := range resultRowsFrom(race, prevResults) {
+		prevRows[row.Chip] = row
+	}
+	nextRows := resultRowsFrom(race, nextResults)
+	finished := make(map[string]bool)
+	for _, row := range nextRows {
+		row := row
+		finished[row.Chip] = true
+		previous, existed := prevRows[row.Chip]
+		switch {
+		case !existed:
+			event := newEvent(raceEventFinish, row.Chip)
+			event.Result = &row
+			events = append(events, event)
+		case previous.Duration != row.Duration || previous.Manual != row.Manual:
+			event := newEvent(raceEventCorrection, row.Chip)
+			event.Result = &row
+			event.Previous = &previous
+			events = append(events, event)
+		}
+	}
+	var removed []RaceEvent
+	for chip, row := range prevRows {
+		row := row
+		if !finished[chip] {
+			event := newEvent(raceEventRemoved, chip)
+			event.Previous = &row
+			removed = append(removed, event)
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		return removed[i].Previous.Place < removed[j].Previous.Place
+	})
+	events = append(events, removed...)
+
+	return events
+}
+
+// Händelseström för ett lopp som Server-Sent Events. Med ?since=ID eller Last-Event-ID
+// skickas först de händelser klienten har missat.
+func (s *timingServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	race, ok := s.raceFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("servern kan inte skicka händelser"))
+		return
+	}
+
+	epoch, since := "", int64(-1)
+	sinceText := r.URL.Query().Get("since")
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		sinceText = lastID
+	}
+	if sinceText != "" {
+		var err error
+		epoch, since, err = parseEventID(sinceText)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	replay, ch := s.events.subscribe(race.ID, epoch, since)
+	defer s.events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	writeEvent := func(event RaceEvent) bool {
+		data, err := json.Marshal(event)
+		if err != nil {
+			getLogger().Log("Kunde inte skapa händelse: %v", err)
+			return true
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\ndata: %s\n\n", s.events.eventID(event), data); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	for _, event := range replay {
+		if !writeEvent(event) {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, open := <-ch:
+			if !open {
+				return
+			}
+			if !writeEvent(event) {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import "testing"
+
+// Skapa n händelser för ett lopp
+func testRaceEvents(raceID string, n int) []RaceEvent {
+	events := make([]RaceEvent, n)
+	for i := range events {
+		events[i] = RaceEvent{Type: raceEventFinish, RaceID: raceID, Chip: "1"}
+	}
+	return events
+}
+
+func TestEventHubReplay(t *testing.T) {
+	hub := newEventHub()
+	hub.publish(testRaceEvents("lopp1", 2))
+	hub.publish(testRaceEvents("lopp2", 1))
+	hub.publish(testRaceEvents("lopp1", 2))
+
+	tests := []struct {
+		name  string
+		epoch string
+		since int64
+		want  []int64
+	}{
+		{"ny klient", hub.epoch, -1, nil},
+		{"missade händelser", hub.epoch, 2, []int64{4, 5}},
+		{"utan epoch", "", 1, []int64{2, 4, 5}},
+		{"inget missat", hub.epoch, 5, nil},
+	}
+	for _, tt := range tests {
+		replay, ch := hub.subscribe("lopp1", tt.epoch, tt.since)
+		hub.unsubscribe(ch)
+
+		var got []int64
+		for _, event := range replay {
+			if event.Type == raceEventReset {
+				t.Errorf("%s: fick reset", tt.name)
+			}
+			got = append(got, event.Seq)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: fick %v, väntade %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: fick %v, väntade %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestEventHubReset(t *testing.T) {
+	hub := newEventHub()
+	hub.publish(testRaceEvents("lopp1", eventBufferSize+10))
+
+	// En tidigare körning har ett annat epoch även om numret finns i den här
+	previous := newEventHub()
+
+	tests := []struct {
+		name  string
+		epoch string
+		since int64
+	}{
+		{"trimmade händelser", hub.epoch, 5},
+		{"nummer från framtiden", hub.epoch, eventBufferSize + 20},
+		{"tidigare körning", previous.epoch, eventBufferSize},
+	}
+	for _, tt := range tests {
+		replay, ch := hub.subscribe("lopp1", tt.epoch, tt.since)
+		hub.unsubscribe(ch)
+
+		if len(replay) != 1 || replay[0].Type != raceEventReset {
+			t.Errorf("%s: väntade en reset, fick %d händelser", tt.name, len(replay))
+			continue
+		}
+		if replay[0].Seq != hub.seq {
+			t.Errorf("%s: reset har nummer %d, väntade %d", tt.name, replay[0].Seq, hub.seq)
+		}
+	}
+}
+
+func TestParseEventID(t *testing.T) {
+	hub := newEventHub()
+	epoch, seq, err := parseEventID(hub.eventID(RaceEvent{Seq: 42}))
+	if err != nil || epoch != hub.epoch || seq != 42 {
+		t.Errorf("fick %q %d %v", epoch, seq, err)
+	}
+
+	if epoch, seq, err := parseEventID("7"); err != nil || epoch != "" || seq != 7 {
+		t.Errorf("nummer utan epoch: fick %q %d %v", epoch, seq, err)
+	}
+	for _, text := range []string{"", "abc", "abc-", "abc--1"} {
+		if _, _, err := parseEventID(text); err == nil {
+			t.Errorf("%q godkändes", text)
+		}
+	}
+}
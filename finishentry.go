@@ -0,0 +1,358 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+)
+
+// Hur ofta målsidan skickar köade tider och stämmer av klockan, i millisekunder
+const (
+	finishEntrySyncInterval  = 3000
+	finishEntryClockInterval = 60000
+)
+
+var finishIndexTemplate = template.Must(template.New("finishIndex").Parse(`<!DOCTYPE html>
+<html lang="sv">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Målregistrering - {{.Event}}</title>
+<style>{{.Style}}</style>
+</head>
+<body>
+<header><h1>Målregistrering</h1><p>{{.Event}} · välj lopp</p></header>
+<main>
+{{if .Races}}
+<ul class="races">
+{{range .Races}}<li><a href="/lopp/{{.ID}}/mal{{if $.Token}}?token={{$.Token}}{{end}}">{{.Name}}<span>{{.Status}}</span></a></li>
+{{end}}
+</ul>
+{{else}}
+<p class="empty">Inga lopp tar emot tider just nu</p>
+{{end}}
+</main>
+</body>
+</html>
+`))
+
+var finishEntryTemplate = template.Must(template.New("finishEntry").Parse(`<!DOCTYPE html>
+<html lang="sv">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1, user-scalable=no">
+<title>Mål {{.Name}} - {{.Event}}</title>
+<style>{{.Style}}
+#clock { font-size: 1.6em; font-variant-numeric: tabular-nums; text-align: center; margin: 8px 0; }
+#finish { display: block; width: 100%; font-size: 2.2em; font-weight: bold; padding: 28px 0; border: 0; border-radius: 10px; background: #c0392b; color: #fff; }
+#finish:active { background: #922b21; }
+#connection { text-align: center; font-size: 0.85em; color: #666; margin: 6px 0 12px; }
+#connection.offline { color: #c0392b; font-weight: bold; }
+#token { display: flex; gap: 6px; margin-bottom: 12px; }
+#token input { flex: 1; font-size: 1em; padding: 8px; }
+ul.queue { list-style: none; padding: 0; }
+ul.queue li { background: #fff; border-radius: 6px; margin-bottom: 8px; padding: 10px; display: flex; flex-wrap: wrap; align-items: center; gap: 8px; }
+ul.queue .time { font-size: 1.2em; font-variant-numeric: tabular-nums; min-width: 6.5em; }
+ul.queue input { width: 5em; font-size: 1.3em; padding: 6px; }
+ul.queue .name { flex: 1; color: #444; }
+ul.queue .state { width: 100%; font-size: 0.85em; color: #666; }
+ul.queue li.saved { opacity: 0.6; }
+ul.queue li.error .state { color: #c0392b; }
+ul.queue button { font-size: 1em; padding: 8px 10px; }
+</style>
+</head>
+<body>
+<header><h1>{{.Name}}</h1><p>Målregistrering · {{.Event}}</p></header>
+<main>
+<div id="token" hidden><input id="tokenInput" placeholder="API-nyckel"><button id="tokenSave">Spara</button></div>
+<div id="clock">--:--:--</div>
+<button id="finish">MÅL</button>
+<p id="connection">Ansluter...</p>
+<ul class="queue" id="queue"></ul>
+</main>
+<script>
+const raceID = {{.ID}};
+const raceStart = Date.parse({{.StartTime}});
+const syncInterval = {{.SyncInterval}};
+const clockInterval = {{.ClockInterval}};
+const storageKey = "finish-" + raceID;
+const api = "/api/v1/races/" + encodeURIComponent(raceID);
+
+// Nyckeln följer med i länken första gången och sparas sedan i telefonen
+const params = new URLSearchParams(location.search);
+if (params.get("token")) {
+	localStorage.setItem("finish-token", params.get("token"));
+	history.replaceState(null, "", location.pathname);
+}
+let token = localStorage.getItem("finish-token") || "";
+
+// Skillnad mellan telefonens klocka och tidtagningens, i millisekunder
+let clockOffset = Number(localStorage.getItem("finish-offset") || 0);
+let participants = {};
+let entries = JSON.parse(localStorage.getItem(storageKey) || "[]");
+let syncing = false;
+
+function save() {
+	localStorage.setItem(storageKey, JSON.stringify(entries));
+}
+
+function newID() {
+	const bytes = new Uint8Array(8);
+	crypto.getRandomValues(bytes);
+	return Array.from(bytes, b => b.toString(16).padStart(2, "0")).join("");
+}
+
+// Tidtagningens väggklocka som text, samma format som en manuell tid i programmet
+function wallClock(ms) {
+	return new Date(ms).toISOString().replace("T", " ").slice(0, 23);
+}
+
+function elapsed(ms) {
+	let seconds = Math.max(0, Math.floor((ms - raceStart) / 1000));
+	const h = Math.floor(seconds / 3600);
+	const m = Math.floor(seconds / 60) % 60;
+	const s = seconds % 60;
+	return [h, m, s].map(v => String(v).padStart(2, "0")).join(":");
+}
+
+function setConnection(text, offline) {
+	const el = document.getElementById("connection");
+	el.textContent = text;
+	el.className = offline ? "offline" : "";
+}
+
+async function syncClock() {
+	try {
+		const sent = Date.now();
+		const response = await fetch("/api/v1/clock", { cache: "no-store" });
+		const received = Date.now();
+		const data = await response.json();
+		clockOffset = Date.parse(data.wallClock) + (received - sent) / 2 - received;
+		localStorage.setItem("finish-offset", String(clockOffset));
+	} catch (err) {
+		// Senast kända skillnad används tills kontakten är tillbaka
+	}
+}
+
+async function loadParticipants() {
+	try {
+		const response = await fetch(api + "/participants");
+		if (response.ok) {
+			participants = {};
+			for (const p of await response.json()) {
+				participants[p.chip] = p;
+			}
+			render();
+		}
+	} catch (err) {
+	}
+}
+
+function render() {
+	const list = document.getElementById("queue");
+	list.replaceChildren();
+	for (const entry of entries) {
+		const li = document.createElement("li");
+		li.className = entry.state;
+
+		const time = document.createElement("span");
+		time.className = "time";
+		time.textContent = elapsed(entry.time);
+		li.appendChild(time);
+
+		const input = document.createElement("input");
+		input.inputMode = "numeric";
+		input.placeholder = "Nr";
+		input.value = entry.chip;
+		input.disabled = entry.state === "saved" || entry.state === "sending";
+		input.onchange = () => {
+			entry.chip = input.value.trim();
+			entry.state = entry.chip ? "pending" : "waiting";
+			entry.message = "";
+			save();
+			render();
+			sync();
+		};
+		li.appendChild(input);
+
+		const name = document.createElement("span");
+		name.className = "name";
+		const participant = participants[entry.chip];
+		if (entry.chip && Object.keys(participants).length > 0 && !participant) {
+			name.textContent = "Okänt startnummer";
+		} else if (participant) {
+			name.textContent = participant.name;
+		}
+		li.appendChild(name);
+
+		if (entry.state !== "saved" && entry.state !== "sending") {
+			const remove = document.createElement("button");
+			remove.textContent = "✕";
+			remove.onclick = () => {
+				if (confirm("Ta bort tiden " + elapsed(entry.time) + "?")) {
+					entries = entries.filter(e => e !== entry);
+					save();
+					render();
+				}
+			};
+			li.appendChild(remove);
+		}
+
+		const state = document.createElement("span");
+		state.className = "state";
+		state.textContent = {
+			waiting: "Ange startnummer",
+			pending: "Väntar på att skickas",
+			sending: "Skickas...",
+			saved: "Sparad",
+			error: entry.message || "Fel",
+		}[entry.state] || "";
+		li.appendChild(state);
+
+		list.appendChild(li);
+	}
+}
+
+// Skicka alla tider som har startnummer men inte sparats än
+async function sync() {
+	if (syncing) {
+		return;
+	}
+	syncing = true;
+	try {
+		for (const entry of entries) {
+			if (entry.state !== "pending") {
+				continue;
+			}
+			entry.state = "sending";
+			render();
+			try {
+				const response = await fetch(api + "/manual-times", {
+					method: "POST",
+					headers: { "Content-Type": "application/json", "Authorization": "Bearer " + token },
+					body: JSON.stringify({ id: entry.id, chip: entry.chip, time: wallClock(entry.time), user: "mål" }),
+				});
+				if (response.ok) {
+					entry.state = "saved";
+				} else if (response.status === 401) {
+					entry.state = "pending";
+					document.getElementById("token").hidden = false;
+					setConnection("API-nyckeln saknas eller är fel", true);
+					break;
+				} else {
+					const data = await response.json().catch(() => ({}));
+					entry.state = "error";
+					entry.message = data.error || ("Fel " + response.status);
+				}
+				setConnection("Ansluten", false);
+			} catch (err) {
+				entry.state = "pending";
+				setConnection("Ingen kontakt, tiderna sparas i telefonen och skickas senare", true);
+				break;
+			} finally {
+				save();
+				render();
+			}
+		}
+	} finally {
+		syncing = false;
+	}
+}
+
+document.getElementById("finish").onclick = () => {
+	const entry = { id: newID(), time: Date.now() + clockOffset, chip: "", state: "waiting", message: "" };
+	entries.unshift(entry);
+	save();
+	render();
+	if (navigator.vibrate) {
+		navigator.vibrate(50);
+	}
+	const input = document.querySelector("#queue input");
+	if (input) {
+		input.focus();
+	}
+};
+
+document.getElementById("tokenSave").onclick = () => {
+	token = document.getElementById("tokenInput").value.trim();
+	localStorage.setItem("finish-token", token);
+	document.getElementById("token").hidden = true;
+	sync();
+};
+
+setInterval(() => {
+	const now = Date.now() + clockOffset;
+	document.getElementById("clock").textContent = new Date(now).toISOString().slice(11, 19) + " · " + elapsed(now);
+}, 200);
+
+if (!token) {
+	document.getElementById("token").hidden = false;
+}
+window.addEventListener("online", sync);
+syncClock().then(() => setConnection("Ansluten", false));
+loadParticipants();
+render();
+sync();
+setInterval(sync, syncInterval);
+setInterval(syncClock, clockInterval);
+</script>
+</body>
+</html>
+`))
+
+// Tidtagningens klocka, så att telefoner kan räkna om sina tider till läsarens väggklocka
+func (s *timingServer) handleClock(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, http.StatusOK, map[string]time.Time{
+		"wallClock": startTimeFromClock(time.Now()),
+	})
+}
+
+// Lista över lopp där tider kan registreras från mållinjen
+func (s *timingServer) handleFinishIndexPage(w http.ResponseWriter, r *http.Request) {
+	type raceLink struct {
+		ID     string
+		Name   string
+		Status string
+	}
+
+	var links []raceLink
+	for _, race := range s.getRaces() {
+		if !raceResultsEditable(race) || raceStatus(race) == RaceStatusPlanned {
+			continue
+		}
+		links = append(links, raceLink{ID: race.ID, Name: race.Name, Status: raceStatusLabel(raceStatus(race))})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := finishIndexTemplate.Execute(w, map[string]interface{}{
+		"Event": workspaceName(),
+		"Style": template.CSS(webPageStyle),
+		"Races": links,
+		"Token": r.URL.Query().Get("token"),
+	}); err != nil {
+		getLogger().Log("Kunde inte visa målregistreringen: %v", err)
+	}
+}
+
+// Sida för att registrera måltider från en telefon. Tiderna köas i telefonen och skickas
+// som manuella tider när det finns kontakt med tidtagningen.
+func (s *timingServer) handleFinishEntryPage(w http.ResponseWriter, r *http.Request) {
+	race, exists := s.getRace(r.PathValue("id"))
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := finishEntryTemplate.Execute(w, map[string]interface{}{
+		"Event":         workspaceName(),
+		"Style":         template.CSS(webPageStyle),
+		"ID":            race.ID,
+		"Name":          race.Name,
+		"StartTime":     race.StartTime.Format(time.RFC3339Nano),
+		"SyncInterval":  finishEntrySyncInterval,
+		"ClockInterval": finishEntryClockInterval,
+	}); err != nil {
+		getLogger().Log("Kunde inte visa målregistreringen för %s: %v", race.Name, err)
+	}
+}
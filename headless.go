@@ -0,0 +1,29 @@
+//go:build headless
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Bygge utan grafiskt gränssnitt och utan fyne (go build -tags headless), för datorer
+// utan skärm. Bara kommandona på kommandoraden finns, till exempel serve.
+func main() {
+	workspaceFlag := flag.String("workspace", "", "mapp för evenemanget som ska öppnas direkt, kommandon använder annars det senast öppnade")
+	flag.Usage = func() {
+		printUsage(os.Stderr)
+	}
+	flag.Parse()
+
+	// Initiera logger
+	appLogger = getLogger()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Programmet är byggt utan grafiskt gränssnitt, ange ett kommando")
+		printUsage(os.Stderr)
+		os.Exit(2)
+	}
+	os.Exit(runCLI(*workspaceFlag, flag.Args(), os.Stdout, os.Stderr))
+}
@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/jimmitjoo/hogby-tidtagning/internal/timeformat"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
@@ -169,23 +170,10 @@ func (s *SheetsService) ExportResults(spreadsheetId, sheetName string, results [
 			continue
 		}
 
-		// Formatera tiden
-		duration := result.Duration
-		timeStr := ""
-		if duration.Hours() >= 1 {
-			timeStr = fmt.Sprintf("%02d:%02d:%02d",
-				int(duration.Hours()),
-				int(duration.Minutes())%60,
-				int(duration.Seconds())%60)
-		} else {
-			timeStr = fmt.Sprintf("%02d:%02d",
-				int(duration.Minutes()),
-				int(duration.Seconds())%60)
-		}
-
+		// Formatera tiden, lopp över ett dygn visas med fler än 24 timmar
 		values = append(values, []interface{}{
 			result.Chip,
-			timeStr,
+			timeformat.Duration(result.Duration),
 		})
 	}
 
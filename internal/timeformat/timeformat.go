@@ -0,0 +1,56 @@
+package timeformat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration formaterar en tid som MM:SS eller HH:MM:SS, där timmarna kan vara fler än 24
+func Duration(d time.Duration) string {
+	if d < 0 {
+		return "-" + Duration(-d)
+	}
+
+	totalSeconds := int64(d / time.Second)
+	hours := totalSeconds / 3600
+	minutes := (totalSeconds / 60) % 60
+	seconds := totalSeconds % 60
+
+	if hours > 0 {
+		return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, seconds)
+	}
+	return fmt.Sprintf("%02d:%02d", minutes, seconds)
+}
+
+// ParseElapsed tolkar en löptid som HH:MM:SS eller MM:SS, där timmarna kan vara fler än 24
+func ParseElapsed(text string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(text), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("ogiltig tid %q, använd format HH:MM:SS", text)
+	}
+
+	values := make([]int, len(parts))
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("ogiltig tid %q", text)
+		}
+		values[i] = value
+	}
+
+	// Minuter och sekunder får inte slå över, bara timmarna
+	for _, value := range values[1:] {
+		if value >= 60 {
+			return 0, fmt.Errorf("ogiltig tid %q", text)
+		}
+	}
+
+	if len(values) == 2 {
+		return time.Duration(values[0])*time.Minute + time.Duration(values[1])*time.Second, nil
+	}
+	return time.Duration(values[0])*time.Hour +
+		time.Duration(values[1])*time.Minute +
+		time.Duration(values[2])*time.Second, nil
+}
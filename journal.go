@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Typer av händelser i journalen
+const (
+	journalSnapshot     = "snapshot"
+	journalInvalidate   = "invalidate"
+	journalValidate     = "validate"
+	journalManualAdd    = "manual_add"
+	journalManualEdit   = "manual_edit"
+	journalManualDelete = "manual_delete"
+	journalUndo         = "undo"
+	journalRedo         = "redo"
+)
+
+// Journalen skrivs från både gränssnittet och filövervakningen
+var journalMu sync.Mutex
+
+type JournalSnapshot struct {
+	InvalidTimes map[string]bool     `json:"invalidTimes"`
+	ManualTimes  []ManualTime        `json:"manualTimes"`
+	ManualKeys   map[string][]string `json:"manualKeys,omitempty"`
+}
+
+type JournalEntry struct {
+	Seq      int              `json:"seq"`
+	Time     time.Time        `json:"time"`
+	User     string           `json:"user"`
+	Type     string           `json:"type"`
+	Chip     string           `json:"chip,omitempty"`
+	ReadTime *time.Time       `json:"readTime,omitempty"`
+	Manual   *ManualTime      `json:"manual,omitempty"`
+	Keys     []string         `json:"keys,omitempty"`
+	Target   int              `json:"target,omitempty"`
+	Snapshot *JournalSnapshot `json:"snapshot,omitempty"`
+}
+
+// Tillståndet som fås genom att spela upp journalen
+type JournalState struct {
+	InvalidTimes map[string]bool
+	ManualTimes  []ManualTime
+	UndoStack    []JournalEntry
+	RedoStack    []JournalEntry
+	Undone       map[int]bool
+	// Tider som markerades ogiltiga när en manuell tid lades till, per manuell tid
+	ManualKeys map[string][]string
+}
+
+// Filnamn för loppets journal
+func journalFilename(raceID string) string {
+	return dataPath(fmt.Sprintf("journal_%s.jsonl", raceID))
+}
+
+// Namnet på den som gör ändringen, sparas i journalen
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		return hostname
+	}
+	return "okänd"
+}
+
+// Läs alla händelser i loppets journal
+func loadJournal(raceID string) ([]JournalEntry, error) {
+	file, err := os.Open(journalFilename(raceID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []JournalEntry{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// En avbruten sista rad efter en krasch hoppas över, allt före den är intakt
+			getLogger().Log("Hoppar över trasig rad %d i journalen för %s: %v", lineNumber, raceID, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Lägg till en händelse sist i journalen och synka till disk
+func appendJournalEntry(raceID string, entry JournalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(journalFilename(raceID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("kunde inte öppna journal: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("kunde inte skriva till journal: %v", err)
+	}
+	return file.Sync()
+}
+
+// Spela upp journalen och räkna fram felmarkeringar, manuella tider och ångra-historik
+func replayJournal(entries []JournalEntry) JournalState {
+	state := JournalState{
+		InvalidTimes: make(map[string]bool),
+		Undone:       make(map[int]bool),
+		ManualKeys:   make(map[string][]string),
+	}
+
+	// Ta först reda på vilka beslut som är aktiva efter alla ångra och gör om
+	active := make(map[int]bool)
+	var decisions []JournalEntry
+	for _, entry := range entries {
+		switch entry.Type {
+		case journalSnapshot:
+			if entry.Snapshot != nil {
+				state.InvalidTimes = make(map[string]bool)
+				for key, invalid := range entry.Snapshot.InvalidTimes {
+					if invalid {
+						state.InvalidTimes[key] = true
+					}
+				}
+				state.ManualTimes = append([]ManualTime{}, entry.Snapshot.ManualTimes...)
+				ensureManualTimeIDs(state.ManualTimes)
+				state.ManualKeys = make(map[string][]string)
+				for id, keys := range entry.Snapshot.ManualKeys {
+					state.ManualKeys[id] = keys
+				}
+			}
+		case journalUndo:
+			active[entry.Target] = false
+			if n := len(state.UndoStack); n > 0 && state.UndoStack[n-1].Seq == entry.Target {
+				state.RedoStack = append(state.RedoStack, state.UndoStack[n-1])
+				state.UndoStack = state.UndoStack[:n-1]
+			}
+		case journalRedo:
+			active[entry.Target] = true
+			if n := len(state.RedoStack); n > 0 && state.RedoStack[n-1].Seq == entry.Target {
+				state.UndoStack = append(state.UndoStack, state.RedoStack[n-1])
+				state.RedoStack = state.RedoStack[:n-1]
+			}
+		default:
+			active[entry.Seq] = true
+			decisions = append(decisions, entry)
+			state.UndoStack = append(state.UndoStack, entry)
+			state.RedoStack = nil
+		}
+	}
+
+	// Tillämpa de aktiva besluten i ordning
+	for _, entry := range decisions {
+		if !active[entry.Seq] {
+			state.Undone[entry.Seq] = true
+			continue
+		}
+		switch entry.Type {
+		case journalInvalidate:
+			if entry.ReadTime != nil {
+				state.InvalidTimes[makeInvalidTimeKey(entry.Chip, *entry.ReadTime)] = true
+			}
+		case journalValidate:
+			if entry.ReadTime != nil {
+				delete(state.InvalidTimes, makeInvalidTimeKey(entry.Chip, *entry.ReadTime))
+			}
+		case journalManualAdd:
+			if entry.Manual != nil {
+				state.ManualTimes = append(state.ManualTimes, *entry.Manual)
+				state.ManualKeys[entry.Manual.ID] = entry.Keys
+			}
+			for _, key := range entry.Keys {
+				state.InvalidTimes[key] = true
+			}
+		case journalManualEdit, journalManualDelete:
+			if entry.Manual == nil {
+				continue
+			}
+			// Tiderna som den manuella tiden ersatte blir giltiga igen
+			for _, key := range state.ManualKeys[entry.Manual.ID] {
+				delete(state.InvalidTimes, key)
+			}
+			delete(state.ManualKeys, entry.Manual.ID)
+
+			var kept []ManualTime
+			for _, mt := range state.ManualTimes {
+				if mt.ID != entry.Manual.ID {
+					kept = append(kept, mt)
+				}
+			}
+			state.ManualTimes = kept
+
+			if entry.Type == journalManualEdit {
+				state.ManualTimes = append(state.ManualTimes, *entry.Manual)
+				state.ManualKeys[entry.Manual.ID] = entry.Keys
+				for _, key := range entry.Keys {
+					state.InvalidTimes[key] = true
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(state.ManualTimes, func(i, j int) bool {
+		return state.ManualTimes[i].Time.Before(state.ManualTimes[j].Time)
+	})
+
+	return state
+}
+
+// Skriv en händelse i journalen och uppdatera loppets felmarkeringar och manuella tider
+// utifrån den uppspelade journalen. Anroparen sparar races.json.
+func recordJournalEntry(race *Race, entry JournalEntry) (JournalEntry, error) {
+	return appendJournalDecision(race, func(JournalState) (JournalEntry, error) {
+		return entry, nil
+	})
+}
+
+// Som recordJournalEntry, men händelsen väljs av decide utifrån journalen som den ser ut
+// under journalMu, så att två samtidiga ångra inte ångrar samma beslut.
+func appendJournalDecision(race *Race, decide func(state JournalState) (JournalEntry, error)) (JournalEntry, error) {
+	if !raceResultsEditable(*race) {
+		return JournalEntry{}, raceLockedError(*race)
+	}
+
+	journalMu.Lock()
+	defer journalMu.Unlock()
+
+	entries, err := loadJournal(race.ID)
+	if err != nil {
+		return JournalEntry{}, err
+	}
+	entry, err := decide(replayJournal(entries))
+	if err != nil {
+		return entry, err
+	}
+
+	// Första gången sparas läget som det såg ut innan journalen fanns
+	if len(entries) == 0 {
+		manualTimes, err := loadManualTimes(race.ID)
+		if err != nil {
+			return entry, err
+		}
+		ensureManualTimeIDs(manualTimes)
+		invalidTimes := make(map[string]bool, len(race.InvalidTimes))
+		for key, invalid := range race.InvalidTimes {
+			if invalid {
+				invalidTimes[key] = true
+			}
+		}
+		snapshot := JournalEntry{
+			Seq:  1,
+			Time: time.Now(),
+			User: currentUser(),
+			Type: journalSnapshot,
+			Snapshot: &JournalSnapshot{
+				InvalidTimes: invalidTimes,
+				ManualTimes:  manualTimes,
+				ManualKeys:   preJournalManualKeys(invalidTimes, manualTimes),
+			},
+		}
+		if err := appendJournalEntry(race.ID, snapshot); err != nil {
+			return entry, err
+		}
+		entries = append(entries, snapshot)
+	}
+
+	entry.Seq = entries[len(entries)-1].Seq + 1
+	entry.Time = time.Now()
+	if entry.User == "" {
+		entry.User = currentUser()
+	}
+	if err := appendJournalEntry(race.ID, entry); err != nil {
+		return entry, err
+	}
+	entries = append(entries, entry)
+
+	getLogger().Log("Journal %s: %s", race.Name, describeJournalEntry(entry))
+	return entry, applyJournalState(race, replayJournal(entries))
+}
+
+// Tider som manuella tider från innan journalen fanns har ersatt. En ny manuell tid
+// markerade alla chipets tidigare tider som ogiltiga, så chipets felmarkeringar hör till
+// dess senaste manuella tid. Tider som markerats felaktiga för hand går inte att skilja ut.
+func preJournalManualKeys(invalidTimes map[string]bool, manualTimes []ManualTime) map[string][]string {
+	latest := make(map[string]ManualTime)
+	for _, mt := range manualTimes {
+		if current, exists := latest[mt.Chip]; !exists || !mt.Time.Before(current.Time) {
+			latest[mt.Chip] = mt
+		}
+	}
+
+	manualKeys := make(map[string][]string)
+	for key := range invalidTimes {
+		sep := strings.LastIndex(key, ":")
+		if sep < 0 {
+			continue
+		}
+		mt, exists := latest[key[:sep]]
+		if !exists || key == makeInvalidTimeKey(mt.Chip, mt.Time) {
+			continue
+		}
+		manualKeys[mt.ID] = append(manualKeys[mt.ID], key)
+	}
+	for _, keys := range manualKeys {
+		sort.Strings(keys)
+	}
+	return manualKeys
+}
+
+// För över det uppspelade tillståndet till loppet och filen med manuella tider
+func applyJournalState(race *Race, state JournalState) error {
+	// En ny map, den gamla kan läsas samtidigt av kopior av loppet
+	invalidTimes := make(map[string]bool, len(state.InvalidTimes))
+	for key := range state.InvalidTimes {
+		invalidTimes[key] = true
+	}
+	race.InvalidTimes = invalidTimes
+
+	return saveManualTimes(race.ID, state.ManualTimes)
+}
+
+// Läs journalen och spela upp den, ett lopp utan journal har inga beslut att ångra
+func loadJournalState(raceID string) (JournalState, error) {
+	entries, err := loadJournal(raceID)
+	if err != nil {
+		return JournalState{}, err
+	}
+	return replayJournal(entries), nil
+}
+
+// Ångra det senaste beslutet som inte redan ångrats
+func undoJournal(race *Race) (JournalEntry, error) {
+	var target JournalEntry
+	_, err := appendJournalDecision(race, func(state JournalState) (JournalEntry, error) {
+		if len(state.UndoStack) == 0 {
+			return JournalEntry{}, fmt.Errorf("det finns inget att ångra")
+		}
+		target = state.UndoStack[len(state.UndoStack)-1]
+		return JournalEntry{Type: journalUndo, Target: target.Seq}, nil
+	})
+	return target, err
+}
+
+// Gör om det senast ångrade beslutet
+func redoJournal(race *Race) (JournalEntry, error) {
+	var target JournalEntry
+	_, err := appendJournalDecision(race, func(state JournalState) (JournalEntry, error) {
+		if len(state.RedoStack) == 0 {
+			return JournalEntry{}, fmt.Errorf("det finns inget att göra om")
+		}
+		target = state.RedoStack[len(state.RedoStack)-1]
+		return JournalEntry{Type: journalRedo, Target: target.Seq}, nil
+	})
+	return target, err
+}
+
+// Beskriv en händelse i klartext för historik och logg
+func describeJournalEntry(entry JournalEntry) string {
+	switch entry.Type {
+	case journalSnapshot:
+		return "Utgångsläge sparat"
+	case journalInvalidate:
+		if entry.ReadTime != nil {
+			return fmt.Sprintf("Markerade tid %s för %s som felaktig", entry.ReadTime.Format("15:04:05"), entry.Chip)
+		}
+		return fmt.Sprintf("Markerade tid för %s som felaktig", entry.Chip)
+	case journalValidate:
+		if entry.ReadTime != nil {
+			return fmt.Sprintf("Markerade tid %s för %s som giltig", entry.ReadTime.Format("15:04:05"), entry.Chip)
+		}
+		return fmt.Sprintf("Markerade tid för %s som giltig", entry.Chip)
+	case journalManualAdd:
+		if entry.Manual != nil {
+			return fmt.Sprintf("Lade till manuell tid %s för %s", entry.Manual.Time.Format("15:04:05"), entry.Manual.Chip)
+		}
+		return "Lade till manuell tid"
+	case journalManualEdit:
+		if entry.Manual != nil {
+			return fmt.Sprintf("Ändrade manuell tid till %s för %s", entry.Manual.Time.Format("15:04:05"), entry.Manual.Chip)
+		}
+		return "Ändrade manuell tid"
+	case journalManualDelete:
+		if entry.Manual != nil {
+			return fmt.Sprintf("Tog bort manuell tid %s för %s", entry.Manual.Time.Format("15:04:05"), entry.Manual.Chip)
+		}
+		return "Tog bort manuell tid"
+	case journalUndo:
+		return fmt.Sprintf("Ångrade händelse %d", entry.Target)
+	case journalRedo:
+		return fmt.Sprintf("Gjorde om händelse %d", entry.Target)
+	}
+	return entry.Type
+}
@@ -0,0 +1,47 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Visa loppets journal med vem som gjorde vad och när, senaste först
+func showJournalHistory(race Race, window fyne.Window) {
+	entries, err := loadJournal(race.ID)
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("kunde inte läsa journal: %v", err), window)
+		return
+	}
+
+	undone := replayJournal(entries).Undone
+
+	if len(entries) == 0 {
+		dialog.ShowInformation("Historik", "Inga ändringar har gjorts i loppet än", window)
+		return
+	}
+
+	list := widget.NewList(
+		func() int {
+			return len(entries)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			entry := entries[len(entries)-1-id]
+			text := fmt.Sprintf("%d. %s  %s  %s", entry.Seq, entry.Time.Format("15:04:05"), entry.User, describeJournalEntry(entry))
+			if undone[entry.Seq] {
+				text += " (ångrad)"
+			}
+			obj.(*widget.Label).SetText(text)
+		})
+
+	d := dialog.NewCustom(fmt.Sprintf("Historik - %s", race.Name), "Stäng", list, window)
+	d.Resize(fyne.NewSize(700, 600))
+	d.Show()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournalInvalidateReplacesInvalidTimes(t *testing.T) {
+	useTestWorkspace(t)
+
+	race := testRace("")
+	previous := race.InvalidTimes
+
+	readTime := race.StartTime.Add(40 * time.Minute)
+	if _, err := recordJournalEntry(&race, JournalEntry{Type: journalInvalidate, Chip: "1", ReadTime: &readTime}); err != nil {
+		t.Fatal(err)
+	}
+	if !race.InvalidTimes[makeInvalidTimeKey("1", readTime)] {
+		t.Errorf("tiden markerades inte som felaktig: %v", race.InvalidTimes)
+	}
+	if len(previous) != 0 {
+		t.Errorf("den tidigare mapen ändrades: %v", previous)
+	}
+
+	if _, err := recordJournalEntry(&race, newManualTimeEntry(race, "1", readTime.Add(time.Minute), "")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(journalFilename(race.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if strings.Contains(line, `"type":"manual_add"`) && strings.Contains(line, "readTime") {
+			t.Errorf("manuell tid sparades med lästid: %s", line)
+		}
+	}
+}
+
+func TestDeletingPreJournalManualTimeRestoresReads(t *testing.T) {
+	useTestWorkspace(t)
+
+	race := testRace("")
+	start := race.StartTime
+	readTime := start.Add(40 * time.Minute)
+	race.InvalidTimes[makeInvalidTimeKey("1", readTime)] = true
+	manual := ManualTime{ID: "m1", RaceID: race.ID, Chip: "1", Time: start.Add(42 * time.Minute)}
+	if err := saveManualTimes(race.ID, []ManualTime{manual}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := recordJournalEntry(&race, JournalEntry{Type: journalManualDelete, Chip: "1", Manual: &manual}); err != nil {
+		t.Fatal(err)
+	}
+	if len(race.InvalidTimes) != 0 {
+		t.Errorf("läsningen som den manuella tiden ersatte är fortfarande ogiltig: %v", race.InvalidTimes)
+	}
+}
+
+func TestConcurrentUndoTargetsDifferentDecisions(t *testing.T) {
+	useTestWorkspace(t)
+
+	race := testRace("")
+	for i := 0; i < 2; i++ {
+		readTime := race.StartTime.Add(time.Duration(40+i) * time.Minute)
+		if _, err := recordJournalEntry(&race, JournalEntry{Type: journalInvalidate, Chip: "1", ReadTime: &readTime}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	targets := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		copied := race
+		go func() {
+			target, err := undoJournal(&copied)
+			if err != nil {
+				t.Error(err)
+			}
+			targets <- target.Seq
+		}()
+	}
+	if first, second := <-targets, <-targets; first == second {
+		t.Errorf("båda ångra valde händelse %d", first)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Ett lopps status, från planerat till arkiverat
+const (
+	RaceStatusPlanned     = "planned"
+	RaceStatusStarted     = "started"
+	RaceStatusFinished    = "finished"
+	RaceStatusProvisional = "provisional"
+	RaceStatusOfficial    = "official"
+	RaceStatusArchived    = "archived"
+)
+
+// Tillåtna övergångar från varje status
+var raceStatusTransitions = map[string][]string{
+	RaceStatusPlanned:     {RaceStatusStarted, RaceStatusArchived},
+	RaceStatusStarted:     {RaceStatusFinished, RaceStatusPlanned},
+	RaceStatusFinished:    {RaceStatusProvisional, RaceStatusStarted},
+	RaceStatusProvisional: {RaceStatusOfficial, RaceStatusFinished},
+	RaceStatusOfficial:    {RaceStatusArchived, RaceStatusProvisional},
+	RaceStatusArchived:    {RaceStatusFinished},
+}
+
+// Statusens namn i klartext
+func raceStatusLabel(status string) string {
+	switch status {
+	case RaceStatusPlanned:
+		return "Planerat"
+	case RaceStatusStarted:
+		return "Pågår"
+	case RaceStatusFinished:
+		return "Avslutat"
+	case RaceStatusProvisional:
+		return "Preliminära resultat"
+	case RaceStatusOfficial:
+		return "Officiella resultat"
+	case RaceStatusArchived:
+		return "Arkiverat"
+	}
+	return status
+}
+
+// Text på knappen som byter till en viss status
+func raceTransitionLabel(from, to string) string {
+	switch {
+	case from == RaceStatusOfficial && to == RaceStatusProvisional:
+		return "Öppna igen"
+	case from == RaceStatusArchived:
+		return "Återställ från arkiv"
+	case from == RaceStatusStarted && to == RaceStatusPlanned:
+		return "Avbryt start"
+	case from == RaceStatusFinished && to == RaceStatusStarted:
+		return "Återuppta"
+	case from == RaceStatusProvisional && to == RaceStatusFinished:
+		return "Dra tillbaka preliminära"
+	}
+
+	switch to {
+	case RaceStatusStarted:
+		return "Starta tidtagning"
+	case RaceStatusFinished:
+		return "Avsluta tidtagning"
+	case RaceStatusProvisional:
+		return "Publicera preliminära resultat"
+	case RaceStatusOfficial:
+		return "Fastställ resultat"
+	case RaceStatusArchived:
+		return "Arkivera"
+	}
+	return raceStatusLabel(to)
+}
+
+// Loppets status, lopp som sparats utan status räknas som planerade
+func raceStatus(race Race) string {
+	if race.Status == "" {
+		return RaceStatusPlanned
+	}
+	return race.Status
+}
+
+// Kontrollera om loppet får byta till en viss status
+func canTransitionRace(race Race, to string) bool {
+	for _, allowed := range raceStatusTransitions[raceStatus(race)] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Officiella och arkiverade resultat är låsta tills loppet öppnas igen
+func raceResultsEditable(race Race) bool {
+	status := raceStatus(race)
+	return status != RaceStatusOfficial && status != RaceStatusArchived
+}
+
+// Fel som visas när någon försöker ändra ett låst lopp
+func raceLockedError(race Race) error {
+	return fmt.Errorf("%s har status %s och kan inte ändras, öppna loppet igen först",
+		race.Name, raceStatusLabel(raceStatus(race)))
+}
+
+// Läsarfilen övervakas bara medan loppet pågår
+func raceCanWatch(race Race) bool {
+	return raceStatus(race) == RaceStatusStarted
+}
+
+// Fel som visas när någon försöker starta övervakningen av ett lopp som inte pågår
+func raceNotWatchableError(race Race) error {
+	return fmt.Errorf("%s har status %s, läsarfilen kan bara övervakas medan loppet pågår",
+		race.Name, raceStatusLabel(raceStatus(race)))
+}
+
+// Starten kan bara registreras innan loppet har avslutats
+func raceCanStart(race Race) bool {
+	status := raceStatus(race)
+	return status == RaceStatusPlanned || status == RaceStatusStarted
+}
+
+// Status för lopp sparade innan status fanns: pågående om filen övervakas,
+// planerat om starten ligger i framtiden och annars avslutat
+func inferRaceStatus(liveUpdate bool, startTime time.Time, now time.Time) string {
+	if liveUpdate {
+		return RaceStatusStarted
+	}
+	if startTime.After(now) {
+		return RaceStatusPlanned
+	}
+	return RaceStatusFinished
+}
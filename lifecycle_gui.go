@@ -0,0 +1,76 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Byt status på loppet och starta eller stoppa filövervakningen därefter
+func setRaceStatus(race *Race, races []Race, index int, to string, updateUI func(), appState *AppState) error {
+	from := raceStatus(*race)
+	if err := checkRaceEditable(*race, appState); err != nil {
+		return err
+	}
+	if !canTransitionRace(*race, to) {
+		return fmt.Errorf("%s kan inte gå från %s till %s", race.Name, raceStatusLabel(from), raceStatusLabel(to))
+	}
+
+	race.Status = to
+	races[index] = *race
+	if err := saveRace(*race); err != nil {
+		return err
+	}
+	getLogger().Log("Lopp %s bytte status från %s till %s", race.Name, from, to)
+
+	// Läsarfilen övervakas bara medan loppet pågår
+	shouldWatch := to == RaceStatusStarted && race.ResultsFile != ""
+	if shouldWatch != race.LiveUpdate {
+		return toggleLiveUpdate(race, races, index, updateUI, appState)
+	}
+	updateUI()
+	return nil
+}
+
+// Visa knappar för de statusbyten som är tillåtna från loppets nuvarande status
+func raceStatusButtons(race Race, races []Race, index int, window fyne.Window, updateUI func(), appState *AppState) *fyne.Container {
+	buttons := container.NewHBox()
+
+	for _, to := range raceStatusTransitions[raceStatus(race)] {
+		to := to
+		from := raceStatus(race)
+
+		change := func() {
+			if err := setRaceStatus(&race, races, index, to, updateUI, appState); err != nil {
+				dialog.ShowError(err, window)
+			}
+		}
+
+		button := widget.NewButton(raceTransitionLabel(from, to), func() {
+			// Att låsa upp eller lämna officiella resultat kräver en bekräftelse
+			if from == RaceStatusOfficial || from == RaceStatusArchived || to == RaceStatusOfficial {
+				dialog.ShowConfirm(raceTransitionLabel(from, to),
+					fmt.Sprintf("Vill du ändra status för %s från %s till %s?",
+						race.Name, raceStatusLabel(from), raceStatusLabel(to)),
+					func(ok bool) {
+						if ok {
+							change()
+						}
+					}, window)
+				return
+			}
+			change()
+		})
+		if to == RaceStatusStarted || to == RaceStatusOfficial {
+			button.Importance = widget.HighImportance
+		}
+		buttons.Add(button)
+	}
+
+	return buttons
+}
@@ -4,11 +4,18 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"sync"
 )
 
 func initLogger() (*Logger, error) {
-	file, err := os.OpenFile("tidtagning.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	// Innan ett evenemang är valt loggas till programmets konfigurationsmapp
+	logFile := "tidtagning.log"
+	if configDir, err := appConfigDir(); err == nil {
+		logFile = filepath.Join(configDir, "tidtagning.log")
+	}
+
+	file, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return nil, fmt.Errorf("kunde inte öppna loggfil: %v", err)
 	}
@@ -42,3 +49,23 @@ func (l *Logger) Log(format string, v ...interface{}) {
 
 	l.logger.Printf(format, v...)
 }
+
+// Byt loggfil, används när ett evenemang öppnas så att loggen hamnar i evenemangets mapp
+func (l *Logger) SetFile(filename string) error {
+	if l == nil {
+		return nil
+	}
+
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("kunde inte öppna loggfil: %v", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.file.Close()
+	l.file = file
+	l.logger.SetOutput(file)
+	return nil
+}
@@ -1,10 +1,14 @@
+//go:build !headless
+
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
-	"strconv"
+	"os"
 	"strings"
-	"time"
+	"sync"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -15,13 +19,18 @@ import (
 )
 
 func main() {
+	workspaceFlag := flag.String("workspace", "", "mapp för evenemanget som ska öppnas direkt, kommandon använder annars det senast öppnade")
+	flag.Usage = func() {
+		printUsage(os.Stderr)
+	}
+	flag.Parse()
+
 	// Initiera logger
 	appLogger = getLogger()
 
-	// Initiera tom datastruktur om filen inte finns
-	if err := initializeEmptyDataIfNeeded(); err != nil {
-		appLogger.Log("Fel vid initiering av data: %v", err)
-		return
+	// Kommandon på kommandoraden körs utan grafiskt gränssnitt
+	if flag.NArg() > 0 {
+		os.Exit(runCLI(*workspaceFlag, flag.Args(), os.Stdout, os.Stderr))
 	}
 
 	myApp := app.NewWithID("se.tidtagning.app")
@@ -30,28 +39,76 @@ func main() {
 	// Skapa AppState
 	appState := NewAppState()
 
-	// Ladda sparade lopp vid start
-	races, err := loadRaces()
-	if err != nil {
-		dialog.ShowError(err, window)
+	// Visa loppen i evenemanget, och val av evenemang igen om användaren byter
+	var showEvent func()
+	showEvent = func() {
+		showRaceOverview(myApp, window, appState, func() {
+			appState.CloseAll()
+			showWorkspaceChooser(window, showEvent)
+		})
+	}
+
+	if *workspaceFlag != "" {
+		if err := openWorkspace(*workspaceFlag); err != nil {
+			appLogger.Log("Kunde inte öppna evenemang %s: %v", *workspaceFlag, err)
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		showEvent()
+	} else {
+		showWorkspaceChooser(window, showEvent)
+	}
+
+	window.Resize(fyne.NewSize(1536, 864))
+	window.CenterOnScreen()
+
+	window.ShowAndRun()
+}
+
+// Visa alla lopp i det öppna evenemanget i huvudfönstret
+func showRaceOverview(myApp fyne.App, window fyne.Window, appState *AppState, onSwitchEvent func()) {
+	window.SetTitle(fmt.Sprintf("Tidtagning - %s", workspaceName()))
+
+	// Ladda sparade lopp vid start. Listan byts ut när ett lopp ändras via API:et,
+	// som körs i en egen tråd, så variabeln läses och skrivs under racesMu.
+	races, loadErr := loadRaces()
+	var racesMu sync.Mutex
+	currentRaces := func() []Race {
+		racesMu.Lock()
+		defer racesMu.Unlock()
+		return races
 	}
 
 	raceContainer := container.NewVBox()
 
+	// Arkiverade lopp visas bara på begäran
+	showArchived := widget.NewCheck("Visa arkiverade lopp", nil)
+
 	// Deklarera updateRaceList först
 	var updateRaceList func()
 
 	// Sedan definiera den
 	updateRaceList = func() {
+		// Listan visar alltid det som är sparat, även ändringar från andra fönster och API:et
+		if loaded, err := loadRaces(); err == nil {
+			racesMu.Lock()
+			races = loaded
+			racesMu.Unlock()
+		}
+
 		// Rensa alla objekt från containern
 		raceContainer.RemoveAll()
 
 		// Skapa nya objekt för varje lopp
-		for i := range races {
-			i := i           // Skapa en ny variabel för varje iteration
-			race := races[i] // Skapa en kopia av race för denna iteration
+		current := currentRaces()
+		for i := range current {
+			i := i             // Skapa en ny variabel för varje iteration
+			race := current[i] // Skapa en kopia av race för denna iteration
+			if raceStatus(race) == RaceStatusArchived && !showArchived.Checked {
+				continue
+			}
 
-			raceBox := makeRaceListItem(race, races, i, myApp, updateRaceList, appState)
+			raceBox := makeRaceListItem(race, current, i, myApp, updateRaceList, appState)
 			raceContainer.Add(raceBox)
 		}
 
@@ -61,94 +118,207 @@ func main() {
 
 	// Anropa updateRaceList direkt efter att vi har laddat loppen
 	updateRaceList()
+	showArchived.OnChanged = func(bool) {
+		updateRaceList()
+	}
+
+	// Erbjud återställning från senaste fungerande kopia om races.json är skadad
+	var corruptErr *corruptFileError
+	if errors.As(loadErr, &corruptErr) {
+		dialog.ShowConfirm("Skadad fil",
+			fmt.Sprintf("%v\n\nVill du återställa loppen från senaste fungerande kopia?", loadErr),
+			func(ok bool) {
+				if !ok {
+					return
+				}
+				backup, err := restoreLatestBackup(racesFilename(), validateRacesData)
+				if err != nil {
+					dialog.ShowError(err, window)
+					return
+				}
+				restored, err := loadRaces()
+				if err != nil {
+					dialog.ShowError(err, window)
+					return
+				}
+				racesMu.Lock()
+				races = restored
+				racesMu.Unlock()
+				updateRaceList()
+				dialog.ShowInformation("Återställt", fmt.Sprintf("Loppen återställdes från %s", backup), window)
+			}, window)
+	} else if loadErr != nil {
+		dialog.ShowError(loadErr, window)
+	}
+
+	// Varningar för tysta läsare visas överst i huvudfönstret
+	alarmContainer := container.NewVBox()
+	updateReaderAlarms := func() {
+		current := currentRaces()
+		alarmContainer.Objects = makeReaderAlarms(current, appState)
+		alarmContainer.Refresh()
+		appState.RefreshReaderHealth(current)
+	}
+
+	// Övervakningen läser loppen från sin egen tråd och får därför en kopia
+	stopReaderMonitor := startReaderMonitor(func() []Race {
+		racesMu.Lock()
+		defer racesMu.Unlock()
+		return append([]Race{}, races...)
+	}, appState.WatchState, updateReaderAlarms)
 
 	addRace := func() {
-		nameEntry := widget.NewEntry()
-		nameEntry.SetPlaceHolder("Loppets namn (t.ex. '10km')")
-		nameEntry.Resize(fyne.NewSize(300, 40))
-
-		dateEntry := widget.NewEntry()
-		dateEntry.SetPlaceHolder("Datum (YYYY-MM-DD)")
-		dateEntry.Text = time.Now().Format("2006-01-02")
-		dateEntry.Resize(fyne.NewSize(300, 40))
-
-		timeEntry := widget.NewEntry()
-		timeEntry.SetPlaceHolder("Starttid (HH:MM)")
-		timeEntry.Resize(fyne.NewSize(300, 40))
-
-		minTimeEntry := widget.NewEntry()
-		minTimeEntry.SetPlaceHolder("Minsta tid (MM:SS)")
-		minTimeEntry.Resize(fyne.NewSize(300, 40))
-
-		chipsEntry := widget.NewMultiLineEntry()
-		chipsEntry.SetPlaceHolder("Klistra in startnummer (ett per rad)")
-		chipsEntry.Resize(fyne.NewSize(300, 200))
-
-		formItems := []*widget.FormItem{
-			{Text: "Namn", Widget: nameEntry},
-			{Text: "Datum", Widget: dateEntry},
-			{Text: "Starttid", Widget: timeEntry},
-			{Text: "Minsta tid", Widget: minTimeEntry},
-			{Text: "Startnummer", Widget: chipsEntry},
+		showRaceForm(window, "Lägg till lopp", "Lägg till", Race{}, func(race Race) {
+			race.ID = newID()
+			race.Status = RaceStatusPlanned
+			race.LiveUpdate = false
+			err := updateRaces(func(loaded []Race) ([]Race, error) {
+				return append(loaded, race), nil
+			})
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("kunde inte spara loppet: %v", err), window)
+				return
+			}
+			updateRaceList()
+		})
+	}
+
+	addButton := widget.NewButton("Lägg till lopp", addRace)
+
+	chipCheckButton := widget.NewButton("Chipkontroll", func() {
+		showChipCheck(currentRaces(), myApp)
+	})
+
+	exportEventButton := widget.NewButton("Exportera evenemang", func() {
+		d := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+			if writer == nil {
+				return
+			}
+			defer writer.Close()
+
+			if err := exportEventArchive(writer, currentRaces()); err != nil {
+				dialog.ShowError(fmt.Errorf("kunde inte exportera evenemang: %v", err), window)
+				return
+			}
+			dialog.ShowInformation("Exportera evenemang",
+				fmt.Sprintf("Evenemanget sparades i %s", writer.URI().Path()), window)
+		}, window)
+		d.SetFileName(workspaceName() + ".zip")
+		d.Resize(fyne.NewSize(1200, 800))
+		d.Show()
+	})
+
+	// Läs om loppen när ett lopp ändrats via API:et. Anropas från API:ets tråd, så listan
+	// byts ut under racesMu. Filövervakningen har en kopia av loppet och startas om med det ändrade loppet.
+	reloadChangedRace := func(raceID string) {
+		loaded, err := loadRaces()
+		if err != nil {
+			getLogger().Log("Kunde inte läsa om loppen efter ändring via API: %v", err)
+			return
 		}
+		racesMu.Lock()
+		races = loaded
+		racesMu.Unlock()
 
-		formDialog := dialog.NewForm("Lägg till lopp", "Lägg till", "Avbryt", formItems, func(submitted bool) {
-			if !submitted {
+		for i := range loaded {
+			if loaded[i].ID != raceID {
+				continue
+			}
+			appState.RemoveStopWatcher(raceID)
+			if loaded[i].LiveUpdate {
+				loaded[i].LiveUpdate = false
+				if err := toggleLiveUpdate(&loaded[i], loaded, i, updateRaceList, appState); err != nil {
+					getLogger().Log("Kunde inte starta om övervakningen av %s: %v", loaded[i].Name, err)
+				}
 				return
 			}
+			updateAllUI(&loaded[i], updateRaceList, appState)
+			return
+		}
+		updateRaceList()
+	}
+
+	// Resultatsidor för publiken över det lokala nätverket
+	var stopLiveResults func()
+	var liveResultsButton *widget.Button
+	liveResultsButton = widget.NewButton("Starta resultatsidor", func() {
+		if stopLiveResults != nil {
+			stopLiveResults()
+			stopLiveResults = nil
+			liveResultsButton.SetText("Starta resultatsidor")
+			return
+		}
 
-			// Parsa minimitid
-			minTimeParts := strings.Split(minTimeEntry.Text, ":")
-			var minTime time.Duration
-			if len(minTimeParts) == 2 {
-				minutes, _ := strconv.Atoi(minTimeParts[0])
-				seconds, _ := strconv.Atoi(minTimeParts[1])
-				minTime = time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+		addrEntry := widget.NewEntry()
+		addrEntry.SetText(loadLiveResultsAddr())
+		dialog.ShowForm("Starta resultatsidor", "Starta", "Avbryt", []*widget.FormItem{
+			{Text: "Adress", Widget: addrEntry, HintText: "Alla nätverk: :8081, bara den här datorn: 127.0.0.1:8081"},
+		}, func(submitted bool) {
+			if !submitted {
+				return
+			}
+			addr := strings.TrimSpace(addrEntry.Text)
+			if err := validateListenAddr(addr); err != nil {
+				dialog.ShowError(err, window)
+				return
 			}
 
-			dateTime := dateEntry.Text + " " + timeEntry.Text
-			startTime, err := time.Parse("2006-01-02 15:04", dateTime)
+			stop, err := startLiveResults(addr, appState.WatchState, func(race Race) error {
+				return checkRaceEditable(race, appState)
+			}, reloadChangedRace)
 			if err != nil {
-				dialog.ShowError(fmt.Errorf("Ogiltigt datum eller tid: %v", err), window)
+				dialog.ShowError(err, window)
 				return
 			}
-
-			chips := make(map[string]bool)
-			for _, chip := range strings.Split(chipsEntry.Text, "\n") {
-				chip = strings.TrimSpace(chip)
-				if chip != "" {
-					chips[chip] = true
-				}
+			if err := saveLiveResultsAddr(addr); err != nil {
+				getLogger().Log("Kunde inte spara adress för resultatsidorna: %v", err)
 			}
+			stopLiveResults = stop
+			liveResultsButton.SetText("Stoppa resultatsidor")
 
-			race := Race{
-				Name:         nameEntry.Text,
-				StartTime:    startTime,
-				MinTime:      minTime,
-				Chips:        chips,
-				InvalidTimes: make(map[string]bool),
-				LiveUpdate:   false,
+			token, _ := loadAPIToken()
+			var urls, finishURLs []string
+			for _, base := range liveResultsBaseURLs(addr) {
+				urls = append(urls, base+"/")
+				finishURLs = append(finishURLs, fmt.Sprintf("%s/mal?token=%s", base, token))
 			}
-			races = append(races, race)
-			updateRaceList()
+			dialog.ShowInformation("Resultatsidor",
+				fmt.Sprintf("Resultaten visas på:\n%s\n\nMålregistrering för funktionärer:\n%s\n\nAPI-nyckel för ändringar: %s",
+					strings.Join(urls, "\n"), strings.Join(finishURLs, "\n"), token), window)
 		}, window)
+	})
 
-		formDialog.Resize(fyne.NewSize(600, 800))
-		formDialog.Show()
+	// Stoppa läsarövervakningen och resultatsidorna när evenemanget lämnas eller fönstret stängs
+	var leaveOnce sync.Once
+	leaveEvent := func() {
+		leaveOnce.Do(func() {
+			stopReaderMonitor()
+			if stopLiveResults != nil {
+				stopLiveResults()
+				stopLiveResults = nil
+			}
+		})
 	}
+	window.SetOnClosed(func() {
+		leaveEvent()
+		appState.CloseAll()
+	})
 
-	addButton := widget.NewButton("Lägg till lopp", addRace)
+	switchEventButton := widget.NewButton("Byt evenemang", func() {
+		leaveEvent()
+		onSwitchEvent()
+	})
 
 	content := container.New(layout.NewVBoxLayout(),
+		alarmContainer,
 		widget.NewLabel("Aktiva lopp:"),
 		raceContainer,
-		addButton,
+		container.NewHBox(addButton, chipCheckButton, exportEventButton, liveResultsButton, switchEventButton, showArchived),
 	)
 
 	window.SetContent(content)
-
-	window.Resize(fyne.NewSize(1536, 864))
-	window.CenterOnScreen()
-
-	window.ShowAndRun()
 }
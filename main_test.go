@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// Testerna får inte skriva i användarens konfigurationsmapp, så den pekas om till en tillfällig mapp
+func TestMain(m *testing.M) {
+	configDir, err := os.MkdirTemp("", "tidtagning-test-")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", configDir)
+	os.Setenv("XDG_CONFIG_HOME", configDir)
+	os.Setenv("APPDATA", configDir)
+
+	code := m.Run()
+	os.RemoveAll(configDir)
+	os.Exit(code)
+}
+
+// Öppna ett tomt evenemang i en tillfällig mapp för testet
+func useTestWorkspace(t *testing.T) string {
+	t.Helper()
+	previous := workspaceDir
+	t.Cleanup(func() {
+		workspaceDir = previous
+		// Evenemang som testet öppnat ska inte finnas kvar bland de senast öppnade
+		if filename, err := recentWorkspacesFilename(); err == nil {
+			os.Remove(filename)
+		}
+	})
+
+	dir := t.TempDir()
+	if err := useWorkspace(dir); err != nil {
+		t.Fatalf("kunde inte öppna evenemang: %v", err)
+	}
+	return dir
+}
+
+// Loppet som testerna utgår från: start 10:00 med startnummer 1 och 2
+func testRace(status string) Race {
+	return Race{
+		ID:           "lopp1",
+		Name:         "Milen",
+		StartTime:    time.Date(2026, 5, 17, 10, 0, 0, 0, time.UTC),
+		Chips:        map[string]bool{"1": true, "2": true},
+		InvalidTimes: map[string]bool{},
+		Status:       status,
+	}
+}
+
+// Spara testloppet som enda lopp i det öppna evenemanget
+func saveTestRace(t *testing.T, status string) Race {
+	t.Helper()
+	race := testRace(status)
+	if err := saveRaces([]Race{race}); err != nil {
+		t.Fatalf("saveRaces: %v", err)
+	}
+	return race
+}
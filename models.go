@@ -5,9 +5,6 @@ import (
 	"os"
 	"sync"
 	"time"
-
-	"fyne.io/fyne/v2"
-	"fyne.io/fyne/v2/widget"
 )
 
 type Logger struct {
@@ -16,17 +13,11 @@ type Logger struct {
 	mu     sync.Mutex
 }
 
-type ResultWindow struct {
-	currentResults  []ChipResult
-	originalResults []ChipResult
-	window          fyne.Window
-	table           *widget.Table
-	searchEntry     *widget.Entry
-}
-
 type ManualTime struct {
+	ID       string    `json:"id"`
 	Chip     string    `json:"chip"`
 	Time     time.Time `json:"time"`
+	RaceID   string    `json:"raceId"`
 	RaceName string    `json:"raceName"`
 }
 
@@ -38,32 +29,92 @@ type ChipResult struct {
 	Manual   bool          `json:"manual"`
 }
 
+// En rad i loppets slutresultat
+type ResultRow struct {
+	Place      int    `json:"place"`
+	Chip       string `json:"chip"`
+	Name       string `json:"name"`
+	Class      string `json:"class,omitempty"`
+	ClassPlace int    `json:"classPlace,omitempty"`
+	Time       string `json:"time"`
+	Duration   int64  `json:"durationMs"`
+	Manual     bool   `json:"manual"`
+}
+
+type Participant struct {
+	Name  string `json:"name"`
+	Class string `json:"class,omitempty"`
+}
+
 type Race struct {
-	Name          string          `json:"name"`
-	StartTime     time.Time       `json:"startTime"`
-	MinTime       time.Duration   `json:"minTime"`
-	Chips         map[string]bool `json:"chips"`
-	ResultsFile   string          `json:"resultsFile"`
-	InvalidTimes  map[string]bool `json:"invalidTimes"`
-	LiveUpdate    bool            `json:"liveUpdate"`
-	SpreadsheetId string          `json:"spreadsheetId"`
-	SheetName     string          `json:"sheetName"`
+	ID              string                 `json:"id"`
+	Name            string                 `json:"name"`
+	StartTime       time.Time              `json:"startTime"`
+	MinTime         time.Duration          `json:"minTime"`
+	Chips           map[string]bool        `json:"chips"`
+	ResultsFile     string                 `json:"resultsFile"`
+	InvalidTimes    map[string]bool        `json:"invalidTimes"`
+	LiveUpdate      bool                   `json:"liveUpdate"`
+	SpreadsheetId   string                 `json:"spreadsheetId"`
+	SheetName       string                 `json:"sheetName"`
+	SilenceAlarm    time.Duration          `json:"silenceAlarm"`
+	Participants    map[string]Participant `json:"participants"`
+	DNS             map[string]bool        `json:"dns"`
+	Status          string                 `json:"status"`
+	StartChip       string                 `json:"startChip,omitempty"`
+	ExportedResults string                 `json:"exportedResults,omitempty"`
+	ExportedAt      *time.Time             `json:"exportedAt,omitempty"`
 }
 
+// Race utan egna JSON-metoder, så att alla fält följer med automatiskt
+type raceFields Race
+
 type DurationRace struct {
-	Name          string          `json:"name"`
-	StartTime     time.Time       `json:"startTime"`
-	MinTime       string          `json:"minTime"`
-	Chips         map[string]bool `json:"chips"`
-	ResultsFile   string          `json:"resultsFile"`
-	InvalidTimes  map[string]bool `json:"invalidTimes"`
-	LiveUpdate    bool            `json:"liveUpdate"`
-	SpreadsheetId string          `json:"spreadsheetId"`
-	SheetName     string          `json:"sheetName"`
+	raceFields
+	MinTime      string `json:"minTime"`
+	SilenceAlarm string `json:"silenceAlarm,omitempty"`
 }
 
+// ChipResult utan egna JSON-metoder
+type chipResultFields ChipResult
+
 type DurationChipResult struct {
-	Chip     string    `json:"chip"`
-	Time     time.Time `json:"time"`
-	Duration string    `json:"duration"`
+	chipResultFields
+	Duration string `json:"duration"`
+}
+
+type ReaderLineError struct {
+	Line   int    `json:"line"`
+	Text   string `json:"text"`
+	Reason string `json:"reason"`
+}
+
+type ChipReadSummary struct {
+	Chip  string    `json:"chip"`
+	Count int       `json:"count"`
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+}
+
+type ReadDiagnostics struct {
+	TotalLines   int               `json:"totalLines"`
+	ParseErrors  []ReaderLineError `json:"parseErrors"`
+	UnknownChips []ChipReadSummary `json:"unknownChips"`
+	EarlyReads   []ChipReadSummary `json:"earlyReads"`
+}
+
+type ReaderHealth struct {
+	RaceName        string    `json:"raceName"`
+	File            string    `json:"file"`
+	ReadsLastMinute int       `json:"readsLastMinute"`
+	LastRead        time.Time `json:"lastRead"`
+	LastChange      time.Time `json:"lastChange"`
+	ChipsSeen       int       `json:"chipsSeen"`
+	ChipsRegistered int       `json:"chipsRegistered"`
+}
+
+type StartPresence struct {
+	SeenBeforeStart []ChipReadSummary `json:"seenBeforeStart"`
+	OnlyAfterStart  []string          `json:"onlyAfterStart"`
+	NeverSeen       []string          `json:"neverSeen"`
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Tolka inklistrade startnummer, ett per rad med ett valfritt namn efter numret
+// och en valfri klass efter semikolon, till exempel "101 Anna Andersson; D21"
+func parseParticipantLines(text string) (map[string]bool, map[string]Participant) {
+	chips := make(map[string]bool)
+	participants := make(map[string]Participant)
+
+	for _, line := range strings.Split(text, "\n") {
+		class := ""
+		if i := strings.LastIndex(line, ";"); i >= 0 {
+			class = strings.TrimSpace(line[i+1:])
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		chip := fields[0]
+		chips[chip] = true
+		if len(fields) > 1 || class != "" {
+			participants[chip] = Participant{Name: strings.Join(fields[1:], " "), Class: class}
+		}
+	}
+
+	return chips, participants
+}
+
+// Skriv loppets startnummer som rader i samma format som parseParticipantLines läser
+func formatParticipantLines(race Race) string {
+	chips := make([]string, 0, len(race.Chips))
+	for chip := range race.Chips {
+		chips = append(chips, chip)
+	}
+	sortChipsNumerically(chips)
+
+	lines := make([]string, 0, len(chips))
+	for _, chip := range chips {
+		line := chip
+		if name := participantName(race, chip); name != "" {
+			line += " " + name
+		}
+		if class := participantClass(race, chip); class != "" {
+			line += "; " + class
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Hämta namnet för ett startnummer om det finns angivet
+func participantName(race Race, chip string) string {
+	if participant, exists := race.Participants[chip]; exists {
+		return participant.Name
+	}
+	return ""
+}
+
+// Hämta klassen för ett startnummer om den finns angiven
+func participantClass(race Race, chip string) string {
+	return race.Participants[chip].Class
+}
+
+// Sortera startnummer numeriskt istället för alfabetiskt
+func sortChipsNumerically(chips []string) {
+	sort.Slice(chips, func(i, j int) bool {
+		ni, _ := strconv.Atoi(chips[i])
+		nj, _ := strconv.Atoi(chips[j])
+		return ni < nj
+	})
+}
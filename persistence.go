@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Mapp där tidigare versioner av viktiga filer sparas
+const backupDir = "backups"
+
+// Antal tidigare versioner som sparas per fil
+const keepBackupVersions = 10
+
+// Tidsformat i backupfilernas namn, sorteras i tidsordning
+const backupTimeLayout = "20060102-150405.000000000"
+
+// Fel som returneras när en fil finns men inte går att tolka, t.ex. efter ett strömavbrott
+type corruptFileError struct {
+	filename string
+	err      error
+}
+
+func (e *corruptFileError) Error() string {
+	return fmt.Sprintf("filen %s är skadad: %v", e.filename, e.err)
+}
+
+// Skriv en fil genom att först skriva till en temporär fil och sedan byta namn,
+// så att en krasch aldrig lämnar en halvskriven fil efter sig
+func writeFileAtomic(filename string, data []byte) error {
+	dir := filepath.Dir(filename)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("kunde inte skapa temporär fil: %v", err)
+	}
+	tmpName := tmp.Name()
+
+	// Städa bort den temporära filen om något går fel
+	success := false
+	defer func() {
+		if !success {
+			tmp.Close()
+			os.Remove(tmpName)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return fmt.Errorf("kunde inte skriva temporär fil: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("kunde inte synka temporär fil: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("kunde inte stänga temporär fil: %v", err)
+	}
+	if err := os.Chmod(tmpName, 0644); err != nil {
+		return fmt.Errorf("kunde inte sätta rättigheter: %v", err)
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		return fmt.Errorf("kunde inte byta namn på temporär fil: %v", err)
+	}
+	success = true
+
+	// Synka mappen så att namnbytet överlever ett strömavbrott, fungerar inte på alla system
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
+
+// Skriv JSON till fil atomärt
+func writeJSONAtomic(filename string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, data)
+}
+
+// Skriv JSON till fil atomärt. Det tidigare innehållet sparas först bland de senaste versionerna.
+func writeJSONVersioned(filename string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	previous, err := os.ReadFile(filename)
+	if err == nil {
+		if err := saveBackupVersion(filename, previous); err != nil {
+			// En misslyckad backup ska inte stoppa arbetet
+			getLogger().Log("Kunde inte spara backup av %s: %v", filename, err)
+		}
+	} else if !os.IsNotExist(err) {
+		getLogger().Log("Kunde inte läsa %s inför backup: %v", filename, err)
+	}
+
+	return writeFileAtomic(filename, data)
+}
+
+// Spara en version av filen i backupmappen och ta bort de äldsta. En version som är
+// likadan som den senaste sparas inte igen.
+func saveBackupVersion(filename string, data []byte) error {
+	dir := filepath.Join(filepath.Dir(filename), backupDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if backups, err := listBackups(filename); err == nil && len(backups) > 0 {
+		if latest, err := os.ReadFile(backups[0]); err == nil && bytes.Equal(latest, data) {
+			return nil
+		}
+	}
+
+	backupName := filepath.Join(dir, fmt.Sprintf("%s.%s", filepath.Base(filename), time.Now().Format(backupTimeLayout)))
+	if err := writeFileAtomic(backupName, data); err != nil {
+		return err
+	}
+
+	backups, err := listBackups(filename)
+	if err != nil {
+		return err
+	}
+	for _, old := range backups[min(len(backups), keepBackupVersions):] {
+		if err := os.Remove(old); err != nil {
+			getLogger().Log("Kunde inte ta bort gammal backup %s: %v", old, err)
+		}
+	}
+	return nil
+}
+
+// Lista sparade versioner av en fil, nyaste först
+func listBackups(filename string) ([]string, error) {
+	dir := filepath.Join(filepath.Dir(filename), backupDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	prefix := filepath.Base(filename) + "."
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		// Hoppa över andra filer som råkar börja likadant
+		if _, err := time.Parse(backupTimeLayout, strings.TrimPrefix(name, prefix)); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(dir, name))
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	return backups, nil
+}
+
+// Hitta den senaste sparade versionen som går att läsa
+func latestValidBackup(filename string, validate func([]byte) error) (string, []byte, error) {
+	backups, err := listBackups(filename)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, backup := range backups {
+		data, err := os.ReadFile(backup)
+		if err != nil {
+			continue
+		}
+		if err := validate(data); err != nil {
+			getLogger().Log("Backup %s går inte att använda: %v", backup, err)
+			continue
+		}
+		return backup, data, nil
+	}
+
+	return "", nil, fmt.Errorf("det finns ingen fungerande backup av %s", filename)
+}
+
+// Ersätt en skadad fil med den senaste fungerande versionen, den skadade filen behålls vid sidan av
+func restoreLatestBackup(filename string, validate func([]byte) error) (string, error) {
+	backup, data, err := latestValidBackup(filename, validate)
+	if err != nil {
+		return "", err
+	}
+
+	corruptName := fmt.Sprintf("%s.corrupt-%s", filename, time.Now().Format(backupTimeLayout))
+	if err := os.Rename(filename, corruptName); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("kunde inte flytta undan skadad fil: %v", err)
+	}
+
+	if err := writeFileAtomic(filename, data); err != nil {
+		return "", err
+	}
+
+	getLogger().Log("Återställde %s från %s, skadad fil sparad som %s", filename, backup, corruptName)
+	return backup, nil
+}
+
+// Kontrollera att data är hel JSON, en avbruten skrivning ger ofullständig JSON
+func validateJSON(data []byte) error {
+	if !json.Valid(data) {
+		return fmt.Errorf("ofullständig eller ogiltig JSON")
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestWriteJSONVersionedBacksUpPreviousContents(t *testing.T) {
+	useTestWorkspace(t)
+	filename := dataPath("data.json")
+
+	for _, value := range []string{"första", "andra", "tredje"} {
+		if err := writeJSONVersioned(filename, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := listBackups(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("väntade 2 backuper, fick %d", len(backups))
+	}
+	for i, want := range []string{`"andra"`, `"första"`} {
+		data, err := os.ReadFile(backups[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("backup %d innehåller %s, väntade %s", i, data, want)
+		}
+	}
+
+	// Samma innehåll sparas inte som en ny version
+	if err := saveBackupVersion(filename, []byte(`"andra"`)); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ := listBackups(filename); len(backups) != 2 {
+		t.Errorf("likadan version sparades igen, %d backuper", len(backups))
+	}
+}
+
+func TestLoadRacesReportsUnreadableFileAsCorrupt(t *testing.T) {
+	useTestWorkspace(t)
+
+	// Giltig JSON men fel typer, ska gå att återställa precis som ofullständig JSON
+	for _, data := range []string{`{"schemaVersion": 4, "races": [{"name": 5}]}`, `{"schemaVersion": 4, "races": [`} {
+		if err := os.WriteFile(racesFilename(), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		var corruptErr *corruptFileError
+		if _, err := loadRaces(); !errors.As(err, &corruptErr) {
+			t.Errorf("%s: väntade skadad fil, fick %v", data, err)
+		}
+	}
+
+	// En fil från en nyare version är inte skadad
+	if err := os.WriteFile(racesFilename(), []byte(`{"schemaVersion": 99, "races": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var corruptErr *corruptFileError
+	if _, err := loadRaces(); err == nil || errors.As(err, &corruptErr) {
+		t.Errorf("nyare version: väntade ett vanligt fel, fick %v", err)
+	}
+}
+
+func TestRestoreLatestBackupAfterCorruption(t *testing.T) {
+	useTestWorkspace(t)
+
+	first := []Race{{ID: "a", Name: "Första"}}
+	if err := saveRaces(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveRaces(append(first, Race{ID: "b", Name: "Andra"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(racesFilename(), []byte(`{"races": 5}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := restoreLatestBackup(racesFilename(), validateRacesData); err != nil {
+		t.Fatal(err)
+	}
+	races, err := loadRaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(races) != 1 || races[0].ID != "a" {
+		t.Errorf("återställde fel version: %+v", races)
+	}
+}
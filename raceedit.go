@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Tolka datum och starttid, med eller utan sekunder
+func parseStartTime(date, clock string, location *time.Location) (time.Time, error) {
+	if location == nil {
+		location = time.UTC
+	}
+	dateTime := strings.TrimSpace(date) + " " + strings.TrimSpace(clock)
+
+	var lastErr error
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02 15:04:05", "2006-01-02 15:04:05.000"} {
+		startTime, err := time.ParseInLocation(layout, dateTime, location)
+		if err == nil {
+			return startTime, nil
+		}
+		lastErr = err
+	}
+	return time.Time{}, lastErr
+}
+
+// Fingeravtryck för loppets slutresultat, ändras om någon placering, tid eller namn ändras.
+// Räknas utan att skriva resultatcachen, loppet kan vara en ändring som inte sparats.
+func resultsFingerprint(race Race) (string, error) {
+	var results strings.Builder
+	if err := writeResultsCSV(&results, race); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(results.String()))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Kom ihåg vilka resultat som exporterades, så att senare ändringar kan varna
+func markResultsExported(race *Race) {
+	fingerprint, err := resultsFingerprint(*race)
+	if err != nil {
+		getLogger().Log("Kunde inte beräkna fingeravtryck för %s: %v", race.Name, err)
+		return
+	}
+	exportedAt := time.Now()
+	race.ExportedResults = fingerprint
+	race.ExportedAt = &exportedAt
+}
+
+// Avgör om ändringen av loppet ger andra resultat än de som redan exporterats
+func exportedResultsChanged(edited Race) bool {
+	if edited.ExportedResults == "" || edited.ExportedAt == nil {
+		return false
+	}
+	fingerprint, err := resultsFingerprint(edited)
+	if err != nil {
+		return true
+	}
+	return fingerprint != edited.ExportedResults
+}
@@ -0,0 +1,217 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Formulär för ett lopps inställningar, används både när loppet skapas och när det ändras.
+// onSubmit får en kopia av initial med de nya inställningarna.
+func showRaceForm(window fyne.Window, title, confirm string, initial Race, onSubmit func(Race)) {
+	nameEntry := widget.NewEntry()
+	nameEntry.SetPlaceHolder("Loppets namn (t.ex. '10km')")
+	nameEntry.Text = initial.Name
+	nameEntry.Resize(fyne.NewSize(300, 40))
+
+	dateEntry := widget.NewEntry()
+	dateEntry.SetPlaceHolder("Datum (YYYY-MM-DD)")
+	dateEntry.Text = time.Now().Format("2006-01-02")
+	dateEntry.Resize(fyne.NewSize(300, 40))
+
+	timeEntry := widget.NewEntry()
+	timeEntry.SetPlaceHolder("Starttid (HH:MM eller HH:MM:SS)")
+	timeEntry.Resize(fyne.NewSize(300, 40))
+
+	if !initial.StartTime.IsZero() {
+		dateEntry.Text = initial.StartTime.Format("2006-01-02")
+		timeEntry.Text = initial.StartTime.Format("15:04")
+		if initial.StartTime.Second() != 0 || initial.StartTime.Nanosecond() != 0 {
+			timeEntry.Text = initial.StartTime.Format("15:04:05.000")
+		}
+	}
+
+	minTimeEntry := widget.NewEntry()
+	minTimeEntry.SetPlaceHolder("Minsta tid (MM:SS)")
+	if initial.MinTime > 0 {
+		minTimeEntry.Text = fmt.Sprintf("%d:%02d", int(initial.MinTime.Minutes()), int(initial.MinTime.Seconds())%60)
+	}
+	minTimeEntry.Resize(fyne.NewSize(300, 40))
+
+	silenceAlarmEntry := widget.NewEntry()
+	silenceAlarmEntry.SetPlaceHolder("Larm efter antal minuter utan läsningar (standard 5)")
+	if initial.SilenceAlarm > 0 {
+		silenceAlarmEntry.Text = strconv.Itoa(int(initial.SilenceAlarm.Minutes()))
+	}
+	silenceAlarmEntry.Resize(fyne.NewSize(300, 40))
+
+	startChipEntry := widget.NewEntry()
+	startChipEntry.SetPlaceHolder("Chip som läses vid startskottet (valfritt)")
+	startChipEntry.Text = initial.StartChip
+	startChipEntry.Resize(fyne.NewSize(300, 40))
+
+	chipsEntry := widget.NewMultiLineEntry()
+	chipsEntry.SetPlaceHolder("Klistra in startnummer (ett per rad, valfritt följt av namn och ; klass)")
+	chipsEntry.Text = formatParticipantLines(initial)
+	chipsEntry.Resize(fyne.NewSize(300, 200))
+
+	formItems := []*widget.FormItem{
+		{Text: "Namn", Widget: nameEntry},
+		{Text: "Datum", Widget: dateEntry},
+		{Text: "Starttid", Widget: timeEntry},
+		{Text: "Minsta tid", Widget: minTimeEntry},
+		{Text: "Tyst läsare", Widget: silenceAlarmEntry},
+		{Text: "Startchip", Widget: startChipEntry},
+		{Text: "Startnummer", Widget: chipsEntry},
+	}
+
+	formDialog := dialog.NewForm(title, confirm, "Avbryt", formItems, func(submitted bool) {
+		if !submitted {
+			return
+		}
+
+		// Parsa minimitid
+		minTimeParts := strings.Split(minTimeEntry.Text, ":")
+		var minTime time.Duration
+		if len(minTimeParts) == 2 {
+			minutes, _ := strconv.Atoi(minTimeParts[0])
+			seconds, _ := strconv.Atoi(minTimeParts[1])
+			minTime = time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+		}
+
+		// Parsa larmgräns för tyst läsare
+		var silenceAlarm time.Duration
+		if text := strings.TrimSpace(silenceAlarmEntry.Text); text != "" {
+			minutes, err := strconv.Atoi(text)
+			if err != nil || minutes <= 0 {
+				dialog.ShowError(fmt.Errorf("Ogiltigt antal minuter för tyst läsare"), window)
+				return
+			}
+			silenceAlarm = time.Duration(minutes) * time.Minute
+		}
+
+		startTime, err := parseStartTime(dateEntry.Text, timeEntry.Text, initial.StartTime.Location())
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("Ogiltigt datum eller tid: %v", err), window)
+			return
+		}
+
+		chips, participants := parseParticipantLines(chipsEntry.Text)
+
+		startChip := strings.TrimSpace(startChipEntry.Text)
+		if startChip != "" && chips[startChip] {
+			dialog.ShowError(fmt.Errorf("Startchipet %s kan inte också vara ett startnummer i loppet", startChip), window)
+			return
+		}
+
+		race := initial
+		race.Name = nameEntry.Text
+		race.StartTime = startTime
+		race.MinTime = minTime
+		race.SilenceAlarm = silenceAlarm
+		race.StartChip = startChip
+		race.Chips = chips
+		race.Participants = participants
+		if race.InvalidTimes == nil {
+			race.InvalidTimes = make(map[string]bool)
+		}
+
+		// DNS gäller bara startnummer som fortfarande finns kvar i loppet
+		if len(initial.DNS) > 0 {
+			race.DNS = make(map[string]bool)
+			for chip := range initial.DNS {
+				if chips[chip] {
+					race.DNS[chip] = true
+				}
+			}
+		}
+
+		onSubmit(race)
+	}, window)
+
+	formDialog.Resize(fyne.NewSize(600, 800))
+	formDialog.Show()
+}
+
+// Ändra ett befintligt lopp. Manuella tider och felmarkeringar behålls eftersom de
+// är nycklade på loppets ID och läsningarnas klockslag, resultaten räknas om från dem.
+func showEditRace(race Race, races []Race, index int, window fyne.Window, updateUI func(), appState *AppState) {
+	if !raceResultsEditable(race) {
+		dialog.ShowError(raceLockedError(race), window)
+		return
+	}
+	if err := checkRaceEditable(race, appState); err != nil {
+		dialog.ShowError(err, window)
+		return
+	}
+
+	showRaceForm(window, "Ändra lopp", "Spara", race, func(edited Race) {
+		saveEditedRace(edited, races, index, window, updateUI, appState, nil)
+	})
+}
+
+// Kontrollera att loppet kan ändras utan att något annat fönster skriver över ändringen
+func checkRaceEditable(race Race, appState *AppState) error {
+	// Resultatfönstret har en egen kopia av loppet som skulle skriva över ändringen
+	if _, open := appState.GetResultWindow(resultWindowID(race)); open {
+		return fmt.Errorf("Stäng resultatfönstret för %s innan du ändrar loppet", race.Name)
+	}
+	return nil
+}
+
+// Spara ett ändrat lopp och räkna om resultaten. Om ändringen ger andra resultat än de som
+// redan exporterats får användaren bekräfta först. onSaved anropas när ändringen är sparad.
+func saveEditedRace(edited Race, races []Race, index int, window fyne.Window, updateUI func(), appState *AppState, onSaved func()) {
+	apply := func() {
+		if err := checkRaceEditable(edited, appState); err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+
+		races[index] = edited
+		if err := saveRace(edited); err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		os.Remove(resultsCacheFilename(edited.ID))
+		getLogger().Log("Ändrade lopp %s (start %s, minsta tid %v, %d startnummer)",
+			edited.Name, edited.StartTime.Format("2006-01-02 15:04:05.000"), edited.MinTime, len(edited.Chips))
+
+		if onSaved != nil {
+			onSaved()
+		}
+
+		// Filövervakningen har en kopia av loppet och startas om med de nya inställningarna
+		if edited.LiveUpdate {
+			appState.RemoveStopWatcher(edited.ID)
+			edited.LiveUpdate = false
+			if err := toggleLiveUpdate(&edited, races, index, updateUI, appState); err != nil {
+				dialog.ShowError(err, window)
+			}
+			return
+		}
+		updateUI()
+	}
+
+	if exportedResultsChanged(edited) {
+		dialog.ShowConfirm("Exporterade resultat ändras",
+			fmt.Sprintf("Resultaten för %s exporterades %s. Ändringen ger andra resultat än de som exporterades, "+
+				"så de behöver exporteras igen.\n\nVill du spara ändringen?",
+				edited.Name, edited.ExportedAt.Format("2006-01-02 15:04")),
+			func(ok bool) {
+				if ok {
+					apply()
+				}
+			}, window)
+		return
+	}
+	apply()
+}
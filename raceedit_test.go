@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestExportedResultsChangedDoesNotWriteCache(t *testing.T) {
+	useTestWorkspace(t)
+
+	race := testRace("")
+	manual := []ManualTime{{ID: "m1", RaceID: race.ID, Chip: "1", Time: race.StartTime.Add(40 * time.Minute)}}
+	if err := saveManualTimes(race.ID, manual); err != nil {
+		t.Fatal(err)
+	}
+
+	markResultsExported(&race)
+	if race.ExportedResults == "" || race.ExportedAt == nil {
+		t.Fatalf("exporten markerades inte: %+v", race)
+	}
+
+	edited := race
+	edited.DNS = map[string]bool{"1": true}
+	if !exportedResultsChanged(edited) {
+		t.Errorf("ändring till ej startande gav samma resultat som exporterades")
+	}
+	if exportedResultsChanged(race) {
+		t.Errorf("oförändrat lopp räknades som ändrat")
+	}
+
+	if _, err := os.Stat(resultsCacheFilename(race.ID)); !os.IsNotExist(err) {
+		t.Errorf("resultatcachen skrevs när fingeravtrycket räknades")
+	}
+}
@@ -0,0 +1,223 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/jimmitjoo/hogby-tidtagning/internal/timeformat"
+)
+
+// Löptid som HH:MM:SS, i samma format som går att mata in igen
+func formatElapsedInput(d time.Duration) string {
+	totalSeconds := int64(d / time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", totalSeconds/3600, (totalSeconds/60)%60, totalSeconds%60)
+}
+
+// Beskriv ett startnummer medan det skrivs: namn och klass, eller varför det inte går att använda
+func describeBib(race Race, results []ChipResult, chip string) (string, bool) {
+	if chip == "" {
+		return "", true
+	}
+	if !race.Chips[chip] {
+		return fmt.Sprintf("Startnummer %s finns inte i loppet", chip), false
+	}
+
+	text := participantName(race, chip)
+	if class := participantClass(race, chip); class != "" {
+		text += " (" + class + ")"
+	}
+	if race.DNS[chip] {
+		text += " - startade inte"
+	}
+	for _, result := range results {
+		if result.Chip == chip && !result.Invalid {
+			text += fmt.Sprintf(" - har redan tid %s som ersätts", timeformat.Duration(result.Duration))
+			break
+		}
+	}
+	return strings.TrimSpace(text), true
+}
+
+// Panel för att mata in många manuella tider i följd med tangentbordet:
+// startnummer, Tab, tid, Enter. Inmatade tider visas i en logg där de kan rättas direkt.
+func showRapidEntry(race *Race, races []Race, index int, app fyne.App, onChange func()) {
+	window := app.NewWindow(fmt.Sprintf("Snabbinmatning - %s", race.Name))
+
+	chipEntry := widget.NewEntry()
+	chipEntry.SetPlaceHolder("Startnummer")
+	timeEntry := widget.NewEntry()
+	timeEntry.SetPlaceHolder("Tid, t.ex. 00:23:11 eller 2311")
+
+	bibLabel := widget.NewLabel("")
+	statusLabel := widget.NewLabel("Skriv startnummer, Tab, tid och Enter")
+	logList := container.NewVBox()
+	entered := 0
+
+	// Resultaten läses om efter varje sparad tid, inte för varje tangenttryckning
+	results := getAllResults(*race)
+
+	// Spara en händelse i journalen och loppet
+	record := func(entry JournalEntry) error {
+		if _, err := recordJournalEntry(race, entry); err != nil {
+			return err
+		}
+		races[index] = *race
+		if err := saveRace(*race); err != nil {
+			return err
+		}
+		results = getAllResults(*race)
+		onChange()
+		return nil
+	}
+
+	showStatus := func(text string, failed bool) {
+		statusLabel.SetText(text)
+		if failed {
+			statusLabel.Importance = widget.DangerImportance
+		} else {
+			statusLabel.Importance = widget.MediumImportance
+		}
+		statusLabel.Refresh()
+	}
+
+	// En rad i loggen med fält för att rätta tiden direkt
+	addLogRow := func(mt ManualTime) {
+		entered++
+		number := entered
+		current := mt
+
+		rowChip := widget.NewEntry()
+		rowChip.SetText(mt.Chip)
+		rowTime := widget.NewEntry()
+		rowTime.SetText(formatElapsedInput(mt.Time.Sub(race.StartTime)))
+		rowLabel := widget.NewLabel(participantName(*race, mt.Chip))
+
+		correct := func(string) {
+			chip, recordTime, err := validateManualTime(*race, rowChip.Text, expandTimeDigits(rowTime.Text))
+			if err != nil {
+				showStatus(fmt.Sprintf("#%d: %v", number, err), true)
+				return
+			}
+			if chip == current.Chip && recordTime.Equal(current.Time) {
+				return
+			}
+			entry, err := editedManualTimeEntry(*race, current, chip, recordTime)
+			if err == nil {
+				err = record(entry)
+			}
+			if err != nil {
+				showStatus(fmt.Sprintf("#%d: kunde inte rätta tiden: %v", number, err), true)
+				return
+			}
+			current = *entry.Manual
+			rowTime.SetText(formatElapsedInput(recordTime.Sub(race.StartTime)))
+			rowLabel.SetText(participantName(*race, chip) + " (rättad)")
+			showStatus(fmt.Sprintf("#%d rättad till %s %s", number, chip, timeformat.Duration(recordTime.Sub(race.StartTime))), false)
+			window.Canvas().Focus(chipEntry)
+		}
+		rowChip.OnSubmitted = correct
+		rowTime.OnSubmitted = correct
+
+		deleteButton := widget.NewButtonWithIcon("", theme.DeleteIcon(), nil)
+		deleteButton.Importance = widget.DangerImportance
+		deleteButton.OnTapped = func() {
+			deleted := current
+			if err := record(JournalEntry{
+				Type:   journalManualDelete,
+				Chip:   current.Chip,
+				Manual: &deleted,
+			}); err != nil {
+				showStatus(fmt.Sprintf("#%d: kunde inte ta bort tiden: %v", number, err), true)
+				return
+			}
+			rowChip.Disable()
+			rowTime.Disable()
+			deleteButton.Disable()
+			rowLabel.SetText("Borttagen")
+			showStatus(fmt.Sprintf("#%d borttagen", number), false)
+			window.Canvas().Focus(chipEntry)
+		}
+
+		row := container.NewBorder(nil, nil,
+			container.NewHBox(
+				widget.NewLabel(fmt.Sprintf("#%d", number)),
+				container.NewGridWrap(fyne.NewSize(100, rowChip.MinSize().Height), rowChip),
+				container.NewGridWrap(fyne.NewSize(120, rowTime.MinSize().Height), rowTime),
+			),
+			deleteButton,
+			rowLabel)
+
+		// Senaste inmatningen överst
+		logList.Objects = append([]fyne.CanvasObject{row}, logList.Objects...)
+		logList.Refresh()
+	}
+
+	chipEntry.OnChanged = func(text string) {
+		description, ok := describeBib(*race, results, strings.TrimSpace(text))
+		bibLabel.SetText(description)
+		if ok {
+			bibLabel.Importance = widget.MediumImportance
+		} else {
+			bibLabel.Importance = widget.DangerImportance
+		}
+		bibLabel.Refresh()
+	}
+	chipEntry.OnSubmitted = func(string) {
+		window.Canvas().Focus(timeEntry)
+	}
+
+	timeEntry.OnSubmitted = func(string) {
+		chip, recordTime, err := validateManualTime(*race, chipEntry.Text, expandTimeDigits(timeEntry.Text))
+		if err != nil {
+			showStatus(err.Error(), true)
+			if !race.Chips[strings.TrimSpace(chipEntry.Text)] {
+				window.Canvas().Focus(chipEntry)
+			}
+			return
+		}
+
+		entry := newManualTimeEntry(*race, chip, recordTime, "")
+		if err := record(entry); err != nil {
+			showStatus(fmt.Sprintf("Kunde inte spara tiden: %v", err), true)
+			return
+		}
+
+		addLogRow(*entry.Manual)
+		showStatus(fmt.Sprintf("Sparade %s %s %s", chip, participantName(*race, chip),
+			timeformat.Duration(recordTime.Sub(race.StartTime))), false)
+		chipEntry.SetText("")
+		timeEntry.SetText("")
+		window.Canvas().Focus(chipEntry)
+	}
+
+	if !raceResultsEditable(*race) {
+		chipEntry.Disable()
+		timeEntry.Disable()
+		dialog.ShowError(raceLockedError(*race), window)
+	}
+
+	form := container.NewGridWithColumns(2, chipEntry, timeEntry)
+	window.SetContent(container.NewPadded(container.NewBorder(
+		container.NewVBox(
+			widget.NewLabel("Tid anges som löptid (HH:MM:SS eller bara siffror), dag N HH:MM:SS eller datum och klockslag"),
+			form,
+			bibLabel,
+			statusLabel,
+			widget.NewSeparator(),
+			widget.NewLabel("Inmatade tider, rätta direkt i fälten och tryck Enter"),
+		),
+		nil, nil, nil,
+		container.NewVScroll(logList),
+	)))
+	window.Resize(fyne.NewSize(700, 700))
+	window.Show()
+	window.Canvas().Focus(chipEntry)
+}
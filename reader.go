@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Tidsformatet som läsaren skriver i resultatfilen
+const readerTimeLayout = "2006-01-02 15:04:05.000"
+
+// Format med fullständigt datum som läsare kan skriva
+var readerDateTimeLayouts = []string{
+	readerTimeLayout,
+	"2006-01-02 15:04:05",
+}
+
+// Format där läsaren bara skriver klockslag utan datum
+var readerTimeOfDayLayouts = []string{
+	"15:04:05.000",
+	"15:04:05",
+}
+
+// Läsarrader med bara klockslag placeras ut på rätt dygn med hjälp av föregående läsning
+type readerRecordParser struct {
+	reference time.Time
+	// Läsarfilen vars ändringstid avgör dygnet för den första läsningen
+	filename string
+	anchored bool
+}
+
+// Läsarens klocka kan gå före datorns, så en läsning får ligga så här långt efter filens ändringstid
+const readerClockSlack = time.Hour
+
+// Skapa en tolk för en läsarfil. Den första läsningen utan datum placeras utifrån när filen
+// senast skrevs, eller loppets startdag om filen saknas.
+func newReaderRecordParser(filename string, startTime time.Time) *readerRecordParser {
+	return &readerRecordParser{reference: startTime, filename: filename}
+}
+
+// Tolka en rad från läsarfilen till startnummer och tidpunkt
+func (p *readerRecordParser) parse(record []string) (string, time.Time, error) {
+	if len(record) < 2 {
+		return "", time.Time{}, fmt.Errorf("för få kolumner (%d)", len(record))
+	}
+
+	chip := strings.TrimSpace(record[0])
+	if chip == "" {
+		return "", time.Time{}, fmt.Errorf("startnummer saknas")
+	}
+
+	timeStr := strings.TrimSpace(record[1])
+	for _, layout := range readerDateTimeLayouts {
+		if recordTime, err := time.Parse(layout, timeStr); err == nil {
+			p.reference = recordTime
+			return chip, recordTime, nil
+		}
+	}
+
+	for _, layout := range readerTimeOfDayLayouts {
+		if timeOfDay, err := time.Parse(layout, timeStr); err == nil {
+			recordTime := p.placeTimeOfDay(timeOfDay)
+			p.reference = recordTime
+			return chip, recordTime, nil
+		}
+	}
+
+	return "", time.Time{}, fmt.Errorf("ogiltig tid %q", record[1])
+}
+
+// Lägg ett klockslag på samma dygn som föregående läsning, eller nästa dygn om klockan har passerat midnatt
+func (p *readerRecordParser) placeTimeOfDay(timeOfDay time.Time) time.Time {
+	if !p.anchored {
+		p.anchored = true
+		if modTime, err := getFileModTime(p.filename); err == nil {
+			return placeBefore(timeOfDay, modTime, p.reference.Location())
+		}
+	}
+
+	ref := p.reference
+	recordTime := time.Date(ref.Year(), ref.Month(), ref.Day(),
+		timeOfDay.Hour(), timeOfDay.Minute(), timeOfDay.Second(), timeOfDay.Nanosecond(), ref.Location())
+
+	// Läsningar kommer i tidsordning, så ett klockslag långt före föregående läsning hör till nästa dygn
+	if recordTime.Before(ref.Add(-12 * time.Hour)) {
+		recordTime = recordTime.AddDate(0, 0, 1)
+	}
+	return recordTime
+}
+
+// Den första läsningen skrevs senast när filen ändrades, så den hamnar på det senaste
+// dygnet där klockslaget inte ligger efter ändringstiden. Det gäller även lopp som startar
+// på natten, så länge filen inte sträcker sig över mer än ett dygn.
+func placeBefore(timeOfDay, modTime time.Time, loc *time.Location) time.Time {
+	// Läsarens klockslag är lokal tid, som skrivs in i samma tidszon som loppets starttid
+	local := modTime.In(time.Local)
+	latest := time.Date(local.Year(), local.Month(), local.Day(),
+		local.Hour(), local.Minute(), local.Second(), local.Nanosecond(), loc)
+
+	recordTime := time.Date(latest.Year(), latest.Month(), latest.Day(),
+		timeOfDay.Hour(), timeOfDay.Minute(), timeOfDay.Second(), timeOfDay.Nanosecond(), loc)
+	if recordTime.After(latest.Add(readerClockSlack)) {
+		recordTime = recordTime.AddDate(0, 0, -1)
+	}
+	return recordTime
+}
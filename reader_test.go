@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReaderParserPlacesNightStartByFileTime(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "reader.txt")
+	if err := os.WriteFile(filename, []byte("1\t10:00:00\n1\t23:30:00\n2\t00:35:00\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2026, 5, 18, 0, 40, 0, 0, time.Local)
+	if err := os.Chtimes(filename, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	// Provläsningen på förmiddagen ligger mer än tolv timmar före starten
+	start := time.Date(2026, 5, 17, 23, 30, 0, 0, time.UTC)
+	parser := newReaderRecordParser(filename, start)
+
+	want := []time.Time{
+		time.Date(2026, 5, 17, 10, 0, 0, 0, time.UTC),
+		time.Date(2026, 5, 17, 23, 30, 0, 0, time.UTC),
+		time.Date(2026, 5, 18, 0, 35, 0, 0, time.UTC),
+	}
+	records := [][]string{{"1", "10:00:00"}, {"1", "23:30:00"}, {"2", "00:35:00"}}
+	for i, record := range records {
+		_, recordTime, err := parser.parse(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !recordTime.Equal(want[i]) {
+			t.Errorf("%s: fick %s, väntade %s", record[1], recordTime, want[i])
+		}
+	}
+}
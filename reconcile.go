@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Hur mycket chiptid och reservtid får skilja innan raden markeras
+const defaultReconcileTolerance = 2 * time.Second
+
+// Hur chiptider och reservtider paras ihop
+const (
+	reconcileByBib   = "Startnummer"
+	reconcileByOrder = "Målordning"
+)
+
+// En tid från reservtidtagningen, med startnummer om källan har det
+type BackupTime struct {
+	Line int
+	Chip string
+	Time time.Time
+}
+
+// En rad i avstämningen: en chiptid och reservtiden den jämförs med
+type ReconcileRow struct {
+	Chip       string
+	Primary    *ChipResult
+	Backup     *BackupTime
+	Diff       time.Duration
+	Differs    bool
+	Inverted   bool
+	Problem    string
+	Acceptable bool
+	Accept     bool
+}
+
+// Raden stämmer överens och behöver inte granskas
+func (row ReconcileRow) matches() bool {
+	return row.Primary != nil && row.Backup != nil && !row.Differs && !row.Inverted
+}
+
+// Beskrivning av vad som avviker på raden
+func (row ReconcileRow) status() string {
+	var parts []string
+	switch {
+	case row.Primary == nil:
+		parts = append(parts, "Saknar chiptid")
+	case row.Backup == nil:
+		parts = append(parts, "Saknar reservtid")
+	}
+	if row.Differs {
+		parts = append(parts, fmt.Sprintf("Skillnad %s", formatTimeDifference(row.Diff)))
+	}
+	if row.Inverted {
+		parts = append(parts, "Annan ordning")
+	}
+	if row.Problem != "" {
+		parts = append(parts, row.Problem)
+	}
+	if len(parts) == 0 {
+		return "OK"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Läs reservtider ur rader från en fil. Med startnummer används första kolumnen som
+// startnummer och andra som tid. I målordning räcker en kolumn med tider, finns två
+// används den andra och den första som startnummer. Rader som inte går att använda
+// returneras som problem.
+func backupTimesFromRows(race Race, rows []ImportRow, byBib bool) ([]BackupTime, []string) {
+	var backup []BackupTime
+	var problems []string
+	for _, row := range rows {
+		chip, text := row.Chip, row.Text
+		if !byBib && text == "" {
+			chip, text = "", row.Chip
+		}
+
+		recordTime, err := parseImportTime(race, text)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Rad %d: %v", row.Line, err))
+			continue
+		}
+		if byBib && chip == "" {
+			problems = append(problems, fmt.Sprintf("Rad %d: Startnummer saknas", row.Line))
+			continue
+		}
+		backup = append(backup, BackupTime{Line: row.Line, Chip: chip, Time: recordTime})
+	}
+	return backup, problems
+}
+
+// Ställ loppets chiptider mot reservtider, parade på startnummer eller på målordning.
+// Rader där tiderna skiljer mer än toleransen, där någon sida saknas eller där reservtiden
+// ger en annan inbördes ordning markeras. Reservtiden kan användas där det finns ett känt startnummer.
+// I målordning paras tiderna ihop efter tid inom toleransen, så att en läsning som saknas
+// på ena sidan inte förskjuter resten. Där kan ordningen inte jämföras, eftersom reservtiderna
+// bara har en ordning och den är densamma som tidernas.
+func reconcileTimes(race Race, results []ChipResult, backup []BackupTime, byBib bool, tolerance time.Duration) []ReconcileRow {
+	finished := selectFinishResults(race, results)
+	var rows []ReconcileRow
+
+	if byBib {
+		backupByChip := make(map[string]*BackupTime)
+		var extra []BackupTime
+		for i := range backup {
+			if _, exists := backupByChip[backup[i].Chip]; exists {
+				extra = append(extra, backup[i])
+				continue
+			}
+			backupByChip[backup[i].Chip] = &backup[i]
+		}
+
+		used := make(map[string]bool)
+		for i := range finished {
+			row := ReconcileRow{Chip: finished[i].Chip, Primary: &finished[i], Backup: backupByChip[finished[i].Chip]}
+			used[row.Chip] = true
+			rows = append(rows, row)
+		}
+
+		var missing []ReconcileRow
+		for chip, b := range backupByChip {
+			if !used[chip] {
+				missing = append(missing, ReconcileRow{Chip: chip, Backup: b})
+			}
+		}
+		for i := range extra {
+			missing = append(missing, ReconcileRow{
+				Chip:    extra[i].Chip,
+				Backup:  &extra[i],
+				Problem: fmt.Sprintf("Startnumret finns redan på rad %d", backupByChip[extra[i].Chip].Line),
+			})
+		}
+		sort.SliceStable(missing, func(i, j int) bool {
+			return missing[i].Backup.Time.Before(missing[j].Backup.Time)
+		})
+		rows = append(rows, missing...)
+	} else {
+		rows = alignByFinishOrder(finished, backup, tolerance)
+	}
+
+	// Skillnader och ordning jämförs i chiptidernas ordning
+	var latestBackup *BackupTime
+	for i := range rows {
+		row := &rows[i]
+		if row.Primary != nil && row.Backup != nil {
+			row.Diff = row.Backup.Time.Sub(row.Primary.Time)
+			row.Differs = row.Diff > tolerance || row.Diff < -tolerance
+			if byBib && latestBackup != nil && latestBackup.Time.Sub(row.Backup.Time) > tolerance {
+				row.Inverted = true
+			}
+			if latestBackup == nil || row.Backup.Time.After(latestBackup.Time) {
+				latestBackup = row.Backup
+			}
+		}
+
+		switch {
+		case row.Backup == nil || row.matches() || row.Problem != "":
+		case row.Chip == "":
+			row.Problem = "Startnummer saknas"
+		case !race.Chips[row.Chip]:
+			row.Problem = "Okänt startnummer"
+		case row.Primary != nil && row.Diff == 0:
+		default:
+			if err := checkManualTimeLimit(race, row.Backup.Time); err != nil {
+				row.Problem = err.Error()
+				continue
+			}
+			row.Acceptable = true
+		}
+	}
+	return rows
+}
+
+// Para ihop chiptider och reservtider i målordning. Båda sorteras efter tid och en chiptid
+// paras med nästa reservtid om de ligger inom toleransen, annars räknas den tidigaste av
+// dem som saknad på andra sidan. Raderna kommer i tidsordning.
+func alignByFinishOrder(finished []ChipResult, backup []BackupTime, tolerance time.Duration) []ReconcileRow {
+	sorted := append([]BackupTime{}, backup...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	var rows []ReconcileRow
+	i, j := 0, 0
+	for i < len(finished) || j < len(sorted) {
+		switch {
+		case j == len(sorted):
+			rows = append(rows, ReconcileRow{Chip: finished[i].Chip, Primary: &finished[i]})
+			i++
+		case i == len(finished):
+			rows = append(rows, ReconcileRow{Chip: sorted[j].Chip, Backup: &sorted[j]})
+			j++
+		default:
+			diff := sorted[j].Time.Sub(finished[i].Time)
+			switch {
+			case diff <= tolerance && diff >= -tolerance:
+				rows = append(rows, ReconcileRow{Chip: finished[i].Chip, Primary: &finished[i], Backup: &sorted[j]})
+				i++
+				j++
+			case diff > 0:
+				rows = append(rows, ReconcileRow{Chip: finished[i].Chip, Primary: &finished[i]})
+				i++
+			default:
+				rows = append(rows, ReconcileRow{Chip: sorted[j].Chip, Backup: &sorted[j]})
+				j++
+			}
+		}
+	}
+	return rows
+}
@@ -0,0 +1,230 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/jimmitjoo/hogby-tidtagning/internal/timeformat"
+)
+
+// Avstämning av loppets chiptider mot en reservtidtagning från fil
+func showReconcile(race *Race, races []Race, index int, app fyne.App, onChange func()) {
+	window := app.NewWindow(fmt.Sprintf("Avstämning - %s", race.Name))
+
+	var fileRows []ImportRow
+	var rows []ReconcileRow
+	var fileProblems []string
+	fileName := ""
+
+	sourceLabel := widget.NewLabel("Ingen reservtid vald")
+	summaryLabel := widget.NewLabel("")
+	list := container.NewVBox()
+
+	modeRadio := widget.NewRadioGroup([]string{reconcileByBib, reconcileByOrder}, nil)
+	modeRadio.Horizontal = true
+	modeRadio.SetSelected(reconcileByBib)
+
+	toleranceEntry := widget.NewEntry()
+	toleranceEntry.SetText(strconv.Itoa(int(defaultReconcileTolerance / time.Second)))
+	onlyDeviationsCheck := widget.NewCheck("Visa bara avvikelser", nil)
+	onlyDeviationsCheck.SetChecked(true)
+
+	acceptButton := widget.NewButton("Använd reservtid för valda", nil)
+	acceptButton.Importance = widget.HighImportance
+	editable := raceResultsEditable(*race)
+
+	updateSummary := func() {
+		deviations, accepted := 0, 0
+		for _, row := range rows {
+			if !row.matches() {
+				deviations++
+			}
+			if row.Accept {
+				accepted++
+			}
+		}
+		summaryLabel.SetText(fmt.Sprintf("%d rader, %d avvikelser, %d valda", len(rows), deviations, accepted))
+		if accepted > 0 && editable {
+			acceptButton.Enable()
+		} else {
+			acceptButton.Disable()
+		}
+	}
+
+	refresh := func() {
+		list.RemoveAll()
+		if fileRows == nil {
+			updateSummary()
+			return
+		}
+
+		tolerance := defaultReconcileTolerance
+		if seconds, err := strconv.Atoi(strings.TrimSpace(toleranceEntry.Text)); err == nil && seconds >= 0 {
+			tolerance = time.Duration(seconds) * time.Second
+		}
+
+		byBib := modeRadio.Selected != reconcileByOrder
+		var backup []BackupTime
+		backup, fileProblems = backupTimesFromRows(*race, fileRows, byBib)
+		rows = reconcileTimes(*race, getAllResults(*race), backup, byBib, tolerance)
+
+		source := fmt.Sprintf("%s - %d reservtider", fileName, len(backup))
+		if len(fileProblems) > 0 {
+			source += fmt.Sprintf(", %d rader kunde inte läsas", len(fileProblems))
+		}
+		sourceLabel.SetText(source)
+
+		for i := range rows {
+			i := i
+			row := rows[i]
+			if onlyDeviationsCheck.Checked && row.matches() {
+				continue
+			}
+
+			check := widget.NewCheck("", func(checked bool) {
+				rows[i].Accept = checked
+				updateSummary()
+			})
+			if !row.Acceptable || !editable {
+				check.Disable()
+			}
+
+			primaryText, backupText, placeText := "-", "-", ""
+			if row.Primary != nil {
+				primaryText = timeformat.Duration(row.Primary.Duration)
+				if row.Primary.Manual {
+					primaryText += " (manuell)"
+				}
+			}
+			if row.Backup != nil {
+				backupText = timeformat.Duration(row.Backup.Time.Sub(race.StartTime))
+				placeText = fmt.Sprintf("Rad %d", row.Backup.Line)
+			}
+
+			status := widget.NewLabel(row.status())
+			switch {
+			case row.matches():
+			case row.Primary == nil || row.Backup == nil || row.Problem != "":
+				status.Importance = widget.DangerImportance
+			default:
+				status.Importance = widget.WarningImportance
+			}
+
+			list.Add(container.NewBorder(nil, nil,
+				container.NewHBox(
+					check,
+					widget.NewLabel(row.Chip),
+					widget.NewLabel(participantName(*race, row.Chip)),
+					widget.NewLabel("Chip: "+primaryText),
+					widget.NewLabel("Reserv: "+backupText),
+					widget.NewLabel(placeText),
+				),
+				nil,
+				status))
+		}
+		list.Refresh()
+		updateSummary()
+	}
+
+	modeRadio.OnChanged = func(string) { refresh() }
+	toleranceEntry.OnSubmitted = func(string) { refresh() }
+	onlyDeviationsCheck.OnChanged = func(bool) { refresh() }
+
+	openButton := widget.NewButton("Välj reservtider...", func() {
+		d := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+			if reader == nil {
+				return
+			}
+			defer reader.Close()
+
+			imported, err := readTimeImport(*race, reader)
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+			fileRows = imported
+			if fileRows == nil {
+				fileRows = []ImportRow{}
+			}
+			fileName = reader.URI().Name()
+			refresh()
+		}, window)
+		d.Resize(fyne.NewSize(1200, 800))
+		d.Show()
+	})
+
+	problemsButton := widget.NewButton("Olästa rader", func() {
+		if len(fileProblems) == 0 {
+			dialog.ShowInformation("Olästa rader", "Alla rader i filen kunde läsas", window)
+			return
+		}
+		dialog.ShowInformation("Olästa rader", strings.Join(fileProblems, "\n"), window)
+	})
+
+	acceptButton.OnTapped = func() {
+		accepted := 0
+		var problems []string
+		for _, row := range rows {
+			if !row.Accept || !row.Acceptable {
+				continue
+			}
+			entry := newManualTimeEntry(*race, row.Chip, row.Backup.Time, "")
+			if _, err := recordJournalEntry(race, entry); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", row.Chip, err))
+				continue
+			}
+			accepted++
+		}
+
+		if accepted > 0 {
+			races[index] = *race
+			if err := saveRace(*race); err != nil {
+				dialog.ShowError(err, window)
+			}
+			onChange()
+		}
+		getLogger().Log("Använde %d reservtider från %s i %s", accepted, fileName, race.Name)
+		refresh()
+
+		message := fmt.Sprintf("Använde reservtiden för %d startnummer", accepted)
+		if len(problems) > 0 {
+			message += "\n\nKunde inte spara:\n" + strings.Join(problems, "\n")
+		}
+		dialog.ShowInformation("Avstämning", message, window)
+	}
+
+	if !editable {
+		dialog.ShowError(raceLockedError(*race), window)
+	}
+	refresh()
+
+	window.SetContent(container.NewPadded(container.NewBorder(
+		container.NewVBox(
+			widget.NewLabel("Jämför chiptiderna med en reservtidtagning, t.ex. en stoppur eller ett andra system. Filen har startnummer och tid, eller bara tider i målordning."),
+			container.NewHBox(openButton, problemsButton, sourceLabel),
+			container.NewHBox(
+				widget.NewLabel("Para ihop på"), modeRadio,
+				widget.NewLabel("Tolerans (sekunder)"), container.NewGridWrap(fyne.NewSize(80, toleranceEntry.MinSize().Height), toleranceEntry),
+				onlyDeviationsCheck,
+			),
+			summaryLabel,
+		),
+		container.NewHBox(acceptButton),
+		nil, nil,
+		container.NewVScroll(list),
+	)))
+	window.Resize(fyne.NewSize(1100, 700))
+	window.Show()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Raderna i kort form: startnummer, C om chiptid finns, R om reservtid finns,
+// D vid skillnad över toleransen och O vid annan ordning
+func describeReconcileRows(rows []ReconcileRow) string {
+	var parts []string
+	for _, row := range rows {
+		flags := ""
+		if row.Primary != nil {
+			flags += "C"
+		}
+		if row.Backup != nil {
+			flags += "R"
+		}
+		if row.Differs {
+			flags += "D"
+		}
+		if row.Inverted {
+			flags += "O"
+		}
+		parts = append(parts, fmt.Sprintf("%s:%s", row.Chip, flags))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestReconcileTimes(t *testing.T) {
+	race := testRace("")
+	race.Chips["3"] = true
+	at := func(seconds int) time.Time {
+		return race.StartTime.Add(40*time.Minute + time.Duration(seconds)*time.Second)
+	}
+	result := func(chip string, seconds int) ChipResult {
+		return ChipResult{Chip: chip, Time: at(seconds), Duration: at(seconds).Sub(race.StartTime)}
+	}
+	results := []ChipResult{result("1", 0), result("2", 60), result("3", 120)}
+
+	tests := []struct {
+		name   string
+		byBib  bool
+		backup []BackupTime
+		want   string
+	}{
+		{"målordning, allt stämmer", false,
+			[]BackupTime{{Time: at(1)}, {Time: at(60)}, {Time: at(119)}},
+			"1:CR 2:CR 3:CR"},
+		{"målordning, reservtid saknas", false,
+			[]BackupTime{{Time: at(1)}, {Time: at(120)}},
+			"1:CR 2:C 3:CR"},
+		{"målordning, chiptid saknas", false,
+			[]BackupTime{{Time: at(0)}, {Time: at(30)}, {Time: at(60)}, {Time: at(120)}},
+			"1:CR :R 2:CR 3:CR"},
+		{"målordning, osorterad fil", false,
+			[]BackupTime{{Time: at(120)}, {Time: at(0)}, {Time: at(60)}},
+			"1:CR 2:CR 3:CR"},
+		{"startnummer, skillnad", true,
+			[]BackupTime{{Chip: "1", Time: at(5)}, {Chip: "2", Time: at(60)}, {Chip: "3", Time: at(120)}},
+			"1:CRD 2:CR 3:CR"},
+		{"startnummer, annan ordning", true,
+			[]BackupTime{{Chip: "1", Time: at(90)}, {Chip: "2", Time: at(0)}, {Chip: "3", Time: at(120)}},
+			"1:CRD 2:CRDO 3:CR"},
+		{"startnummer, ordning inom toleransen", true,
+			[]BackupTime{{Chip: "1", Time: at(2)}, {Chip: "2", Time: at(60)}, {Chip: "3", Time: at(120)}},
+			"1:CR 2:CR 3:CR"},
+		{"startnummer, saknas på båda sidor", true,
+			[]BackupTime{{Chip: "1", Time: at(0)}, {Chip: "9", Time: at(200)}},
+			"1:CR 2:C 3:C 9:R"},
+	}
+	for _, tt := range tests {
+		rows := reconcileTimes(race, results, tt.backup, tt.byBib, defaultReconcileTolerance)
+		if got := describeReconcileRows(rows); got != tt.want {
+			t.Errorf("%s: fick %q, väntade %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReconcileTimesProblems(t *testing.T) {
+	race := testRace("")
+	start := race.StartTime
+	results := []ChipResult{{Chip: "1", Time: start.Add(40 * time.Minute), Duration: 40 * time.Minute}}
+	backup := []BackupTime{
+		{Line: 1, Chip: "1", Time: start.Add(41 * time.Minute)},
+		{Line: 2, Chip: "1", Time: start.Add(42 * time.Minute)},
+		{Line: 3, Chip: "9", Time: start.Add(43 * time.Minute)},
+		{Line: 4, Chip: "2", Time: start.Add(44 * time.Minute)},
+	}
+	rows := reconcileTimes(race, results, backup, true, defaultReconcileTolerance)
+
+	want := map[int]struct {
+		problem    string
+		acceptable bool
+	}{
+		1: {"", true},
+		2: {"Startnumret finns redan på rad 1", false},
+		3: {"Okänt startnummer", false},
+		4: {"", true},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("fick %s", describeReconcileRows(rows))
+	}
+	for _, row := range rows {
+		w := want[row.Backup.Line]
+		if row.Problem != w.problem || row.Acceptable != w.acceptable {
+			t.Errorf("rad %d: fick %q %v, väntade %q %v", row.Backup.Line, row.Problem, row.Acceptable, w.problem, w.acceptable)
+		}
+	}
+}
+
+func TestBackupTimesFromRows(t *testing.T) {
+	race := testRace("")
+	rows := []ImportRow{
+		{Line: 1, Chip: "00:40:00"},
+		{Line: 2, Chip: "2", Text: "41:00"},
+		{Line: 3, Chip: "DNF"},
+	}
+
+	backup, problems := backupTimesFromRows(race, rows, false)
+	if len(backup) != 2 || backup[0].Chip != "" || backup[1].Chip != "2" || len(problems) != 1 {
+		t.Errorf("målordning: fick %+v, problem %v", backup, problems)
+	}
+
+	backup, problems = backupTimesFromRows(race, rows, true)
+	if len(backup) != 1 || backup[0].Line != 2 || len(problems) != 2 {
+		t.Errorf("startnummer: fick %+v, problem %v", backup, problems)
+	}
+}
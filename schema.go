@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Nuvarande version av formatet i races.json
+const currentSchemaVersion = 4
+
+// Formatet som races.json sparas i
+type racesFile struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Races         []Race `json:"races"`
+}
+
+// races.json i obearbetad form medan den migreras, loppen hålls som fria JSON-objekt
+// så att migreringar kan läsa och skriva fält som inte längre finns i Race
+type racesDocument struct {
+	SchemaVersion int                      `json:"schemaVersion"`
+	Races         []map[string]interface{} `json:"races"`
+}
+
+// Migreringar där nyckeln är versionen som uppgraderas till nästa version
+var raceMigrations = map[int]func(doc *racesDocument) error{
+	1: migrateRacesV1ToV2,
+	2: migrateRacesV2ToV3,
+	3: migrateRacesV3ToV4,
+}
+
+// Tolka innehållet i races.json oavsett version och uppgradera till nuvarande format.
+// Returnerar även vilken version filen hade innan migreringen.
+func parseRacesData(data []byte) ([]Race, int, error) {
+	doc, err := decodeRacesDocument(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	originalVersion := doc.SchemaVersion
+
+	if doc.SchemaVersion > currentSchemaVersion {
+		return nil, originalVersion, fmt.Errorf("races.json har version %d men programmet stödjer bara till version %d, uppdatera programmet",
+			doc.SchemaVersion, currentSchemaVersion)
+	}
+
+	for doc.SchemaVersion < currentSchemaVersion {
+		migrate, exists := raceMigrations[doc.SchemaVersion]
+		if !exists {
+			return nil, originalVersion, fmt.Errorf("saknar migrering från version %d", doc.SchemaVersion)
+		}
+		if err := migrate(&doc); err != nil {
+			return nil, originalVersion, fmt.Errorf("kunde inte migrera från version %d: %v", doc.SchemaVersion, err)
+		}
+		doc.SchemaVersion++
+	}
+
+	racesData, err := json.Marshal(doc.Races)
+	if err != nil {
+		return nil, originalVersion, err
+	}
+
+	races := []Race{}
+	if err := json.Unmarshal(racesData, &races); err != nil {
+		return nil, originalVersion, err
+	}
+	return races, originalVersion, nil
+}
+
+// Läs in races.json som ett dokument och ta reda på vilken version den har.
+// Äldre filer utan version är antingen en lista med lopp eller ett objekt med fältet races,
+// båda räknas som version 1.
+func decodeRacesDocument(data []byte) (racesDocument, error) {
+	doc := racesDocument{}
+	trimmed := bytes.TrimSpace(data)
+
+	if len(trimmed) == 0 {
+		return doc, fmt.Errorf("filen är tom")
+	}
+
+	if trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &doc.Races); err != nil {
+			return doc, err
+		}
+		doc.SchemaVersion = 1
+		return doc, nil
+	}
+
+	if err := json.Unmarshal(trimmed, &doc); err != nil {
+		return doc, err
+	}
+	if doc.SchemaVersion == 0 {
+		doc.SchemaVersion = 1
+	}
+	return doc, nil
+}
+
+// Version 2 kräver att alla lopp har chip- och felmarkeringslistor
+func migrateRacesV1ToV2(doc *racesDocument) error {
+	if doc.Races == nil {
+		doc.Races = []map[string]interface{}{}
+	}
+	for _, race := range doc.Races {
+		if race["chips"] == nil {
+			race["chips"] = map[string]interface{}{}
+		}
+		if race["invalidTimes"] == nil {
+			race["invalidTimes"] = map[string]interface{}{}
+		}
+		if minTime, ok := race["minTime"].(string); !ok || minTime == "" {
+			race["minTime"] = "0s"
+		}
+	}
+	return nil
+}
+
+// Version 3 ger varje lopp ett ID som inte ändras när loppet byter namn.
+// Filerna som hörde till loppets namn flyttas av loadRaces efter migreringen.
+func migrateRacesV2ToV3(doc *racesDocument) error {
+	for _, race := range doc.Races {
+		if id, ok := race["id"].(string); !ok || id == "" {
+			race["id"] = newID()
+		}
+	}
+	return nil
+}
+
+// Version 4 ger varje lopp en status, härledd från om filen övervakas och när loppet startar
+func migrateRacesV3ToV4(doc *racesDocument) error {
+	now := time.Now()
+	for _, race := range doc.Races {
+		if status, ok := race["status"].(string); ok && status != "" {
+			continue
+		}
+		liveUpdate, _ := race["liveUpdate"].(bool)
+		var startTime time.Time
+		if text, ok := race["startTime"].(string); ok {
+			startTime, _ = time.Parse(time.RFC3339Nano, text)
+		}
+		race["status"] = inferRaceStatus(liveUpdate, startTime, now)
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testTime = time.Date(2026, 5, 17, 10, 30, 15, 123000000, time.UTC)
+
+// Fyll i ett värde som inte är nollvärdet, så att ett fält som tappas vid sparning syns.
+// Nya fälttyper som testet inte känner till får testet att fallera tills de läggs till här.
+func fillTestValue(t *testing.T, v reflect.Value, name string) {
+	t.Helper()
+
+	switch {
+	case v.Type() == reflect.TypeOf(time.Time{}):
+		v.Set(reflect.ValueOf(testTime.Add(time.Duration(len(name)) * time.Minute)))
+		return
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		v.SetInt(int64(time.Duration(len(name))*time.Minute + 7*time.Second))
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(name + "-värde")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int64:
+		v.SetInt(int64(len(name) + 1))
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			fillTestValue(t, v.Field(i), name+"."+field.Name)
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			t.Fatalf("%s: kan inte fylla i map med nyckeltyp %s", name, v.Type().Key())
+		}
+		m := reflect.MakeMap(v.Type())
+		elem := reflect.New(v.Type().Elem()).Elem()
+		fillTestValue(t, elem, name+"[]")
+		m.SetMapIndex(reflect.ValueOf(name+"-nyckel"), elem)
+		v.Set(m)
+	case reflect.Slice:
+		s := reflect.MakeSlice(v.Type(), 1, 1)
+		fillTestValue(t, s.Index(0), name+"[0]")
+		v.Set(s)
+	case reflect.Ptr:
+		p := reflect.New(v.Type().Elem())
+		fillTestValue(t, p.Elem(), name)
+		v.Set(p)
+	default:
+		t.Fatalf("%s: testet kan inte fylla i typen %s, lägg till den i fillTestValue", name, v.Type())
+	}
+}
+
+// Jämför alla exporterade fält och rapportera vilka som tappats eller ändrats
+func compareFields(t *testing.T, want, got interface{}) {
+	t.Helper()
+	wantValue := reflect.ValueOf(want)
+	gotValue := reflect.ValueOf(got)
+	for i := 0; i < wantValue.NumField(); i++ {
+		field := wantValue.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if !reflect.DeepEqual(wantValue.Field(i).Interface(), gotValue.Field(i).Interface()) {
+			t.Errorf("fältet %s följde inte med: sparat %v, läst %v",
+				field.Name, wantValue.Field(i).Interface(), gotValue.Field(i).Interface())
+		}
+	}
+}
+
+func TestRaceRoundTrip(t *testing.T) {
+	useTestWorkspace(t)
+
+	var race Race
+	fillTestValue(t, reflect.ValueOf(&race).Elem(), "Race")
+
+	if err := saveRaces([]Race{race}); err != nil {
+		t.Fatalf("saveRaces: %v", err)
+	}
+	loaded, err := loadRaces()
+	if err != nil {
+		t.Fatalf("loadRaces: %v", err)
+	}
+	if len(loaded) != 1 {
+		t.Fatalf("väntade 1 lopp, fick %d", len(loaded))
+	}
+	compareFields(t, race, loaded[0])
+}
+
+func TestChipResultRoundTrip(t *testing.T) {
+	useTestWorkspace(t)
+
+	var result ChipResult
+	fillTestValue(t, reflect.ValueOf(&result).Elem(), "ChipResult")
+
+	if err := cacheResults("lopp", []ChipResult{result}); err != nil {
+		t.Fatalf("cacheResults: %v", err)
+	}
+	data, err := os.ReadFile(resultsCacheFilename("lopp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded []ChipResult
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatalf("kunde inte läsa cachade resultat: %v", err)
+	}
+	if len(loaded) != 1 {
+		t.Fatalf("väntade 1 resultat, fick %d", len(loaded))
+	}
+	compareFields(t, result, loaded[0])
+}
+
+func TestMigrateRacesV1ToV2(t *testing.T) {
+	doc := racesDocument{
+		SchemaVersion: 1,
+		Races: []map[string]interface{}{
+			{"name": "Utan listor"},
+			{"name": "Med listor", "chips": map[string]interface{}{"1": true}, "minTime": "10m0s"},
+		},
+	}
+	if err := migrateRacesV1ToV2(&doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, race := range doc.Races {
+		if race["chips"] == nil || race["invalidTimes"] == nil {
+			t.Errorf("%s saknar chip- eller felmarkeringslista efter migrering", race["name"])
+		}
+	}
+	if doc.Races[0]["minTime"] != "0s" {
+		t.Errorf("minTime = %v, väntade 0s", doc.Races[0]["minTime"])
+	}
+	if doc.Races[1]["minTime"] != "10m0s" {
+		t.Errorf("befintlig minTime ändrades till %v", doc.Races[1]["minTime"])
+	}
+	if chips := doc.Races[1]["chips"].(map[string]interface{}); chips["1"] != true {
+		t.Errorf("befintliga chip försvann: %v", chips)
+	}
+}
+
+func TestMigrateRacesV2ToV3(t *testing.T) {
+	doc := racesDocument{
+		SchemaVersion: 2,
+		Races: []map[string]interface{}{
+			{"name": "Utan ID"},
+			{"name": "Med ID", "id": "abc"},
+		},
+	}
+	if err := migrateRacesV2ToV3(&doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if id, _ := doc.Races[0]["id"].(string); id == "" {
+		t.Errorf("loppet fick inget ID")
+	}
+	if doc.Races[1]["id"] != "abc" {
+		t.Errorf("befintligt ID ändrades till %v", doc.Races[1]["id"])
+	}
+}
+
+func TestMigrateRacesV3ToV4(t *testing.T) {
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339Nano)
+	future := time.Now().Add(time.Hour).Format(time.RFC3339Nano)
+	doc := racesDocument{
+		SchemaVersion: 3,
+		Races: []map[string]interface{}{
+			{"name": "Övervakas", "liveUpdate": true, "startTime": past},
+			{"name": "Framtida", "startTime": future},
+			{"name": "Passerat", "startTime": past},
+			{"name": "Har status", "startTime": past, "status": RaceStatusOfficial},
+		},
+	}
+	if err := migrateRacesV3ToV4(&doc); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{RaceStatusStarted, RaceStatusPlanned, RaceStatusFinished, RaceStatusOfficial}
+	for i, race := range doc.Races {
+		if race["status"] != want[i] {
+			t.Errorf("%s fick status %v, väntade %s", race["name"], race["status"], want[i])
+		}
+	}
+}
+
+func TestParseRacesDataMigratesAllSteps(t *testing.T) {
+	data := []byte(`[{"name":"Milen","startTime":"2020-05-17T10:00:00Z","minTime":"10m0s","resultsFile":"milen.txt"}]`)
+
+	races, version, err := parseRacesData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 {
+		t.Errorf("version = %d, väntade 1", version)
+	}
+	if len(races) != 1 {
+		t.Fatalf("väntade 1 lopp, fick %d", len(races))
+	}
+
+	race := races[0]
+	if race.Name != "Milen" || race.ResultsFile != "milen.txt" || race.MinTime != 10*time.Minute {
+		t.Errorf("befintliga fält ändrades: %+v", race)
+	}
+	if race.Chips == nil || race.InvalidTimes == nil {
+		t.Errorf("chip- eller felmarkeringslista saknas")
+	}
+	if race.ID == "" {
+		t.Errorf("loppet fick inget ID")
+	}
+	if race.Status != RaceStatusFinished {
+		t.Errorf("status = %s, väntade %s", race.Status, RaceStatusFinished)
+	}
+}
+
+func TestParseRacesDataRejectsNewerVersion(t *testing.T) {
+	_, _, err := parseRacesData([]byte(`{"schemaVersion": 99, "races": []}`))
+	if err == nil {
+		t.Fatal("väntade fel för en nyare version")
+	}
+}
+
+func TestLoadRacesMigratesFileAndLegacyNames(t *testing.T) {
+	useTestWorkspace(t)
+
+	data := []byte(`{"races":[{"name":"Milen","startTime":"2020-05-17T10:00:00Z","minTime":"0s"}]}`)
+	if err := os.WriteFile(racesFilename(), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	legacy := []ManualTime{{ID: "m1", Chip: "1", Time: testTime, RaceName: "Milen"}}
+	if err := writeJSONAtomic(dataPath("manual_times_Milen.json"), legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	races, err := loadRaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := os.ReadFile(racesFilename())
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := decodeRacesDocument(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.SchemaVersion != currentSchemaVersion {
+		t.Errorf("races.json sparades med version %d, väntade %d", doc.SchemaVersion, currentSchemaVersion)
+	}
+
+	manualTimes, err := loadManualTimes(races[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manualTimes) != 1 || manualTimes[0].RaceID != races[0].ID {
+		t.Errorf("manuella tider flyttades inte till loppets ID: %+v", manualTimes)
+	}
+	if _, err := os.Stat(dataPath("manual_times_Milen.json")); !os.IsNotExist(err) {
+		t.Errorf("filen med loppets namn finns kvar")
+	}
+}
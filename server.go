@@ -0,0 +1,551 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Hur ofta servern kontrollerar om races.json har ändrats av något annat program
+const serverReloadInterval = 2 * time.Second
+
+// Serverläge utan grafiskt gränssnitt: övervakar läsarfilerna och visar läget över HTTP.
+// När gränssnittet redan övervakar läsarfilerna startar servern inga egna övervakningar
+// utan läser bara om resultaten när filerna ändras. Ändringar via API:et kräver token
+// och onChange anropas efteråt så att gränssnittet kan läsa om loppen.
+type timingServer struct {
+	mu             sync.RWMutex
+	races          []Race
+	results        map[string][]ChipResult
+	manualTimes    map[string][]ManualTime
+	updatedAt      map[string]time.Time
+	sources        map[string]string
+	watched        map[string]string
+	racesModTime   time.Time
+	startedAt      time.Time
+	state          *WatchState
+	editGuard      func(race Race) error
+	events         *eventHub
+	manageWatchers bool
+	token          string
+	onChange       func(raceID string)
+}
+
+// Sammanfattning av ett lopp i API:et
+type RaceSummary struct {
+	ID               string        `json:"id"`
+	Name             string        `json:"name"`
+	Status           string        `json:"status"`
+	StartTime        time.Time     `json:"startTime"`
+	LiveUpdate       bool          `json:"liveUpdate"`
+	Watching         bool          `json:"watching"`
+	Registered       int           `json:"registered"`
+	Finished         int           `json:"finished"`
+	ResultsUpdatedAt time.Time     `json:"resultsUpdatedAt"`
+	ReaderHealth     *ReaderHealth `json:"readerHealth,omitempty"`
+}
+
+// editGuard kan lämnas tom, gränssnittet använder den för att stoppa ändringar av lopp
+// som har ett öppet resultatfönster.
+func newTimingServer(state *WatchState, editGuard func(race Race) error, manageWatchers bool, token string, onChange func(raceID string)) *timingServer {
+	return &timingServer{
+		results:        make(map[string][]ChipResult),
+		manualTimes:    make(map[string][]ManualTime),
+		updatedAt:      make(map[string]time.Time),
+		sources:        make(map[string]string),
+		watched:        make(map[string]string),
+		startedAt:      time.Now(),
+		state:          state,
+		editGuard:      editGuard,
+		events:         newEventHub(),
+		manageWatchers: manageWatchers,
+		token:          token,
+		onChange:       onChange,
+	}
+}
+
+// Alla lopp som servern känner till just nu
+func (s *timingServer) getRaces() []Race {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Race{}, s.races...)
+}
+
+// Hitta ett lopp på ID
+func (s *timingServer) getRace(raceID string) (Race, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, race := range s.races {
+		if race.ID == raceID {
+			return race, true
+		}
+	}
+	return Race{}, false
+}
+
+// Spara nya resultat för ett lopp och skicka ut det som ändrats som händelser
+func (s *timingServer) setResults(race Race, results []ChipResult) {
+	manualTimes, err := loadManualTimes(race.ID)
+	if err != nil {
+		getLogger().Log("Kunde inte läsa manuella tider för %s: %v", race.Name, err)
+	}
+	var raceManualTimes []ManualTime
+	for _, mt := range manualTimes {
+		if mt.RaceID == race.ID {
+			raceManualTimes = append(raceManualTimes, mt)
+		}
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	events := diffRaceEvents(race, s.results[race.ID], results, s.manualTimes[race.ID], raceManualTimes, now)
+	s.results[race.ID] = results
+	s.manualTimes[race.ID] = raceManualTimes
+	s.updatedAt[race.ID] = now
+	s.mu.Unlock()
+
+	s.events.publish(events)
+}
+
+// Ändringstider för filerna som loppets resultat räknas fram ur
+func raceSourceStamp(race Race) string {
+	var stamp string
+	for _, filename := range []string{race.ResultsFile, manualTimesFilename(race.ID), journalFilename(race.ID)} {
+		modTime, _ := getFileModTime(filename)
+		stamp += modTime.String() + "|"
+	}
+	return stamp
+}
+
+// Räkna om resultaten för lopp vars läsarfil, manuella tider eller journal har ändrats
+// sedan förra gången, till exempel av gränssnittet eller kommandoraden
+func (s *timingServer) refreshResults() {
+	for _, race := range s.getRaces() {
+		stamp := raceSourceStamp(race)
+		s.mu.RLock()
+		unchanged := s.sources[race.ID] == stamp
+		s.mu.RUnlock()
+		if unchanged {
+			continue
+		}
+
+		s.setResults(race, readAllResults(race))
+		s.mu.Lock()
+		s.sources[race.ID] = stamp
+		s.mu.Unlock()
+	}
+}
+
+// Senast beräknade resultat för ett lopp
+func (s *timingServer) getResults(raceID string) ([]ChipResult, time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.results[raceID], s.updatedAt[raceID]
+}
+
+// Läs in races.json och starta eller stoppa filövervakningen så att den stämmer med
+// loppens LiveUpdate. Ett lopp vars inställningar ändrats får en ny övervakning,
+// eftersom övervakningen arbetar med en kopia av loppet.
+func (s *timingServer) reload() error {
+	modTime, _ := getFileModTime(racesFilename())
+	races, err := loadRaces()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.races = races
+	s.racesModTime = modTime
+	s.mu.Unlock()
+
+	active := make(map[string]bool)
+	for _, race := range races {
+		race := race
+		active[race.ID] = true
+		s.setResults(race, readAllResults(race))
+		s.mu.Lock()
+		s.sources[race.ID] = raceSourceStamp(race)
+		s.mu.Unlock()
+		if !s.manageWatchers {
+			continue
+		}
+
+		snapshot, _ := json.Marshal(race)
+		shouldWatch := race.LiveUpdate && race.ResultsFile != ""
+
+		s.mu.Lock()
+		previous, watching := s.watched[race.ID]
+		s.mu.Unlock()
+
+		if watching && (!shouldWatch || previous != string(snapshot)) {
+			s.state.RemoveStopWatcher(race.ID)
+			s.mu.Lock()
+			delete(s.watched, race.ID)
+			s.mu.Unlock()
+			watching = false
+		}
+		if !shouldWatch || watching {
+			continue
+		}
+
+		stopWatcher, err := watchRaceResults(race, func(results []ChipResult) {
+			s.setResults(race, results)
+		})
+		if err != nil {
+			getLogger().Log("Kunde inte starta övervakning för %s: %v", race.Name, err)
+			continue
+		}
+		s.state.AddStopWatcher(race.ID, stopWatcher)
+
+		s.mu.Lock()
+		s.watched[race.ID] = string(snapshot)
+		s.mu.Unlock()
+		getLogger().Log("Server övervakar %s (%s)", race.Name, race.ResultsFile)
+	}
+
+	// Lopp som tagits bort slutar övervakas
+	s.mu.Lock()
+	var removed []string
+	for raceID := range s.watched {
+		if !active[raceID] {
+			removed = append(removed, raceID)
+			delete(s.watched, raceID)
+		}
+	}
+	for raceID := range s.results {
+		if !active[raceID] {
+			delete(s.results, raceID)
+			delete(s.manualTimes, raceID)
+			delete(s.updatedAt, raceID)
+			delete(s.sources, raceID)
+		}
+	}
+	s.mu.Unlock()
+	for _, raceID := range removed {
+		s.state.RemoveStopWatcher(raceID)
+		s.state.RemoveReaderHealth(raceID)
+	}
+
+	return nil
+}
+
+// Läs om races.json när filen ändras och räkna om resultat vars filer ändrats, tills ctx avbryts
+func (s *timingServer) watchRacesFile(ctx context.Context) {
+	ticker := time.NewTicker(serverReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			modTime, err := getFileModTime(racesFilename())
+			if err != nil {
+				continue
+			}
+			s.mu.RLock()
+			changed := modTime.After(s.racesModTime)
+			s.mu.RUnlock()
+			if !changed {
+				s.refreshResults()
+				continue
+			}
+
+			getLogger().Log("races.json har ändrats, läser in loppen igen")
+			if err := s.reload(); err != nil {
+				getLogger().Log("Kunde inte läsa in loppen igen: %v", err)
+			}
+		}
+	}
+}
+
+// Sammanfattning av ett lopp med övervakning, läsarstatus och antal i mål
+func (s *timingServer) summarize(race Race) RaceSummary {
+	results, updatedAt := s.getResults(race.ID)
+
+	finished := make(map[string]bool)
+	for _, result := range results {
+		if !result.Invalid && !race.DNS[result.Chip] {
+			finished[result.Chip] = true
+		}
+	}
+
+	s.mu.RLock()
+	_, watching := s.watched[race.ID]
+	s.mu.RUnlock()
+
+	summary := RaceSummary{
+		ID:               race.ID,
+		Name:             race.Name,
+		Status:           raceStatus(race),
+		StartTime:        race.StartTime,
+		LiveUpdate:       race.LiveUpdate,
+		Watching:         watching,
+		Registered:       len(race.Chips),
+		Finished:         len(finished),
+		ResultsUpdatedAt: updatedAt,
+	}
+	if health, exists := s.state.GetReaderHealth(race.ID); exists {
+		summary.ReaderHealth = &health
+	}
+	return summary
+}
+
+// Slutresultat ur de senast beräknade resultaten
+func (s *timingServer) resultRows(race Race) []ResultRow {
+	results, _ := s.getResults(race.ID)
+	return resultRowsFrom(race, results)
+}
+
+// Alla HTTP-vägar som servern svarar på
+func (s *timingServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/status", s.handleStatus)
+	mux.HandleFunc("GET /api/v1/races", s.handleRaces)
+	mux.HandleFunc("GET /api/v1/races/{id}", s.handleRace)
+	mux.HandleFunc("GET /api/v1/races/{id}/results", s.handleResults)
+	mux.HandleFunc("GET /api/v1/races/{id}/health", s.handleHealth)
+	mux.HandleFunc("GET /api/v1/races/{id}/events", s.handleEvents)
+	mux.HandleFunc("GET /api/v1/races/{id}/settings", s.handleRaceSettings)
+	mux.HandleFunc("GET /api/v1/races/{id}/participants", s.handleParticipants)
+	mux.HandleFunc("GET /api/v1/races/{id}/manual-times", s.handleManualTimes)
+
+	// Ändringar kräver API-nyckeln
+	mux.HandleFunc("POST /api/v1/races", s.requireToken(s.handleCreateRace))
+	mux.HandleFunc("PATCH /api/v1/races/{id}", s.requireToken(s.handleUpdateRace))
+	mux.HandleFunc("DELETE /api/v1/races/{id}", s.requireToken(s.handleDeleteRace))
+	mux.HandleFunc("PUT /api/v1/races/{id}/status", s.requireToken(s.handleRaceStatus))
+	mux.HandleFunc("PUT /api/v1/races/{id}/participants/{chip}", s.requireToken(s.handlePutParticipant))
+	mux.HandleFunc("DELETE /api/v1/races/{id}/participants/{chip}", s.requireToken(s.handleDeleteParticipant))
+	mux.HandleFunc("POST /api/v1/races/{id}/manual-times", s.requireToken(s.handleAddManualTime))
+	mux.HandleFunc("DELETE /api/v1/races/{id}/manual-times/{mid}", s.requireToken(s.handleDeleteManualTime))
+	mux.HandleFunc("PUT /api/v1/races/{id}/reads", s.requireToken(s.handleMarkRead))
+
+	mux.HandleFunc("GET /{$}", s.handleIndexPage)
+	mux.HandleFunc("GET /lopp/{id}", s.handleResultsPage)
+	mux.HandleFunc("GET /mal", s.handleFinishIndexPage)
+	mux.HandleFunc("GET /lopp/{id}/mal", s.handleFinishEntryPage)
+	mux.HandleFunc("GET /api/v1/clock", s.handleClock)
+	return mux
+}
+
+// Skriv ett JSON-svar
+func writeJSONResponse(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		getLogger().Log("Kunde inte skriva svar: %v", err)
+	}
+}
+
+// Skriv ett felmeddelande som JSON
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSONResponse(w, status, map[string]string{"error": err.Error()})
+}
+
+// Hämta loppet som anges i sökvägen, eller svara 404
+func (s *timingServer) raceFromRequest(w http.ResponseWriter, r *http.Request) (Race, bool) {
+	race, exists := s.getRace(r.PathValue("id"))
+	if !exists {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("hittade inget lopp med ID %s", r.PathValue("id")))
+		return Race{}, false
+	}
+	return race, true
+}
+
+func (s *timingServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	races := s.getRaces()
+	s.mu.RLock()
+	watching := len(s.watched)
+	s.mu.RUnlock()
+
+	writeJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"event":     workspaceName(),
+		"workspace": workspaceDir,
+		"startedAt": s.startedAt,
+		"races":     len(races),
+		"watching":  watching,
+	})
+}
+
+func (s *timingServer) handleRaces(w http.ResponseWriter, r *http.Request) {
+	summaries := []RaceSummary{}
+	for _, race := range s.getRaces() {
+		summaries = append(summaries, s.summarize(race))
+	}
+	writeJSONResponse(w, http.StatusOK, summaries)
+}
+
+func (s *timingServer) handleRace(w http.ResponseWriter, r *http.Request) {
+	race, ok := s.raceFromRequest(w, r)
+	if !ok {
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, s.summarize(race))
+}
+
+func (s *timingServer) handleResults(w http.ResponseWriter, r *http.Request) {
+	race, ok := s.raceFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// Med all=true skickas alla läsningar inklusive felaktiga
+	if r.URL.Query().Get("all") == "true" {
+		results, _ := s.getResults(race.ID)
+		if results == nil {
+			results = []ChipResult{}
+		}
+		writeJSONResponse(w, http.StatusOK, results)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, s.resultRows(race))
+}
+
+func (s *timingServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	race, ok := s.raceFromRequest(w, r)
+	if !ok {
+		return
+	}
+	health, exists := s.state.GetReaderHealth(race.ID)
+	if !exists {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("ingen läsarstatus för %s", race.Name))
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, health)
+}
+
+// Starta HTTP-servern i bakgrunden. Fel efter att servern startat skickas på kanalen.
+func serveHTTP(addr string, handler http.Handler) (*http.Server, <-chan error, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		if errors.Is(err, syscall.EADDRINUSE) {
+			return nil, nil, fmt.Errorf("kunde inte lyssna på %s: porten används redan, till exempel av en server som startats med serve. Välj en annan port", addr)
+		}
+		return nil, nil, fmt.Errorf("kunde inte lyssna på %s: %v", addr, err)
+	}
+
+	httpServer := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- httpServer.Serve(listener)
+	}()
+	return httpServer, errCh, nil
+}
+
+// Kör servern tills programmet avbryts med Ctrl+C eller SIGTERM. Utan token används
+// evenemangets sparade API-nyckel.
+func runServer(addr, token string, stdout io.Writer) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if token == "" {
+		var err error
+		if token, err = loadAPIToken(); err != nil {
+			return err
+		}
+	}
+
+	state := NewWatchState()
+	server := newTimingServer(state, nil, true, token, nil)
+	if err := server.reload(); err != nil {
+		return err
+	}
+	defer state.StopAll()
+
+	go server.watchRacesFile(ctx)
+	stopReaderMonitor := startReaderMonitor(server.getRaces, state, func() {})
+	defer stopReaderMonitor()
+
+	httpServer, errCh, err := serveHTTP(addr, server.handler())
+	if err != nil {
+		return err
+	}
+
+	getLogger().Log("Server startad på %s för evenemang %s", addr, workspaceDir)
+	fmt.Fprintf(stdout, "Tidtagningsserver för %s lyssnar på http://%s/ (avsluta med Ctrl+C)\n", workspaceName(), addr)
+	fmt.Fprintf(stdout, "Ändringar via API:et kräver Authorization: Bearer %s\n", token)
+	fmt.Fprintf(stdout, "Målregistrering: http://%s/mal?token=%s\n", addr, token)
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	case <-ctx.Done():
+	}
+
+	getLogger().Log("Stänger servern")
+	server.events.close()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return httpServer.Shutdown(shutdownCtx)
+}
+
+// Starta resultatsidorna och API:et från gränssnittet. Gränssnittet sköter övervakningen av
+// läsarfilerna, servern läser bara om resultaten när filerna ändras.
+func startLiveResults(addr string, state *WatchState, editGuard func(race Race) error, onChange func(raceID string)) (func(), error) {
+	token, err := loadAPIToken()
+	if err != nil {
+		return nil, err
+	}
+	server := newTimingServer(state, editGuard, false, token, onChange)
+	if err := server.reload(); err != nil {
+		return nil, err
+	}
+
+	httpServer, errCh, err := serveHTTP(addr, server.handler())
+	if err != nil {
+		return nil, err
+	}
+	getLogger().Log("Resultatsidor startade på %s för evenemang %s", addr, workspaceDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go server.watchRacesFile(ctx)
+	go func() {
+		if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+			getLogger().Log("Resultatsidorna stoppades: %v", err)
+		}
+	}()
+
+	return func() {
+		cancel()
+		server.events.close()
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelShutdown()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			getLogger().Log("Kunde inte stänga resultatsidorna: %v", err)
+		}
+		getLogger().Log("Resultatsidor stoppade")
+	}, nil
+}
+
+// Datorns IPv4-adresser i det lokala nätverket, för att visa var resultatsidorna nås
+func localAddresses() []string {
+	var addresses []string
+	interfaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return addresses
+	}
+	for _, addr := range interfaceAddrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.To4() == nil {
+			continue
+		}
+		addresses = append(addresses, ipNet.IP.String())
+	}
+	return addresses
+}
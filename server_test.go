@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAPIToken = "hemlig-nyckel"
+
+// Starta en server mot ett evenemang med ett lopp med den angivna statusen
+func newTestServer(t *testing.T, status string) (*timingServer, Race) {
+	t.Helper()
+	useTestWorkspace(t)
+
+	race := saveTestRace(t, status)
+
+	server := newTimingServer(NewWatchState(), nil, false, testAPIToken, nil)
+	if err := server.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	return server, race
+}
+
+// Skicka ett anrop till serverns handler, med API-nyckel om token inte är tom
+func doAPIRequest(server *timingServer, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	server.handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPIRejectsMissingOrWrongToken(t *testing.T) {
+	server, race := newTestServer(t, RaceStatusStarted)
+	body := `{"chip":"1","time":"2026-05-17 10:40:00"}`
+
+	for _, token := range []string{"", "fel-nyckel"} {
+		rec := doAPIRequest(server, http.MethodPost, "/api/v1/races/lopp1/manual-times", token, body)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("nyckel %q: status %d, väntade %d", token, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	manualTimes, err := loadManualTimes(race.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manualTimes) != 0 {
+		t.Errorf("tider sparades trots ogiltig nyckel: %+v", manualTimes)
+	}
+
+	// Läsning kräver ingen nyckel
+	if rec := doAPIRequest(server, http.MethodGet, "/api/v1/races/lopp1", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("GET utan nyckel: status %d, väntade %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestAPILockedRaceConflicts(t *testing.T) {
+	server, race := newTestServer(t, RaceStatusOfficial)
+
+	requests := []struct {
+		method, path, body string
+	}{
+		{http.MethodPost, "/api/v1/races/lopp1/manual-times", `{"chip":"1","time":"2026-05-17 10:40:00"}`},
+		{http.MethodPatch, "/api/v1/races/lopp1", `{"name":"Nytt namn"}`},
+		{http.MethodPut, "/api/v1/races/lopp1/participants/3", `{"name":"Ny deltagare"}`},
+	}
+	for _, r := range requests {
+		rec := doAPIRequest(server, r.method, r.path, testAPIToken, r.body)
+		if rec.Code != http.StatusConflict {
+			t.Errorf("%s %s: status %d, väntade %d: %s", r.method, r.path, rec.Code, http.StatusConflict, rec.Body)
+		}
+	}
+
+	races, err := loadRaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if races[0].Name != race.Name || len(races[0].Chips) != len(race.Chips) {
+		t.Errorf("låst lopp ändrades: %+v", races[0])
+	}
+}
+
+func TestAPIManualTimeClientIDIsIdempotent(t *testing.T) {
+	server, race := newTestServer(t, RaceStatusStarted)
+	body := `{"id":"klient-1","chip":"1","time":"2026-05-17 10:40:00"}`
+
+	wantStatus := []int{http.StatusCreated, http.StatusOK}
+	for i, want := range wantStatus {
+		rec := doAPIRequest(server, http.MethodPost, "/api/v1/races/lopp1/manual-times", testAPIToken, body)
+		if rec.Code != want {
+			t.Errorf("anrop %d: status %d, väntade %d: %s", i+1, rec.Code, want, rec.Body)
+		}
+	}
+
+	manualTimes, err := loadManualTimes(race.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manualTimes) != 1 || manualTimes[0].ID != "klient-1" {
+		t.Errorf("väntade en tid med klientens ID, fick %+v", manualTimes)
+	}
+}
+
+func TestServerReloadDoesNotWriteCache(t *testing.T) {
+	server, race := newTestServer(t, RaceStatusStarted)
+	server.refreshResults()
+
+	if _, err := os.Stat(resultsCacheFilename(race.ID)); !os.IsNotExist(err) {
+		t.Errorf("servern skrev resultatcachen")
+	}
+}
+
+func TestServeHTTPReportsPortInUse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	_, _, err = serveHTTP(listener.Addr().String(), http.NotFoundHandler())
+	if err == nil || !strings.Contains(err.Error(), "porten används redan") {
+		t.Errorf("väntade fel om upptagen port, fick %v", err)
+	}
+}
+
+func TestLiveResultsAddr(t *testing.T) {
+	useTestWorkspace(t)
+
+	if addr := loadLiveResultsAddr(); addr != defaultLiveResultsAddr {
+		t.Errorf("fick %q, väntade standardadressen", addr)
+	}
+	if err := saveLiveResultsAddr("127.0.0.1:9000"); err != nil {
+		t.Fatal(err)
+	}
+	if addr := loadLiveResultsAddr(); addr != "127.0.0.1:9000" {
+		t.Errorf("fick %q, väntade den sparade adressen", addr)
+	}
+
+	for _, addr := range []string{"8081", ":0", ":70000", "localhost:abc"} {
+		if err := validateListenAddr(addr); err == nil {
+			t.Errorf("%q godkändes", addr)
+		}
+	}
+	if urls := liveResultsBaseURLs("127.0.0.1:9000"); len(urls) != 1 || urls[0] != "http://127.0.0.1:9000" {
+		t.Errorf("fel adresser: %v", urls)
+	}
+}
+
+func TestAPIRejectsManualTimeWhileRaceIsOpen(t *testing.T) {
+	server, race := newTestServer(t, RaceStatusStarted)
+	server.editGuard = func(Race) error {
+		return fmt.Errorf("resultatfönstret är öppet")
+	}
+
+	rec := doAPIRequest(server, http.MethodPost, "/api/v1/races/lopp1/manual-times", testAPIToken, `{"chip":"1","time":"2026-05-17 10:40:00"}`)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("status %d, väntade %d: %s", rec.Code, http.StatusConflict, rec.Body)
+	}
+	if manualTimes, _ := loadManualTimes(race.ID); len(manualTimes) != 0 {
+		t.Errorf("tiden sparades trots öppet fönster: %+v", manualTimes)
+	}
+}
+
+func TestSaveRaceKeepsOtherRaces(t *testing.T) {
+	_, race := newTestServer(t, RaceStatusStarted)
+	other := Race{ID: "lopp2", Name: "Femman", StartTime: race.StartTime}
+	if err := updateRaces(func(races []Race) ([]Race, error) {
+		return append(races, other), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	race.Name = "Milen, ändrad"
+	if err := saveRace(race); err != nil {
+		t.Fatal(err)
+	}
+	races, err := loadRaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(races) != 2 || races[0].Name != race.Name || races[1].ID != other.ID {
+		t.Errorf("fel lopp efter sparning: %+v", races)
+	}
+}
+
+func TestAPIStartTimeIsStoredAsWallClock(t *testing.T) {
+	server, _ := newTestServer(t, RaceStatusPlanned)
+
+	tests := []struct {
+		input string
+		want  time.Time
+	}{
+		{"2026-05-17 11:00", time.Date(2026, 5, 17, 11, 0, 0, 0, time.UTC)},
+		{"2026-05-17 11:15:30", time.Date(2026, 5, 17, 11, 15, 30, 0, time.UTC)},
+		{"2026-05-17T10:30:00+02:00", time.Date(2026, 5, 17, 10, 30, 0, 0, time.UTC)},
+		{"2026-05-17T10:45:00Z", time.Date(2026, 5, 17, 10, 45, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		rec := doAPIRequest(server, http.MethodPatch, "/api/v1/races/lopp1", testAPIToken, fmt.Sprintf(`{"startTime":%q}`, tt.input))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status %d: %s", tt.input, rec.Code, rec.Body)
+			continue
+		}
+		races, err := loadRaces()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !races[0].StartTime.Equal(tt.want) || races[0].StartTime.Location() != time.UTC {
+			t.Errorf("%s: sparades som %s, väntade %s", tt.input, races[0].StartTime, tt.want)
+		}
+	}
+
+	rec := doAPIRequest(server, http.MethodPatch, "/api/v1/races/lopp1", testAPIToken, `{"startTime":"imorgon"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("ogiltig starttid: status %d, väntade %d", rec.Code, http.StatusBadRequest)
+	}
+}
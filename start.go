@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Hur långt från den angivna starttiden en läsning av startchipet räknas som startskottet
+const startGunWindow = 30 * time.Minute
+
+// Klockans nuvarande tid som starttid, på millisekunden. Läsarfilens tider saknar tidszon
+// och tolkas som UTC, så starttiden sparas som samma väggklocka i UTC.
+func startTimeFromClock(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day(),
+		now.Hour(), now.Minute(), now.Second(), now.Nanosecond()/int(time.Millisecond)*int(time.Millisecond), time.UTC)
+}
+
+// Första läsningen av loppets startchip nära den angivna starttiden
+func findStartGunRead(race Race) (time.Time, bool, error) {
+	if race.StartChip == "" || race.ResultsFile == "" {
+		return time.Time{}, false, nil
+	}
+
+	file, err := os.Open(race.ResultsFile)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("kunde inte öppna läsarfil: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comma = '\t'
+	reader.FieldsPerRecord = -1
+	parser := newReaderRecordParser(race.ResultsFile, race.StartTime)
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			continue
+		}
+
+		chip, recordTime, err := parser.parse(record)
+		if err != nil || chip != race.StartChip {
+			continue
+		}
+
+		diff := recordTime.Sub(race.StartTime)
+		if diff >= -startGunWindow && diff <= startGunWindow {
+			return recordTime, true, nil
+		}
+	}
+
+	return time.Time{}, false, nil
+}
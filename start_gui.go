@@ -0,0 +1,103 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Registrera starten nu. Tiden tas när knappen trycks, dialogen visar den för bekräftelse
+// och ger möjlighet att rätta den innan den sparas.
+func showStartNow(race Race, races []Race, index int, window fyne.Window, updateUI func(), appState *AppState) {
+	captured := startTimeFromClock(time.Now())
+	getLogger().Log("Start registrerad för %s: %s", race.Name, captured.Format(readerTimeLayout))
+
+	showStartConfirm(race, races, index, window, updateUI, appState,
+		"Start registrerad", fmt.Sprintf("Start för %s registrerad", race.Name), captured)
+}
+
+// Hämta starttiden från startchipets läsning i läsarfilen
+func showStartFromChip(race Race, races []Race, index int, window fyne.Window, updateUI func(), appState *AppState) {
+	gunTime, found, err := findStartGunRead(race)
+	if err != nil {
+		dialog.ShowError(err, window)
+		return
+	}
+	if !found {
+		dialog.ShowInformation("Startskott",
+			fmt.Sprintf("Hittade ingen läsning av startchipet %s inom %d minuter från starttiden %s",
+				race.StartChip, int(startGunWindow.Minutes()), race.StartTime.Format("15:04:05")), window)
+		return
+	}
+
+	showStartConfirm(race, races, index, window, updateUI, appState,
+		"Startskott", fmt.Sprintf("Startchipet %s lästes", race.StartChip), gunTime)
+}
+
+// Bekräfta en starttid med möjlighet att rätta den innan den sparas
+func showStartConfirm(race Race, races []Race, index int, window fyne.Window, updateUI func(), appState *AppState, title, message string, startTime time.Time) {
+	timeLabel := widget.NewLabel(startTime.Format("15:04:05.000"))
+	timeLabel.TextStyle = fyne.TextStyle{Bold: true}
+
+	content := container.NewVBox(
+		widget.NewLabel(message),
+		timeLabel,
+		widget.NewLabel(fmt.Sprintf("Tidigare starttid: %s", race.StartTime.Format("2006-01-02 15:04:05.000"))),
+	)
+
+	d := dialog.NewCustomWithoutButtons(title, content, window)
+
+	save := func(start time.Time) {
+		edited := race
+		edited.StartTime = start
+		if raceStatus(edited) == RaceStatusPlanned {
+			// Starten för loppet igång, läsarfilen börjar övervakas när ändringen sparas
+			edited.Status = RaceStatusStarted
+			if edited.ResultsFile != "" {
+				edited.LiveUpdate = true
+			}
+		}
+		saveEditedRace(edited, races, index, window, updateUI, appState, d.Hide)
+	}
+
+	saveButton := widget.NewButton("Spara", func() {
+		save(startTime)
+	})
+	saveButton.Importance = widget.HighImportance
+
+	correctButton := widget.NewButton("Rätta...", func() {
+		dateEntry := widget.NewEntry()
+		dateEntry.SetText(startTime.Format("2006-01-02"))
+		clockEntry := widget.NewEntry()
+		clockEntry.SetPlaceHolder("HH:MM:SS.mmm")
+		clockEntry.SetText(startTime.Format("15:04:05.000"))
+
+		dialog.ShowForm("Rätta starttid", "Spara", "Avbryt", []*widget.FormItem{
+			{Text: "Datum", Widget: dateEntry},
+			{Text: "Starttid", Widget: clockEntry},
+		}, func(submitted bool) {
+			if !submitted {
+				return
+			}
+			corrected, err := parseStartTime(dateEntry.Text, clockEntry.Text, startTime.Location())
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("Ogiltigt datum eller tid: %v", err), window)
+				return
+			}
+			save(corrected)
+		}, window)
+	})
+
+	cancelButton := widget.NewButton("Avbryt", func() {
+		d.Hide()
+	})
+
+	d.SetButtons([]fyne.CanvasObject{cancelButton, correctButton, saveButton})
+	d.Show()
+}
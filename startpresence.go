@@ -0,0 +1,250 @@
+//go:build !headless
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Ta fram vilka anmälda som lästs före starten och vilka som aldrig lästs alls
+func analyzeStartPresence(race Race) (StartPresence, error) {
+	presence := StartPresence{}
+	beforeStart := make(map[string]*ChipReadSummary)
+	afterStart := make(map[string]bool)
+
+	if race.ResultsFile != "" {
+		file, err := os.Open(race.ResultsFile)
+		if err != nil {
+			return presence, fmt.Errorf("kunde inte öppna läsarfil: %v", err)
+		}
+		defer file.Close()
+
+		reader := csv.NewReader(file)
+		reader.Comma = '\t'
+		reader.FieldsPerRecord = -1
+		parser := newReaderRecordParser(race.ResultsFile, race.StartTime)
+
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				continue
+			}
+
+			chip, recordTime, err := parser.parse(record)
+			if err != nil || !race.Chips[chip] {
+				continue
+			}
+
+			if roundUpToSecond(recordTime).After(race.StartTime) {
+				afterStart[chip] = true
+			} else {
+				addChipRead(beforeStart, chip, recordTime)
+			}
+		}
+	}
+
+	// Manuella tider räknas också som att löparen har synts
+	manualTimes, err := loadManualTimes(race.ID)
+	if err == nil {
+		for _, mt := range manualTimes {
+			if mt.RaceID == race.ID {
+				afterStart[mt.Chip] = true
+			}
+		}
+	}
+
+	presence.SeenBeforeStart = sortedChipReads(beforeStart)
+	sortChipReadsNumerically(presence.SeenBeforeStart)
+
+	for chip := range race.Chips {
+		if beforeStart[chip] != nil {
+			continue
+		}
+		if afterStart[chip] {
+			presence.OnlyAfterStart = append(presence.OnlyAfterStart, chip)
+		} else {
+			presence.NeverSeen = append(presence.NeverSeen, chip)
+		}
+	}
+	sortChipsNumerically(presence.OnlyAfterStart)
+	sortChipsNumerically(presence.NeverSeen)
+
+	return presence, nil
+}
+
+// Hjälpfunktion för att sortera läsningar på startnummer
+func sortChipReadsNumerically(reads []ChipReadSummary) {
+	sort.Slice(reads, func(i, j int) bool {
+		ni, _ := strconv.Atoi(reads[i].Chip)
+		nj, _ := strconv.Atoi(reads[j].Chip)
+		return ni < nj
+	})
+}
+
+// Visa rapport över vilka som var på plats vid starten och låt tävlingsledaren bekräfta DNS
+func showStartPresence(race *Race, races []Race, index int, app fyne.App, onChange func()) {
+	reportWindow := app.NewWindow(fmt.Sprintf("Närvaro vid start - %s", race.Name))
+
+	var presence StartPresence
+	selected := make(map[string]bool)
+	summaryLabel := widget.NewLabel("")
+
+	// Visa namn efter startnumret om det finns
+	chipLabel := func(chip string) string {
+		if name := participantName(*race, chip); name != "" {
+			return fmt.Sprintf("%s %s", chip, name)
+		}
+		return chip
+	}
+
+	seenList := widget.NewList(
+		func() int {
+			return len(presence.SeenBeforeStart)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			summary := presence.SeenBeforeStart[id]
+			obj.(*widget.Label).SetText(fmt.Sprintf("%s - senast sedd %s",
+				chipLabel(summary.Chip), summary.Last.Format("15:04:05")))
+		})
+
+	candidateList := widget.NewList(
+		func() int {
+			return len(presence.NeverSeen)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewCheck("", nil)
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			chip := presence.NeverSeen[id]
+			check := obj.(*widget.Check)
+			check.OnChanged = nil
+			check.Text = chipLabel(chip)
+			if race.DNS[chip] {
+				check.Text += " (DNS)"
+			}
+			check.SetChecked(selected[chip])
+			check.OnChanged = func(checked bool) {
+				selected[chip] = checked
+			}
+		})
+
+	lateList := widget.NewList(
+		func() int {
+			return len(presence.OnlyAfterStart)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			obj.(*widget.Label).SetText(chipLabel(presence.OnlyAfterStart[id]))
+		})
+
+	refresh := func() {
+		result, err := analyzeStartPresence(*race)
+		if err != nil {
+			dialog.ShowError(err, reportWindow)
+			return
+		}
+		presence = result
+
+		// Förvälj alla som aldrig synts och inte redan är markerade
+		selected = make(map[string]bool)
+		for _, chip := range presence.NeverSeen {
+			selected[chip] = !race.DNS[chip]
+		}
+
+		summaryLabel.SetText(fmt.Sprintf("Anmälda: %d, sedda före start: %d, sedda bara efter start: %d, aldrig sedda: %d, bekräftade DNS: %d",
+			len(race.Chips), len(presence.SeenBeforeStart), len(presence.OnlyAfterStart), len(presence.NeverSeen), len(race.DNS)))
+		seenList.Refresh()
+		candidateList.Refresh()
+		lateList.Refresh()
+	}
+
+	// Spara ändrad DNS-status för de valda startnumren
+	setDNS := func(dns bool) {
+		var chips []string
+		for chip, checked := range selected {
+			if checked {
+				chips = append(chips, chip)
+			}
+		}
+		if len(chips) == 0 {
+			return
+		}
+		if !raceResultsEditable(*race) {
+			dialog.ShowError(raceLockedError(*race), reportWindow)
+			return
+		}
+		sortChipsNumerically(chips)
+
+		if race.DNS == nil {
+			race.DNS = make(map[string]bool)
+		}
+		for _, chip := range chips {
+			if dns {
+				race.DNS[chip] = true
+			} else {
+				delete(race.DNS, chip)
+			}
+		}
+
+		races[index] = *race
+		if err := saveRace(*race); err != nil {
+			dialog.ShowError(err, reportWindow)
+			return
+		}
+		getLogger().Log("Ändrade DNS-status till %v för %s i lopp %s", dns, strings.Join(chips, ", "), race.Name)
+
+		refresh()
+		onChange()
+	}
+
+	confirmButton := widget.NewButton("Markera valda som DNS", func() {
+		dialog.ShowConfirm("Bekräfta DNS", "Vill du markera de valda startnumren som DNS?", func(ok bool) {
+			if ok {
+				setDNS(true)
+			}
+		}, reportWindow)
+	})
+	confirmButton.Importance = widget.DangerImportance
+
+	clearButton := widget.NewButton("Ta bort DNS för valda", func() {
+		setDNS(false)
+	})
+
+	if !raceResultsEditable(*race) {
+		confirmButton.Disable()
+		clearButton.Disable()
+	}
+
+	tabs := container.NewAppTabs(
+		container.NewTabItem("Aldrig sedda (DNS-kandidater)", container.NewBorder(
+			nil, container.NewHBox(confirmButton, clearButton), nil, nil, candidateList)),
+		container.NewTabItem("Sedda före start", seenList),
+		container.NewTabItem("Sedda bara efter start", lateList),
+	)
+
+	reportWindow.SetContent(container.NewBorder(summaryLabel, nil, nil, nil, tabs))
+	reportWindow.Resize(fyne.NewSize(800, 600))
+	reportWindow.CenterOnScreen()
+	reportWindow.Show()
+
+	refresh()
+}
@@ -1,52 +1,192 @@
 package main
 
 import (
+	"crypto/rand"
 	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
 // Spara/läsa lopp
 func saveRaces(races []Race) error {
-	file, err := os.Create("races.json")
+	return writeJSONVersioned(racesFilename(), racesFile{
+		SchemaVersion: currentSchemaVersion,
+		Races:         races,
+	})
+}
+
+// Ändringar av races.json från gränssnittet, API:et och bakgrundsrutiner går via samma lås
+var racesWriteMu sync.Mutex
+
+// Läs in loppen från disk, låt change ändra dem och spara. Loppen läses alltid från disk
+// så att ändringar som gjorts någon annanstans inte skrivs över.
+func updateRaces(change func(races []Race) ([]Race, error)) error {
+	racesWriteMu.Lock()
+	defer racesWriteMu.Unlock()
+
+	races, err := loadRaces()
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	races, err = change(races)
+	if err != nil {
+		return err
+	}
+	return saveRaces(races)
+}
 
-	return json.NewEncoder(file).Encode(races)
+// Spara ett lopp utan att röra de andra i races.json
+func saveRace(race Race) error {
+	err := updateRaces(func(races []Race) ([]Race, error) {
+		for i := range races {
+			if races[i].ID == race.ID {
+				races[i] = race
+				return races, nil
+			}
+		}
+		return nil, fmt.Errorf("loppet finns inte längre")
+	})
+	if err != nil {
+		return fmt.Errorf("kunde inte spara loppet %s: %v", race.Name, err)
+	}
+	return nil
 }
 
 func loadRaces() ([]Race, error) {
-	file, err := os.Open("races.json")
+	data, err := os.ReadFile(racesFilename())
 	if err != nil {
 		if os.IsNotExist(err) {
 			return []Race{}, nil
 		}
 		return nil, err
 	}
-	defer file.Close()
 
-	var races []Race
-	err = json.NewDecoder(file).Decode(&races)
-	return races, err
+	// Allt som inte går att läsa räknas som skadat och kan återställas från backup,
+	// utom en fil från en nyare version av programmet
+	races, version, err := parseRacesData(data)
+	if err != nil {
+		if version > currentSchemaVersion {
+			return nil, err
+		}
+		return nil, &corruptFileError{filename: racesFilename(), err: err}
+	}
+
+	// Skriv tillbaka filen i nya formatet, den gamla versionen sparas som backup
+	if version < currentSchemaVersion {
+		getLogger().Log("Migrerar races.json från version %d till %d", version, currentSchemaVersion)
+		if err := saveBackupVersion(racesFilename(), data); err != nil {
+			return nil, fmt.Errorf("kunde inte spara backup före migrering: %v", err)
+		}
+		if err := saveRaces(races); err != nil {
+			return nil, fmt.Errorf("kunde inte spara migrerad races.json: %v", err)
+		}
+
+		// Från version 3 är loppens filer nycklade på ID istället för namn
+		if version < 3 {
+			for _, race := range races {
+				if err := renameLegacyRaceFiles(race); err != nil {
+					getLogger().Log("Kunde inte flytta filer för lopp %s: %v", race.Name, err)
+				}
+			}
+		}
+	}
+
+	return races, nil
 }
 
-// Funktion för att cacha resultat
-func cacheResults(raceName string, results []ChipResult) error {
-	filename := fmt.Sprintf("results_%s.json", raceName)
-	file, err := os.Create(filename)
-	if err != nil {
+// Kontrollera att en sparad version av races.json går att läsa in
+func validateRacesData(data []byte) error {
+	if err := validateJSON(data); err != nil {
 		return err
 	}
-	defer file.Close()
+	_, _, err := parseRacesData(data)
+	return err
+}
+
+// Skapa ett nytt unikt ID för ett lopp eller en manuell tid
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// Slumpkällan ska aldrig fallera, men ett tidsbaserat ID är bättre än inget
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Filnamn för alla lopp i evenemanget
+func racesFilename() string {
+	return dataPath("races.json")
+}
+
+// Filnamn för loppets manuella tider
+func manualTimesFilename(raceID string) string {
+	return dataPath(fmt.Sprintf("manual_times_%s.json", raceID))
+}
+
+// Filnamn för loppets måltider som väntar på startnummer
+func finishStampsFilename(raceID string) string {
+	return dataPath(fmt.Sprintf("finish_stamps_%s.json", raceID))
+}
+
+// Filnamn för loppets cachade resultat
+func resultsCacheFilename(raceID string) string {
+	return dataPath(fmt.Sprintf("results_%s.json", raceID))
+}
+
+// ID för loppets resultatfönster
+func resultWindowID(race Race) string {
+	return fmt.Sprintf("results_%s", race.ID)
+}
+
+// Byt namn på filer som sparades med loppets namn innan loppen hade ID
+func renameLegacyRaceFiles(race Race) error {
+	legacyManual := dataPath(fmt.Sprintf("manual_times_%s.json", race.Name))
+	if _, err := os.Stat(legacyManual); err == nil && legacyManual != manualTimesFilename(race.ID) {
+		if _, err := os.Stat(manualTimesFilename(race.ID)); os.IsNotExist(err) {
+			data, err := os.ReadFile(legacyManual)
+			if err != nil {
+				return err
+			}
+			var manualTimes []ManualTime
+			if err := json.Unmarshal(data, &manualTimes); err != nil {
+				return fmt.Errorf("kunde inte läsa %s: %v", legacyManual, err)
+			}
+			for i := range manualTimes {
+				if manualTimes[i].RaceName == race.Name {
+					manualTimes[i].RaceID = race.ID
+				}
+			}
+			if err := saveManualTimes(race.ID, manualTimes); err != nil {
+				return err
+			}
+			if err := os.Remove(legacyManual); err != nil {
+				return err
+			}
+			getLogger().Log("Flyttade %s till %s", legacyManual, manualTimesFilename(race.ID))
+		}
+	}
 
-	return json.NewEncoder(file).Encode(results)
+	// Cachen byggs om vid behov, den gamla kan tas bort
+	legacyCache := dataPath(fmt.Sprintf("results_%s.json", race.Name))
+	if legacyCache != resultsCacheFilename(race.ID) {
+		if err := os.Remove(legacyCache); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Funktion för att cacha resultat
+func cacheResults(raceID string, results []ChipResult) error {
+	return writeJSONAtomic(resultsCacheFilename(raceID), results)
 }
 
 // Lägg till updateResults-funktionen
@@ -63,16 +203,45 @@ func updateResults(results []ChipResult, searchText string) []ChipResult {
 	return filtered
 }
 
-// Ny funktion som samlar alla resultat
+// Ny funktion som samlar alla resultat. Alla tider, även de som valts bort, sparas i cache.
 func getAllResults(race Race) []ChipResult {
+	allResults, filteredResults := collectResults(race)
+
+	// Skapa JSON-fil med ALLA resultat (för att behålla historiken)
+	jsonData, err := json.Marshal(allResults)
+	if err != nil {
+		getLogger().Log("Fel vid skapande av JSON: %v", err)
+		return filteredResults
+	}
+
+	err = writeFileAtomic(resultsCacheFilename(race.ID), jsonData)
+	if err != nil {
+		getLogger().Log("Fel vid sparande av JSON-fil: %v", err)
+		return filteredResults
+	}
+
+	getLogger().Log("Returnerar totalt %d resultat (av %d totalt)", len(filteredResults), len(allResults))
+	return filteredResults
+}
+
+// Samma resultat som getAllResults men utan att skriva cache, för lopp som inte sparats
+// och för läsning från andra processer
+func readAllResults(race Race) []ChipResult {
+	_, filteredResults := collectResults(race)
+	return filteredResults
+}
+
+// Läs manuella tider och läsarfil. Returnerar alla tider och de tider som visas:
+// alla felaktiga tider plus första giltiga tiden för varje startnummer.
+func collectResults(race Race) ([]ChipResult, []ChipResult) {
 	getLogger().Log("Hämtar alla resultat för lopp: %s", race.Name)
 	allResults := []ChipResult{}
 
 	// Läs in manuella tider först
-	manualTimes, err := loadManualTimes(race.Name)
+	manualTimes, err := loadManualTimes(race.ID)
 	if err == nil {
 		for _, mt := range manualTimes {
-			if mt.RaceName == race.Name {
+			if mt.RaceID == race.ID {
 				duration := mt.Time.Sub(race.StartTime)
 				timeKey := makeInvalidTimeKey(mt.Chip, mt.Time)
 				allResults = append(allResults, ChipResult{
@@ -127,22 +296,7 @@ func getAllResults(race Race) []ChipResult {
 		return filteredResults[i].Time.Before(filteredResults[j].Time)
 	})
 
-	// Skapa JSON-fil med ALLA resultat (för att behålla historiken)
-	jsonData, err := json.Marshal(allResults)
-	if err != nil {
-		getLogger().Log("Fel vid skapande av JSON: %v", err)
-		return filteredResults
-	}
-
-	jsonFilename := fmt.Sprintf("results_%s.json", race.Name)
-	err = os.WriteFile(jsonFilename, jsonData, 0644)
-	if err != nil {
-		getLogger().Log("Fel vid sparande av JSON-fil: %v", err)
-		return filteredResults
-	}
-
-	getLogger().Log("Returnerar totalt %d resultat (av %d totalt)", len(filteredResults), len(allResults))
-	return filteredResults
+	return allResults, filteredResults
 }
 
 // Separera CSV-läsningen till egen funktion
@@ -158,8 +312,10 @@ func readCSVResults(race Race) []ChipResult {
 	reader := csv.NewReader(file)
 	reader.Comma = '\t'
 	reader.FieldsPerRecord = -1
+	parser := newReaderRecordParser(race.ResultsFile, race.StartTime)
 
 	rowCount := 0
+	skipped := 0
 
 	for {
 		record, err := reader.Read()
@@ -167,18 +323,17 @@ func readCSVResults(race Race) []ChipResult {
 			break
 		}
 		rowCount++
-		if err != nil || len(record) < 2 {
+		if err != nil {
+			skipped++
 			continue
 		}
 
-		chip := record[0]
-		if !race.Chips[chip] {
+		chip, recordTime, err := parser.parse(record)
+		if err != nil {
+			skipped++
 			continue
 		}
-
-		timeStr := record[1]
-		recordTime, err := time.Parse("2006-01-02 15:04:05.000", timeStr)
-		if err != nil {
+		if !race.Chips[chip] {
 			continue
 		}
 
@@ -199,5 +354,9 @@ func readCSVResults(race Race) []ChipResult {
 		}
 	}
 
+	if skipped > 0 {
+		getLogger().Log("Hoppade över %d av %d rader i %s som inte gick att tolka", skipped, rowCount, race.ResultsFile)
+	}
+
 	return results
 }
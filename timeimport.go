@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jimmitjoo/hogby-tidtagning/internal/timeformat"
+)
+
+// Bedömning av en rad i en importerad fil med tider
+const (
+	importNew       = "new"
+	importOverride  = "override"
+	importDuplicate = "duplicate"
+	importUnderMin  = "underMin"
+	importUnknown   = "unknown"
+	importInvalid   = "invalid"
+)
+
+// En rad ur en fil med startnummer och tider, t.ex. från en reservklocka
+type ImportRow struct {
+	Line     int
+	Chip     string
+	Text     string
+	Time     time.Time
+	Status   string
+	Detail   string
+	Accept   bool
+	Imported bool
+}
+
+// Rader som går att importera, okända startnummer, ogiltiga tider och rader som redan
+// importerats går inte att välja
+func (row ImportRow) acceptable() bool {
+	if row.Imported {
+		return false
+	}
+	return row.Status == importNew || row.Status == importOverride || row.Status == importDuplicate
+}
+
+// Bedömningen i klartext
+func importStatusLabel(status string) string {
+	switch status {
+	case importNew:
+		return "Ny"
+	case importOverride:
+		return "Ersätter tid"
+	case importDuplicate:
+		return "Dubblett"
+	case importUnderMin:
+		return "Under minsta tid"
+	case importUnknown:
+		return "Okänt startnummer"
+	case importInvalid:
+		return "Ogiltig"
+	}
+	return status
+}
+
+// Läs startnummer och tid ur en fil. Första kolumnen är startnumret och andra tiden,
+// kolumnerna kan skiljas med tab, semikolon, komma eller mellanslag. En rubrikrad hoppas över.
+func readTimeImport(race Race, r io.Reader) ([]ImportRow, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimPrefix(string(data), "\ufeff")
+
+	// Avgränsaren bestäms av första raden med innehåll
+	var delimiter rune
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		switch {
+		case strings.Contains(line, "\t"):
+			delimiter = '\t'
+		case strings.Contains(line, ";"):
+			delimiter = ';'
+		case strings.Contains(line, ","):
+			delimiter = ','
+		}
+		break
+	}
+
+	var rows []ImportRow
+	first := true
+	addRow := func(line int, fields []string) {
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		if len(fields) == 0 || (len(fields) == 1 && fields[0] == "") {
+			return
+		}
+
+		// Rubrikrad utan siffror i tidskolumnen. Ett känt startnummer med t.ex. DNF som tid
+		// är ingen rubrik och visas som ogiltig rad.
+		header := first && len(fields) > 1 && !strings.ContainsAny(fields[1], "0123456789") && !race.Chips[fields[0]]
+		first = false
+		if header {
+			return
+		}
+
+		row := ImportRow{Line: line, Chip: fields[0]}
+		if len(fields) > 1 {
+			row.Text = fields[1]
+		}
+		rows = append(rows, row)
+	}
+
+	if delimiter == 0 {
+		for i, line := range strings.Split(text, "\n") {
+			addRow(i+1, strings.Fields(line))
+		}
+		return rows, nil
+	}
+
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("kunde inte läsa filen: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		addRow(line, record)
+	}
+	return rows, nil
+}
+
+// Tolka en importerad tid. Utöver samma format som en manuell tid godtas MM:SS och
+// tiondelar eller hundradelar, som avrundas uppåt till hel sekund.
+func parseImportTime(race Race, text string) (time.Time, error) {
+	text = strings.TrimSpace(text)
+
+	// Dela av decimaler efter sista kolon, med punkt eller komma
+	var fraction time.Duration
+	if colon := strings.LastIndex(text, ":"); colon >= 0 {
+		if dot := strings.IndexAny(text[colon:], ".,"); dot >= 0 {
+			digits := text[colon+dot+1:]
+			if digits == "" || strings.Trim(digits, "0123456789") != "" {
+				return time.Time{}, fmt.Errorf("Ogiltig tid %q", text)
+			}
+			if strings.Trim(digits, "0") != "" {
+				fraction = time.Nanosecond
+			}
+			text = text[:colon+dot]
+		}
+	}
+
+	// MM:SS från en stoppur
+	if strings.Count(text, ":") == 1 && !strings.Contains(text, " ") {
+		text = "00:" + text
+	}
+
+	recordTime, err := parseManualTime(race, expandTimeDigits(text))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if fraction > 0 {
+		recordTime = recordTime.Add(time.Second)
+	}
+	return recordTime, nil
+}
+
+// Bedöm varje rad mot loppets startnummer, minsta tid och befintliga tider. Nya tider
+// väljs direkt, tider som ersätter en befintlig tid eller är dubbletter måste väljas.
+func classifyImportRows(race Race, results []ChipResult, manualTimes []ManualTime, rows []ImportRow) {
+	current := make(map[string]ChipResult)
+	for _, result := range results {
+		if !result.Invalid {
+			current[result.Chip] = result
+		}
+	}
+	seen := make(map[string]int)
+
+	for i := range rows {
+		row := &rows[i]
+		row.Accept = false
+		row.Detail = ""
+
+		recordTime, err := parseImportTime(race, row.Text)
+		switch {
+		case row.Chip == "":
+			row.Status = importInvalid
+			row.Detail = "Startnummer saknas"
+			continue
+		case err != nil:
+			row.Status = importInvalid
+			row.Detail = err.Error()
+			continue
+		case !race.Chips[row.Chip]:
+			row.Status = importUnknown
+			row.Detail = fmt.Sprintf("Startnummer %s finns inte registrerat i loppet", row.Chip)
+			continue
+		}
+		row.Time = recordTime
+
+		if err := checkManualTimeLimit(race, recordTime); err != nil {
+			row.Status = importUnderMin
+			row.Detail = fmt.Sprintf("%s är kortare än minsta tid %s",
+				timeformat.Duration(recordTime.Sub(race.StartTime)), timeformat.Duration(race.MinTime))
+			continue
+		}
+
+		if first, exists := seen[row.Chip]; exists {
+			row.Status = importDuplicate
+			row.Detail = fmt.Sprintf("Startnumret finns redan på rad %d i filen", first)
+			continue
+		}
+		seen[row.Chip] = row.Line
+
+		duplicate := false
+		for _, mt := range manualTimes {
+			diff := mt.Time.Sub(recordTime)
+			if mt.Chip == row.Chip && diff < time.Second && diff > -time.Second {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			row.Status = importDuplicate
+			row.Detail = "Samma manuella tid finns redan"
+			continue
+		}
+
+		if existing, exists := current[row.Chip]; exists {
+			source := "chiptid"
+			if existing.Manual {
+				source = "manuell tid"
+			}
+			row.Status = importOverride
+			row.Detail = fmt.Sprintf("Ersätter %s %s (skillnad %s)", source,
+				timeformat.Duration(existing.Duration), formatTimeDifference(recordTime.Sub(existing.Time)))
+			continue
+		}
+
+		row.Status = importNew
+		row.Accept = true
+	}
+}
+
+// Skillnad mellan två tider med tecken, t.ex. +00:03 eller -01:10
+func formatTimeDifference(d time.Duration) string {
+	if d < 0 {
+		return "-" + timeformat.Duration(-d)
+	}
+	return "+" + timeformat.Duration(d)
+}
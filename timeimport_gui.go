@@ -0,0 +1,210 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/jimmitjoo/hogby-tidtagning/internal/timeformat"
+)
+
+// Importera tider från en fil, med förhandsgranskning där varje rad kan väljas eller väljas bort
+func showTimeImport(race *Race, races []Race, index int, app fyne.App, parent fyne.Window, onChange func()) {
+	d := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+		if reader == nil {
+			return
+		}
+		defer reader.Close()
+
+		rows, err := readTimeImport(*race, reader)
+		if err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+		if len(rows) == 0 {
+			dialog.ShowInformation("Importera tider", "Filen innehåller inga tider", parent)
+			return
+		}
+
+		manualTimes, err := loadManualTimes(race.ID)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("kunde inte läsa manuella tider: %v", err), parent)
+			return
+		}
+		classifyImportRows(*race, getAllResults(*race), manualTimes, rows)
+		showTimeImportPreview(race, races, index, app, reader.URI().Name(), rows, onChange)
+	}, parent)
+	d.Resize(fyne.NewSize(1200, 800))
+	d.Show()
+}
+
+// Förhandsgranskning av importerade rader innan de sparas som manuella tider
+func showTimeImportPreview(race *Race, races []Race, index int, app fyne.App, name string, rows []ImportRow, onChange func()) {
+	window := app.NewWindow(fmt.Sprintf("Importera tider - %s", race.Name))
+	summaryLabel := widget.NewLabel("")
+
+	updateSummary := func() {
+		counts := make(map[string]int)
+		accepted := 0
+		for _, row := range rows {
+			counts[row.Status]++
+			if row.Accept {
+				accepted++
+			}
+		}
+		var parts []string
+		for _, status := range []string{importNew, importOverride, importDuplicate, importUnderMin, importUnknown, importInvalid} {
+			if counts[status] > 0 {
+				parts = append(parts, fmt.Sprintf("%s: %d", importStatusLabel(status), counts[status]))
+			}
+		}
+		summaryLabel.SetText(fmt.Sprintf("%s - %d rader, %d valda. %s", name, len(rows), accepted, strings.Join(parts, ", ")))
+	}
+
+	list := container.NewVBox()
+	var checks []*widget.Check
+	var statusLabels []*widget.Label
+	for i := range rows {
+		i := i
+		row := rows[i]
+
+		check := widget.NewCheck("", func(checked bool) {
+			rows[i].Accept = checked
+			// Bara en rad per startnummer kan importeras
+			if checked {
+				for j := range rows {
+					if j != i && rows[j].Chip == rows[i].Chip && rows[j].Accept {
+						checks[j].SetChecked(false)
+					}
+				}
+			}
+			updateSummary()
+		})
+		check.SetChecked(row.Accept)
+		if !row.acceptable() {
+			check.Disable()
+		}
+		checks = append(checks, check)
+
+		timeText := row.Text
+		if !row.Time.IsZero() {
+			timeText = timeformat.Duration(row.Time.Sub(race.StartTime))
+		}
+		status := widget.NewLabel(importStatusLabel(row.Status))
+		if row.Status == importOverride || row.Status == importDuplicate {
+			status.Importance = widget.WarningImportance
+		} else if !row.acceptable() {
+			status.Importance = widget.DangerImportance
+		}
+		statusLabels = append(statusLabels, status)
+
+		list.Add(container.NewBorder(nil, nil,
+			container.NewHBox(
+				check,
+				widget.NewLabel(fmt.Sprintf("Rad %d", row.Line)),
+				widget.NewLabel(row.Chip),
+				widget.NewLabel(participantName(*race, row.Chip)),
+				widget.NewLabel(timeText),
+				status,
+			),
+			nil,
+			widget.NewLabel(row.Detail)))
+	}
+	updateSummary()
+
+	selectStatus := func(statuses ...string) {
+		for i, row := range rows {
+			selected := false
+			for _, status := range statuses {
+				if row.Status == status {
+					selected = true
+				}
+			}
+			if row.acceptable() {
+				checks[i].SetChecked(selected)
+			}
+		}
+	}
+
+	onlyNewButton := widget.NewButton("Välj bara nya", func() {
+		selectStatus(importNew)
+	})
+	withOverridesButton := widget.NewButton("Välj nya och ersättande", func() {
+		selectStatus(importNew, importOverride)
+	})
+
+	importButton := widget.NewButton("Importera valda", func() {
+		imported := 0
+		var problems []string
+		for i, row := range rows {
+			if !row.Accept {
+				continue
+			}
+			entry := newManualTimeEntry(*race, row.Chip, row.Time, "")
+			if _, err := recordJournalEntry(race, entry); err != nil {
+				problems = append(problems, fmt.Sprintf("Rad %d: %v", row.Line, err))
+				continue
+			}
+			imported++
+
+			// Importerade rader kan inte väljas igen om fönstret lämnas öppet
+			rows[i].Imported = true
+			checks[i].SetChecked(false)
+			checks[i].Disable()
+			statusLabels[i].SetText("Importerad")
+			statusLabels[i].Importance = widget.SuccessImportance
+			statusLabels[i].Refresh()
+		}
+		updateSummary()
+
+		if imported > 0 {
+			races[index] = *race
+			if err := saveRace(*race); err != nil {
+				dialog.ShowError(err, window)
+			}
+			onChange()
+		}
+		getLogger().Log("Importerade %d tider från %s till %s", imported, name, race.Name)
+
+		message := fmt.Sprintf("Importerade %d tider", imported)
+		if len(problems) > 0 {
+			message += "\n\nKunde inte importera:\n" + strings.Join(problems, "\n")
+		}
+		info := dialog.NewInformation("Importera tider", message, window)
+		if len(problems) == 0 {
+			info.SetOnClosed(window.Close)
+		}
+		info.Show()
+	})
+	importButton.Importance = widget.HighImportance
+
+	cancelButton := widget.NewButton("Avbryt", func() {
+		window.Close()
+	})
+
+	if !raceResultsEditable(*race) {
+		importButton.Disable()
+		dialog.ShowError(raceLockedError(*race), window)
+	}
+
+	window.SetContent(container.NewPadded(container.NewBorder(
+		container.NewVBox(
+			summaryLabel,
+			container.NewHBox(onlyNewButton, withOverridesButton),
+		),
+		container.NewHBox(cancelButton, importButton),
+		nil, nil,
+		container.NewVScroll(list),
+	)))
+	window.Resize(fyne.NewSize(1000, 700))
+	window.Show()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadTimeImport(t *testing.T) {
+	race := testRace("")
+
+	tests := []struct {
+		name string
+		data string
+		want []ImportRow
+	}{
+		{"tab med rubrik", "Nr\tTid\n1\t00:40:00\n2\t00:41:00\n",
+			[]ImportRow{{Line: 2, Chip: "1", Text: "00:40:00"}, {Line: 3, Chip: "2", Text: "00:41:00"}}},
+		{"semikolon", "1;00:40:00\n2;00:41:00", []ImportRow{{Line: 1, Chip: "1", Text: "00:40:00"}, {Line: 2, Chip: "2", Text: "00:41:00"}}},
+		{"komma med BOM", "\ufeffStartnr,Tid\n1, 00:40:00\n", []ImportRow{{Line: 2, Chip: "1", Text: "00:40:00"}}},
+		{"mellanslag och tomma rader", "\n1   00:40:00\n\n2 00:41:00\n",
+			[]ImportRow{{Line: 2, Chip: "1", Text: "00:40:00"}, {Line: 4, Chip: "2", Text: "00:41:00"}}},
+		{"känt startnummer utan tid först", "1;DNF\n2;00:41:00\n",
+			[]ImportRow{{Line: 1, Chip: "1", Text: "DNF"}, {Line: 2, Chip: "2", Text: "00:41:00"}}},
+		{"rubrik bara på första raden", "Nr;Tid\nx;y\n", []ImportRow{{Line: 2, Chip: "x", Text: "y"}}},
+	}
+	for _, tt := range tests {
+		rows, err := readTimeImport(race, strings.NewReader(tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(rows) != len(tt.want) {
+			t.Errorf("%s: fick %+v, väntade %+v", tt.name, rows, tt.want)
+			continue
+		}
+		for i := range rows {
+			if rows[i] != tt.want[i] {
+				t.Errorf("%s: rad %d blev %+v, väntade %+v", tt.name, i, rows[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestParseImportTime(t *testing.T) {
+	race := testRace("")
+
+	tests := []struct {
+		text    string
+		elapsed time.Duration
+		wantErr bool
+	}{
+		{"00:40:00", 40 * time.Minute, false},
+		{"40:00", 40 * time.Minute, false},
+		{"40:00.3", 40*time.Minute + time.Second, false},
+		{"00:40:00,01", 40*time.Minute + time.Second, false},
+		{"00:40:00.00", 40 * time.Minute, false},
+		{"4000", 40 * time.Minute, false},
+		{"2026-05-17 10:40:00.5", 40*time.Minute + time.Second, false},
+		{"00:40:00.", 0, true},
+		{"00:40:00.x", 0, true},
+		{"DNF", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseImportTime(race, tt.text)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q godkändes som %s", tt.text, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.text, err)
+			continue
+		}
+		if elapsed := got.Sub(race.StartTime); elapsed != tt.elapsed {
+			t.Errorf("%q gav %s, väntade %s", tt.text, elapsed, tt.elapsed)
+		}
+	}
+}
+
+func TestClassifyImportRows(t *testing.T) {
+	race := testRace("")
+	race.Chips["3"] = true
+	race.MinTime = 10 * time.Minute
+	at := func(minutes int) time.Time { return race.StartTime.Add(time.Duration(minutes) * time.Minute) }
+
+	results := []ChipResult{{Chip: "2", Time: at(45), Duration: 45 * time.Minute}}
+	manualTimes := []ManualTime{{ID: "m1", Chip: "3", Time: at(50)}}
+	rows := []ImportRow{
+		{Line: 1, Chip: "1", Text: "00:40:00"},
+		{Line: 2, Chip: "1", Text: "00:40:30"},
+		{Line: 3, Chip: "2", Text: "00:44:00"},
+		{Line: 4, Chip: "3", Text: "00:50:00"},
+		{Line: 5, Chip: "9", Text: "00:40:00"},
+		{Line: 6, Chip: "1", Text: "00:05:00"},
+		{Line: 7, Chip: "", Text: "00:40:00"},
+		{Line: 8, Chip: "2", Text: "DNF"},
+	}
+	classifyImportRows(race, results, manualTimes, rows)
+
+	want := []struct {
+		status string
+		accept bool
+	}{
+		{importNew, true},
+		{importDuplicate, false},
+		{importOverride, false},
+		{importDuplicate, false},
+		{importUnknown, false},
+		{importUnderMin, false},
+		{importInvalid, false},
+		{importInvalid, false},
+	}
+	for i, row := range rows {
+		if row.Status != want[i].status || row.Accept != want[i].accept {
+			t.Errorf("rad %d: fick %s %v (%s), väntade %s %v", row.Line, row.Status, row.Accept, row.Detail, want[i].status, want[i].accept)
+		}
+	}
+	if !strings.Contains(rows[1].Detail, "rad 1") {
+		t.Errorf("dubbletten pekar inte på första raden: %s", rows[1].Detail)
+	}
+}
@@ -1,18 +1,14 @@
 package main
 
 import (
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"fyne.io/fyne/v2"
-	"fyne.io/fyne/v2/dialog"
-	"fyne.io/fyne/v2/widget"
-	"io"
 	"os"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/jimmitjoo/hogby-tidtagning/internal/timeformat"
 )
 
 // Hjälpfunktion för att skapa nyckel för InvalidTimes
@@ -26,196 +22,192 @@ func roundUpToSecond(t time.Time) time.Time {
 }
 
 // Funktion för att spara manuella tider
-func saveManualTimes(raceName string, times []ManualTime) error {
-	filename := fmt.Sprintf("manual_times_%s.json", raceName)
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
+func saveManualTimes(raceID string, times []ManualTime) error {
+	filename := manualTimesFilename(raceID)
+	return writeJSONVersioned(filename, times)
+}
 
-	return json.NewEncoder(file).Encode(times)
+// Manuella tider från innan de fick ID får ett ID som räknas fram ur startnummer och tid
+func ensureManualTimeIDs(times []ManualTime) {
+	for i := range times {
+		if times[i].ID == "" {
+			times[i].ID = fmt.Sprintf("%s-%d", times[i].Chip, times[i].Time.UnixNano())
+		}
+	}
 }
 
 // Funktion för att läsa manuella tider
-func loadManualTimes(raceName string) ([]ManualTime, error) {
-	filename := fmt.Sprintf("manual_times_%s.json", raceName)
-	file, err := os.Open(filename)
+func loadManualTimes(raceID string) ([]ManualTime, error) {
+	filename := manualTimesFilename(raceID)
+	data, err := os.ReadFile(filename)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return []ManualTime{}, nil
 		}
 		return nil, err
 	}
-	defer file.Close()
 
 	var times []ManualTime
-	err = json.NewDecoder(file).Decode(&times)
-	return times, err
-}
-
-// Hitta nästa giltiga tid för ett chip
-func findNextValidTime(filename string, race Race, invalidTime time.Time, chip string) (time.Time, bool) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return time.Time{}, false
+	if err := json.Unmarshal(data, &times); err != nil {
+		// Filen är skadad, använd senaste fungerande version istället för att tappa alla tider
+		backup, backupData, backupErr := latestValidBackup(filename, func(data []byte) error {
+			var times []ManualTime
+			return json.Unmarshal(data, &times)
+		})
+		if backupErr != nil {
+			return nil, &corruptFileError{filename: filename, err: err}
+		}
+		getLogger().Log("Filen %s är skadad (%v), läser in backup %s", filename, err, backup)
+		times = nil
+		if err := json.Unmarshal(backupData, &times); err != nil {
+			return nil, err
+		}
 	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	reader.Comma = '\t'
-	reader.FieldsPerRecord = -1
+	ensureManualTimeIDs(times)
+	return times, nil
+}
 
-	var nextValidTime time.Time
-	foundValid := false
+// Tolka en manuellt inmatad tid. Godtar löptid (HH:MM:SS, timmar kan vara fler än 24),
+// klockslag på ett visst dygn av loppet (dag N HH:MM:SS) eller datum och klockslag.
+func parseManualTime(race Race, text string) (time.Time, error) {
+	text = strings.TrimSpace(text)
+	location := race.StartTime.Location()
 
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil || len(record) < 2 {
-			continue
+	// Datum och klockslag
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if recordTime, err := time.ParseInLocation(layout, text, location); err == nil {
+			return recordTime, nil
 		}
+	}
 
-		if record[0] != chip {
-			continue
+	// Klockslag på dygn N, där dag 1 är startdagen
+	fields := strings.Fields(strings.ToLower(text))
+	if len(fields) == 3 && fields[0] == "dag" {
+		day, err := strconv.Atoi(fields[1])
+		if err != nil || day < 1 {
+			return time.Time{}, fmt.Errorf("Ogiltig dag %q", fields[1])
 		}
-
-		recordTime, err := time.Parse("2006-01-02 15:04:05.000", record[1])
+		clock, err := time.Parse("15:04:05", fields[2])
 		if err != nil {
-			continue
-		}
-
-		// Avrunda tiden uppåt till närmsta sekund
-		recordTime = roundUpToSecond(recordTime)
-
-		// Kontrollera om tiden är efter den ogiltiga tiden och efter starttiden
-		if recordTime.After(invalidTime) && recordTime.After(race.StartTime) {
-			duration := recordTime.Sub(race.StartTime)
-			if duration >= race.MinTime {
-				// Kontrollera om denna specifika tid är markerad som ogiltig
-				timeKey := makeInvalidTimeKey(chip, recordTime)
-				if !race.InvalidTimes[timeKey] {
-					nextValidTime = recordTime
-					foundValid = true
-					break
-				}
-			}
+			return time.Time{}, fmt.Errorf("Ogiltigt klockslag %q, använd format HH:MM:SS", fields[2])
 		}
+		start := race.StartTime
+		return time.Date(start.Year(), start.Month(), start.Day()+day-1,
+			clock.Hour(), clock.Minute(), clock.Second(), 0, location), nil
 	}
 
-	return nextValidTime, foundValid
+	// Löptid från starten
+	if len(strings.Split(text, ":")) != 3 {
+		return time.Time{}, fmt.Errorf("Ogiltig tid, använd format HH:MM:SS")
+	}
+	elapsed, err := timeformat.ParseElapsed(text)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Ogiltig tid")
+	}
+	return race.StartTime.Add(elapsed), nil
 }
 
-// Manuell tidsinmatning
-func showAddTimeDialog(race Race, races []Race, index int, currentResults *[]ChipResult, originalResults *[]ChipResult, table *widget.Table, window fyne.Window) {
-	chipEntry := widget.NewEntry()
-	chipEntry.SetPlaceHolder("Startnummer")
-
-	timeEntry := widget.NewEntry()
-	timeEntry.SetPlaceHolder("Tid (HH:MM:SS)")
-	timeEntry.Text = "00:00:00"
-
-	dialog.ShowForm("Lägg till tid", "Lägg till", "Avbryt", []*widget.FormItem{
-		{Text: "Startnummer", Widget: chipEntry},
-		{Text: "Tid", Widget: timeEntry},
-	}, func(submitted bool) {
-		if !submitted {
-			return
-		}
+// Kontrollera startnummer och tid för en manuell tid innan något sparas
+func validateManualTime(race Race, chipText, timeText string) (string, time.Time, error) {
+	chip := strings.TrimSpace(chipText)
+	if chip == "" {
+		return "", time.Time{}, fmt.Errorf("Startnummer måste anges")
+	}
+	if !race.Chips[chip] {
+		return "", time.Time{}, fmt.Errorf("Startnummer %s finns inte registrerat i loppet", chip)
+	}
 
-		// Validera chip
-		chip := strings.TrimSpace(chipEntry.Text)
-		if chip == "" {
-			dialog.ShowError(fmt.Errorf("Startnummer måste anges"), window)
-			return
-		}
-		if !race.Chips[chip] {
-			dialog.ShowError(fmt.Errorf("Startnummer %s finns inte registrerat i loppet", chip), window)
-			return
-		}
+	recordTime, err := parseManualTime(race, timeText)
+	if err != nil {
+		return "", time.Time{}, err
+	}
 
-		// Parsa tiden
-		timeParts := strings.Split(timeEntry.Text, ":")
-		if len(timeParts) != 3 {
-			dialog.ShowError(fmt.Errorf("Ogiltig tid, använd format HH:MM:SS"), window)
-			return
-		}
+	if err := checkManualTimeLimit(race, recordTime); err != nil {
+		return "", time.Time{}, err
+	}
+	return chip, recordTime, nil
+}
 
-		hours, err1 := strconv.Atoi(timeParts[0])
-		minutes, err2 := strconv.Atoi(timeParts[1])
-		seconds, err3 := strconv.Atoi(timeParts[2])
-		if err1 != nil || err2 != nil || err3 != nil {
-			dialog.ShowError(fmt.Errorf("Ogiltig tid"), window)
-			return
-		}
+// Kontrollera att tiden är efter starttiden och uppfyller minimitiden
+func checkManualTimeLimit(race Race, recordTime time.Time) error {
+	if recordTime.Sub(race.StartTime) < race.MinTime {
+		return fmt.Errorf("Tiden är kortare än minimitiden")
+	}
+	return nil
+}
 
-		// Skapa tidpunkt baserat på loppets startdatum
-		recordTime := race.StartTime.Add(time.Duration(hours)*time.Hour +
-			time.Duration(minutes)*time.Minute +
-			time.Duration(seconds)*time.Second)
+// Nycklar för de giltiga tider för chipet som en manuell tid ersätter. keep är tider som
+// den manuella tiden redan ersatt och som ska fortsätta vara ogiltiga, skip är den manuella tiden själv.
+func supersededTimeKeys(race Race, chip string, keep []string, skip *ManualTime) []string {
+	keys := append([]string{}, keep...)
+	for _, result := range getAllResults(race) {
+		if result.Chip != chip || result.Invalid {
+			continue
+		}
+		if skip != nil && result.Manual && result.Chip == skip.Chip && result.Time.Equal(skip.Time) {
+			continue
+		}
+		keys = append(keys, makeInvalidTimeKey(result.Chip, result.Time))
+	}
+	return keys
+}
 
-		// Spara den manuella tiden
-		manualTimes, _ := loadManualTimes(race.Name)
-		manualTimes = append(manualTimes, ManualTime{
+// Journalhändelse för en ny manuell tid, alla chipets tidigare giltiga tider markeras som ogiltiga
+func newManualTimeEntry(race Race, chip string, recordTime time.Time, user string) JournalEntry {
+	return JournalEntry{
+		User: user,
+		Type: journalManualAdd,
+		Chip: chip,
+		Manual: &ManualTime{
+			ID:       newID(),
 			Chip:     chip,
 			Time:     recordTime,
+			RaceID:   race.ID,
 			RaceName: race.Name,
-		})
-		saveManualTimes(race.Name, manualTimes)
+		},
+		Keys: supersededTimeKeys(race, chip, nil, nil),
+	}
+}
 
-		// Kontrollera att tiden är efter starttiden och uppfyller minimitiden
-		duration := recordTime.Sub(race.StartTime)
-		if duration < race.MinTime {
-			dialog.ShowError(fmt.Errorf("Tiden är kortare än minimitiden"), window)
-			return
+// Journalhändelse för en ändrad manuell tid. Tider som den manuella tiden redan ersatt
+// följer med så länge startnumret är detsamma.
+func editedManualTimeEntry(race Race, mt ManualTime, chip string, recordTime time.Time) (JournalEntry, error) {
+	var keep []string
+	if chip == mt.Chip {
+		state, err := loadJournalState(race.ID)
+		if err != nil {
+			return JournalEntry{}, err
 		}
+		keep = state.ManualKeys[mt.ID]
+	}
 
-		// Markera alla existerande tider för detta chip som ogiltiga
-		for i := range *currentResults {
-			if (*currentResults)[i].Chip == chip {
-				(*currentResults)[i].Invalid = true
-				timeKey := makeInvalidTimeKey((*currentResults)[i].Chip, (*currentResults)[i].Time)
-				if race.InvalidTimes == nil {
-					race.InvalidTimes = make(map[string]bool)
-				}
-				race.InvalidTimes[timeKey] = true
-			}
-		}
-		for i := range *originalResults {
-			if (*originalResults)[i].Chip == chip {
-				(*originalResults)[i].Invalid = true
-				timeKey := makeInvalidTimeKey((*originalResults)[i].Chip, (*originalResults)[i].Time)
-				race.InvalidTimes[timeKey] = true
-			}
-		}
+	edited := mt
+	edited.Chip = chip
+	edited.Time = recordTime
+	return JournalEntry{
+		Type:   journalManualEdit,
+		Chip:   chip,
+		Manual: &edited,
+		Keys:   supersededTimeKeys(race, chip, keep, &mt),
+	}, nil
+}
 
-		// Lägg till det nya resultatet
-		newResult := ChipResult{
-			Chip:     chip,
-			Time:     recordTime,
-			Duration: duration,
-			Invalid:  false,
+// Hitta en läsning bland loppets tider
+func findChipRead(race Race, chip string, readTime time.Time) (ChipResult, error) {
+	for _, result := range getAllResults(race) {
+		if result.Chip == chip && result.Time.Equal(readTime) {
+			return result, nil
 		}
+	}
+	return ChipResult{}, fmt.Errorf("hittade ingen läsning av %s vid %s", chip, readTime.Format("2006-01-02 15:04:05"))
+}
 
-		*currentResults = append(*currentResults, newResult)
-		*originalResults = append(*originalResults, newResult)
-
-		// Sortera resultaten
-		sort.Slice(*currentResults, func(i, j int) bool {
-			return (*currentResults)[i].Time.Before((*currentResults)[j].Time)
-		})
-		sort.Slice(*originalResults, func(i, j int) bool {
-			return (*originalResults)[i].Time.Before((*originalResults)[j].Time)
-		})
-
-		// Spara ändringarna
-		races[index] = race
-		saveRaces(races)
-		cacheResults(race.Name, *originalResults)
-
-		// Uppdatera tabellen
-		table.Refresh()
-	}, window)
+// Tillåt löptid utan kolon för snabbare inmatning, 231105 blir 23:11:05 och 1105 blir 00:11:05
+func expandTimeDigits(text string) string {
+	text = strings.TrimSpace(text)
+	if len(text) < 3 || len(text) > 6 || strings.Trim(text, "0123456789") != "" {
+		return text
+	}
+	text = strings.Repeat("0", 6-len(text)) + text
+	return text[0:2] + ":" + text[2:4] + ":" + text[4:6]
 }
@@ -0,0 +1,170 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/jimmitjoo/hogby-tidtagning/internal/timeformat"
+)
+
+// Manuell tidsinmatning
+func showAddTimeDialog(race *Race, races []Race, index int, window fyne.Window, onChange func()) {
+	chipEntry := widget.NewEntry()
+	chipEntry.SetPlaceHolder("Startnummer")
+
+	timeEntry := widget.NewEntry()
+	timeEntry.SetPlaceHolder("Tid (HH:MM:SS, dag N HH:MM:SS eller YYYY-MM-DD HH:MM:SS)")
+	timeEntry.Text = "00:00:00"
+
+	dialog.ShowForm("Lägg till tid", "Lägg till", "Avbryt", []*widget.FormItem{
+		{Text: "Startnummer", Widget: chipEntry},
+		{Text: "Tid", Widget: timeEntry},
+	}, func(submitted bool) {
+		if !submitted {
+			return
+		}
+
+		chip, recordTime, err := validateManualTime(*race, chipEntry.Text, timeEntry.Text)
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+
+		// Alla existerande tider för detta chip markeras som ogiltiga
+		if _, err := recordJournalEntry(race, newManualTimeEntry(*race, chip, recordTime, "")); err != nil {
+			dialog.ShowError(fmt.Errorf("kunde inte spara tiden: %v", err), window)
+			return
+		}
+
+		// Spara ändringarna
+		races[index] = *race
+		if err := saveRace(*race); err != nil {
+			dialog.ShowError(err, window)
+		}
+
+		onChange()
+	}, window)
+}
+
+// Visa loppets manuella tider med möjlighet att ändra och ta bort dem
+func showManualTimes(race *Race, races []Race, index int, app fyne.App, onChange func()) {
+	window := app.NewWindow(fmt.Sprintf("Manuella tider - %s", race.Name))
+	list := container.NewVBox()
+
+	// Spara ett beslut i journalen och läs om listan
+	record := func(entry JournalEntry) bool {
+		if _, err := recordJournalEntry(race, entry); err != nil {
+			dialog.ShowError(fmt.Errorf("kunde inte spara ändringen: %v", err), window)
+			return false
+		}
+		races[index] = *race
+		if err := saveRace(*race); err != nil {
+			dialog.ShowError(err, window)
+		}
+		onChange()
+		return true
+	}
+
+	var refresh func()
+
+	editTime := func(mt ManualTime) {
+		chipEntry := widget.NewEntry()
+		chipEntry.SetText(mt.Chip)
+		timeEntry := widget.NewEntry()
+		timeEntry.SetPlaceHolder("Tid (HH:MM:SS, dag N HH:MM:SS eller YYYY-MM-DD HH:MM:SS)")
+		timeEntry.SetText(formatElapsedInput(mt.Time.Sub(race.StartTime)))
+
+		dialog.ShowForm("Ändra tid", "Spara", "Avbryt", []*widget.FormItem{
+			{Text: "Startnummer", Widget: chipEntry},
+			{Text: "Tid", Widget: timeEntry},
+		}, func(submitted bool) {
+			if !submitted {
+				return
+			}
+
+			chip, recordTime, err := validateManualTime(*race, chipEntry.Text, timeEntry.Text)
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+
+			entry, err := editedManualTimeEntry(*race, mt, chip, recordTime)
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+			if record(entry) {
+				refresh()
+			}
+		}, window)
+	}
+
+	deleteTime := func(mt ManualTime) {
+		dialog.ShowConfirm("Ta bort tid",
+			fmt.Sprintf("Vill du ta bort den manuella tiden %s för %s? Läsningar som tiden ersatte blir giltiga igen.",
+				timeformat.Duration(mt.Time.Sub(race.StartTime)), mt.Chip),
+			func(ok bool) {
+				if !ok {
+					return
+				}
+				deleted := mt
+				if record(JournalEntry{
+					Type:   journalManualDelete,
+					Chip:   mt.Chip,
+					Manual: &deleted,
+				}) {
+					refresh()
+				}
+			}, window)
+	}
+
+	refresh = func() {
+		list.RemoveAll()
+
+		manualTimes, err := loadManualTimes(race.ID)
+		if err != nil {
+			list.Add(widget.NewLabel(fmt.Sprintf("Kunde inte läsa manuella tider: %v", err)))
+			list.Refresh()
+			return
+		}
+		if len(manualTimes) == 0 {
+			list.Add(widget.NewLabel("Inga manuella tider"))
+		}
+
+		for _, mt := range manualTimes {
+			mt := mt
+			text := fmt.Sprintf("%s  %s  %s (%s)", mt.Chip, participantName(*race, mt.Chip),
+				timeformat.Duration(mt.Time.Sub(race.StartTime)), mt.Time.Format("15:04:05"))
+			if race.InvalidTimes[makeInvalidTimeKey(mt.Chip, mt.Time)] {
+				text += " - felaktig"
+			}
+
+			editButton := widget.NewButtonWithIcon("Ändra", theme.DocumentCreateIcon(), func() {
+				editTime(mt)
+			})
+			deleteButton := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+				deleteTime(mt)
+			})
+			deleteButton.Importance = widget.DangerImportance
+
+			list.Add(container.NewBorder(nil, nil, nil,
+				container.NewHBox(editButton, deleteButton), widget.NewLabel(text)))
+		}
+		list.Refresh()
+	}
+	refresh()
+
+	window.SetContent(container.NewPadded(container.NewBorder(
+		widget.NewLabel("Manuellt inmatade tider, klicka Ändra för att rätta en felskriven tid"),
+		nil, nil, nil,
+		container.NewVScroll(list),
+	)))
+	window.Resize(fyne.NewSize(700, 600))
+	window.Show()
+}
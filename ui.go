@@ -1,3 +1,5 @@
+//go:build !headless
+
 package main
 
 import (
@@ -7,21 +9,66 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 
 	"github.com/jimmitjoo/hogby-tidtagning/internal/services/sheets"
+	"github.com/jimmitjoo/hogby-tidtagning/internal/timeformat"
 	"github.com/jimmitjoo/hogby-tidtagning/internal/ui/dialogs"
 )
 
+type ResultWindow struct {
+	currentResults  []ChipResult
+	originalResults []ChipResult
+	window          fyne.Window
+	table           *widget.Table
+	searchEntry     *widget.Entry
+}
+
+// Starta filövervakning för ett lopp och uppdatera dess resultatfönster och huvudfönstret vid ändringar
+func CreateFileWatcher(race Race, races []Race, index int, window fyne.Window, updateUI func(), appState *AppState) (func(), error) {
+	return watchRaceResults(race, func(newResults []ChipResult) {
+		// Uppdatera resultatfönstret om det är öppet
+		windowID := resultWindowID(race)
+		if rw, exists := appState.GetResultWindow(windowID); exists {
+			getLogger().Log("Uppdaterar öppet resultatfönster för %s", race.Name)
+
+			// Uppdatera data
+			rw.originalResults = newResults
+
+			// Uppdatera currentResults med hänsyn till sökning
+			if rw.searchEntry != nil && rw.searchEntry.Text != "" {
+				rw.currentResults = updateResults(newResults, rw.searchEntry.Text)
+			} else {
+				rw.currentResults = newResults
+			}
+
+			// Uppdatera tabellen
+			if rw.table != nil {
+				// Uppdatera längdfunktionen
+				rw.table.Length = func() (int, int) {
+					return len(rw.currentResults) + 1, 3
+				}
+				rw.table.Refresh()
+				getLogger().Log("Uppdaterade tabell med %d resultat", len(rw.currentResults))
+			}
+		}
+
+		// Uppdatera huvudfönstret
+		updateUI()
+	})
+}
+
 func updateAllUI(race *Race, updateMainWindow func(), appState *AppState) {
 	// 1. Uppdatera alla öppna resultatfönster för detta lopp
-	windowID := fmt.Sprintf("results_%s", race.Name)
+	windowID := resultWindowID(*race)
 	if rw, exists := appState.GetResultWindow(windowID); exists {
 		// Uppdatera data
 		newResults := getAllResults(*race)
@@ -65,19 +112,28 @@ func updateAllUI(race *Race, updateMainWindow func(), appState *AppState) {
 }
 
 // Uppdatera toggleLiveUpdate för att använda den nya funktionen
-func toggleLiveUpdate(race *Race, races []Race, index int, updateUI func(), appState *AppState) {
+func toggleLiveUpdate(race *Race, races []Race, index int, updateUI func(), appState *AppState) error {
+	// Övervakningen kan alltid stoppas men bara startas medan loppet pågår
+	if !race.LiveUpdate && !raceCanWatch(*race) {
+		return raceNotWatchableError(*race)
+	}
+
 	// Ändra status först
 	race.LiveUpdate = !race.LiveUpdate
 	races[index] = *race
-	saveRaces(races)
+	if err := saveRace(*race); err != nil {
+		race.LiveUpdate = !race.LiveUpdate
+		races[index] = *race
+		return err
+	}
 
 	// Uppdatera alla UI-komponenter först
 	updateAllUI(race, updateUI, appState)
 
 	// Hantera filewatcher efter UI-uppdateringen
 	if race.LiveUpdate {
-		if _, exists := appState.stopWatchers[race.Name]; exists {
-			return
+		if appState.HasStopWatcher(race.ID) {
+			return nil
 		}
 		stopWatcher, err := CreateFileWatcher(*race, races, index, nil, func() {
 			updateAllUI(race, updateUI, appState)
@@ -86,21 +142,24 @@ func toggleLiveUpdate(race *Race, races []Race, index int, updateUI func(), appS
 			getLogger().Log("Fel vid start av övervakning: %v", err)
 			race.LiveUpdate = false
 			races[index] = *race
-			saveRaces(races)
+			if err := saveRace(*race); err != nil {
+				getLogger().Log("Kunde inte spara loppet %s: %v", race.Name, err)
+			}
 			// Uppdatera UI igen efter felhantering
 			updateAllUI(race, updateUI, appState)
 		} else {
-			appState.AddStopWatcher(race.Name, stopWatcher)
+			appState.AddStopWatcher(race.ID, stopWatcher)
 		}
 	} else {
-		appState.RemoveStopWatcher(race.Name)
+		appState.RemoveStopWatcher(race.ID)
 	}
+	return nil
 }
 
 // Uppdatera showResults-funktionen för att hantera sökning
 func showResults(resultTable *widget.Table, race Race, races []Race, index int, app fyne.App, updateRaceList func(), appState *AppState) {
 	resultWindow := app.NewWindow(fmt.Sprintf("Resultat - %s", race.Name))
-	windowID := fmt.Sprintf("results_%s", race.Name)
+	windowID := resultWindowID(race)
 
 	// Spara originalresultaten
 	originalResults := getAllResults(race)
@@ -150,15 +209,7 @@ func showResults(resultTable *widget.Table, race Race, races []Race, index int,
 				case 0:
 					label.SetText(result.Chip)
 				case 1:
-					minutes := int(result.Duration.Minutes())
-					seconds := int(result.Duration.Seconds()) % 60
-					if minutes >= 60 {
-						hours := minutes / 60
-						minutes = minutes % 60
-						label.SetText(fmt.Sprintf("%02d:%02d:%02d", hours, minutes, seconds))
-					} else {
-						label.SetText(fmt.Sprintf("%02d:%02d", minutes, seconds))
-					}
+					label.SetText(timeformat.Duration(result.Duration))
 				case 2:
 					if result.Invalid {
 						label.SetText("Felaktig")
@@ -177,125 +228,53 @@ func showResults(resultTable *widget.Table, race Race, races []Race, index int,
 	table.SetColumnWidth(1, 150)
 	table.SetColumnWidth(2, 150)
 
+	// Sökfältet skapas här eftersom omladdningen av resultaten behöver det
+	searchEntry := widget.NewEntry()
+	searchEntry.SetPlaceHolder("Sök startnummer...")
+
+	// Läs om resultaten efter en ändring och uppdatera tabellen och huvudfönstret
+	reloadResults := func() {
+		originalResults = getAllResults(race)
+		currentResults = updateResults(originalResults, searchEntry.Text)
+		table.Refresh()
+		updateRaceList()
+	}
+
 	// Lägg till klickhantering för tabellen
 	table.OnSelected = func(id widget.TableCellID) {
 		// Ignorera klick på rubrikraden
-		if id.Row == 0 {
+		if id.Row == 0 || id.Row > len(currentResults) {
 			table.UnselectAll()
 			return
 		}
 
 		// Hämta resultat för den klickade raden
 		result := currentResults[id.Row-1]
+		table.UnselectAll()
 
-		// Skapa tidsnyckel
-		timeKey := makeInvalidTimeKey(result.Chip, result.Time)
-
-		// Växla ogiltig-status
-		result.Invalid = !result.Invalid
-		currentResults[id.Row-1].Invalid = result.Invalid
-
-		if result.Invalid && race.ResultsFile != "" {
-			// Om tiden markeras som ogiltig, försök hitta nästa giltiga tid
-			if nextTime, found := findNextValidTime(race.ResultsFile, race, result.Time, result.Chip); found {
-				// Kontrollera om tiden redan finns i resultaten
-				timeExists := false
-				for _, existing := range currentResults {
-					if existing.Chip == result.Chip && existing.Time.Equal(nextTime) {
-						timeExists = true
-						break
-					}
-				}
-
-				// Lägg bara till tiden om den inte redan finns
-				if !timeExists {
-					// Lägg till den nya tiden i resultaten
-					duration := nextTime.Sub(race.StartTime)
-					newResult := ChipResult{
-						Chip:     result.Chip,
-						Time:     nextTime,
-						Duration: duration,
-						Invalid:  false,
-					}
-
-					// Lägg till i både current och original results
-					currentResults = append(currentResults, newResult)
-					originalResults = append(originalResults, newResult)
-
-					// Sortera resultaten efter tid
-					sort.Slice(currentResults, func(i, j int) bool {
-						return currentResults[i].Time.Before(currentResults[j].Time)
-					})
-					sort.Slice(originalResults, func(i, j int) bool {
-						return originalResults[i].Time.Before(originalResults[j].Time)
-					})
-				}
-			}
-		} else {
-			// Om vi avmarkerar en tid som felaktig, ta bort eventuella senare tider för samma chip
-			// Skapa nya slices utan de senare tiderna
-			newCurrentResults := []ChipResult{}
-			newOriginalResults := []ChipResult{}
-
-			foundValidTime := false
-			for _, r := range currentResults {
-				if r.Chip == result.Chip {
-					if !foundValidTime {
-						newCurrentResults = append(newCurrentResults, r)
-						foundValidTime = true
-					}
-				} else {
-					newCurrentResults = append(newCurrentResults, r)
-				}
-			}
-
-			foundValidTime = false
-			for _, r := range originalResults {
-				if r.Chip == result.Chip {
-					if !foundValidTime {
-						newOriginalResults = append(newOriginalResults, r)
-						foundValidTime = true
-					}
-				} else {
-					newOriginalResults = append(newOriginalResults, r)
-				}
-			}
-
-			currentResults = newCurrentResults
-			originalResults = newOriginalResults
-		}
-
-		// Uppdatera originalResults också
-		for i := range originalResults {
-			if originalResults[i].Chip == result.Chip && originalResults[i].Time.Equal(result.Time) {
-				originalResults[i].Invalid = result.Invalid
-				break
-			}
-		}
-
-		// Uppdatera race.InvalidTimes
+		// Växla ogiltig-status, nästa giltiga tid för chipet visas när resultaten läses om
+		entryType := journalInvalidate
 		if result.Invalid {
-			race.InvalidTimes[timeKey] = true
-		} else {
-			delete(race.InvalidTimes, timeKey)
+			entryType = journalValidate
+		}
+		if _, err := recordJournalEntry(&race, JournalEntry{
+			Type:     entryType,
+			Chip:     result.Chip,
+			ReadTime: &result.Time,
+		}); err != nil {
+			dialog.ShowError(fmt.Errorf("kunde inte spara ändringen: %v", err), resultWindow)
+			return
 		}
 
 		// Spara ändringarna
 		races[index] = race
-		saveRaces(races)
-
-		// Uppdatera cachade resultat
-		cacheResults(race.Name, originalResults)
+		if err := saveRace(race); err != nil {
+			dialog.ShowError(err, resultWindow)
+		}
 
-		// Avmarkera raden och uppdatera tabellen
-		table.UnselectAll()
-		table.Refresh()
+		reloadResults()
 	}
 
-	// Sedan kan vi skapa sökfältet och watch-knappen
-	searchEntry := widget.NewEntry()
-	searchEntry.SetPlaceHolder("Sök startnummer...")
-
 	// Skapa watch-knappen med alla egenskaper direkt
 	watchButtonText := "Starta automatisk uppdatering"
 	watchButtonIcon := theme.MediaPlayIcon()
@@ -324,8 +303,16 @@ func showResults(resultTable *widget.Table, race Race, races []Race, index int,
 			watchButton.SetText("Starta automatisk uppdatering")
 			watchButton.Importance = widget.SuccessImportance // Grön för att starta
 		}
+		// Övervakningen kan bara startas medan loppet pågår
+		if race.LiveUpdate || raceCanWatch(race) {
+			watchButton.Enable()
+		} else {
+			watchButton.Disable()
+		}
 	}
 
+	updateWatchButtonState()
+
 	// Skapa en updateUI-funktion som uppdaterar både huvudfönstret och resultatfönstret
 	updateUI := func() {
 		updateRaceList()
@@ -335,7 +322,9 @@ func showResults(resultTable *widget.Table, race Race, races []Race, index int,
 
 	// Sätt OnTapped
 	watchButton.OnTapped = func() {
-		toggleLiveUpdate(&race, races, index, updateUI, appState)
+		if err := toggleLiveUpdate(&race, races, index, updateUI, appState); err != nil {
+			dialog.ShowError(err, resultWindow)
+		}
 	}
 
 	// Skapa en scroll container för tabellen
@@ -344,14 +333,92 @@ func showResults(resultTable *widget.Table, race Race, races []Race, index int,
 
 	// Lägg till knapp för manuell tidsinmatning
 	addTimeButton := widget.NewButton("Lägg till tid", func() {
-		showAddTimeDialog(race, races, index, &currentResults, &originalResults, table, resultWindow)
+		showAddTimeDialog(&race, races, index, resultWindow, reloadResults)
+	})
+
+	// Lägg till knapp för att ändra och ta bort manuella tider
+	manualTimesButton := widget.NewButton("Manuella tider", func() {
+		showManualTimes(&race, races, index, app, reloadResults)
+	})
+
+	// Lägg till knapp för att mata in många tider i följd
+	rapidEntryButton := widget.NewButton("Snabbinmatning", func() {
+		showRapidEntry(&race, races, index, app, reloadResults)
+	})
+
+	// Lägg till knapp för att registrera måltider först och startnummer efteråt
+	captureButton := widget.NewButton("Målfångst", func() {
+		showFinishCapture(&race, races, index, app, reloadResults)
+	})
+
+	// Lägg till knapp för att importera tider från en fil, t.ex. en reservklocka
+	importTimesButton := widget.NewButton("Importera tider...", func() {
+		showTimeImport(&race, races, index, app, resultWindow, reloadResults)
+	})
+
+	// Lägg till knapp för att stämma av chiptiderna mot en reservtidtagning
+	reconcileButton := widget.NewButton("Avstämning", func() {
+		showReconcile(&race, races, index, app, reloadResults)
+	})
+
+	// Ångra och gör om beslut i journalen
+	undo := func() {
+		target, err := undoJournal(&race)
+		if err != nil {
+			dialog.ShowError(err, resultWindow)
+			return
+		}
+		races[index] = race
+		if err := saveRace(race); err != nil {
+			dialog.ShowError(err, resultWindow)
+		}
+		reloadResults()
+		getLogger().Log("Ångrade: %s", describeJournalEntry(target))
+	}
+	redo := func() {
+		target, err := redoJournal(&race)
+		if err != nil {
+			dialog.ShowError(err, resultWindow)
+			return
+		}
+		races[index] = race
+		if err := saveRace(race); err != nil {
+			dialog.ShowError(err, resultWindow)
+		}
+		reloadResults()
+		getLogger().Log("Gjorde om: %s", describeJournalEntry(target))
+	}
+	undoButton := widget.NewButtonWithIcon("Ångra", theme.ContentUndoIcon(), undo)
+	redoButton := widget.NewButtonWithIcon("Gör om", theme.ContentRedoIcon(), redo)
+	historyButton := widget.NewButton("Historik", func() {
+		showJournalHistory(race, resultWindow)
+	})
+
+	// Ctrl+Z och Ctrl+Y fungerar även under målgångsrusningen
+	resultWindow.Canvas().AddShortcut(&desktop.CustomShortcut{
+		KeyName:  fyne.KeyZ,
+		Modifier: fyne.KeyModifierShortcutDefault,
+	}, func(fyne.Shortcut) { undo() })
+	resultWindow.Canvas().AddShortcut(&desktop.CustomShortcut{
+		KeyName:  fyne.KeyY,
+		Modifier: fyne.KeyModifierShortcutDefault,
+	}, func(fyne.Shortcut) { redo() })
+
+	// Lägg till knapp för diagnostik av läsarfilen
+	diagnosticsButton := widget.NewButton("Diagnostik", func() {
+		showDiagnostics(&race, races, index, app, reloadResults)
+	})
+
+	// Lägg till knapp för närvarorapport vid start
+	startPresenceButton := widget.NewButton("Närvaro vid start", func() {
+		showStartPresence(&race, races, index, app, reloadResults)
 	})
 
 	// Lägg till exportknapp
 	exportButton := widget.NewButton("Exportera till Google Sheets", func() {
 		if race.SpreadsheetId != "" && race.SheetName != "" {
 			// Använd sparade värden
-			exportToSheets(race, races, index, resultWindow)
+			exportToSheets(&race, races, index, resultWindow)
 		} else {
 			// Visa dialog för att få värden
 			dialogs.ShowExportDialog(resultWindow, func(spreadsheetId, sheetName string) {
@@ -359,9 +426,12 @@ func showResults(resultTable *widget.Table, race Race, races []Race, index int,
 				race.SpreadsheetId = spreadsheetId
 				race.SheetName = sheetName
 				races[index] = race
-				saveRaces(races)
+				if err := saveRace(race); err != nil {
+					dialog.ShowError(err, resultWindow)
+					return
+				}
 
-				exportToSheets(race, races, index, resultWindow)
+				exportToSheets(&race, races, index, resultWindow)
 			})
 		}
 	})
@@ -395,9 +465,22 @@ func showResults(resultTable *widget.Table, race Race, races []Race, index int,
 		content.Add(widget.NewSeparator())
 	}
 
+	// Officiella och arkiverade resultat kan bara visas tills loppet öppnas igen
+	if !raceResultsEditable(race) {
+		lockedLabel := widget.NewLabel(fmt.Sprintf("Resultaten är låsta (%s)", raceStatusLabel(raceStatus(race))))
+		lockedLabel.Importance = widget.WarningImportance
+		content.Add(lockedLabel)
+		for _, button := range []*widget.Button{addTimeButton, rapidEntryButton, manualTimesButton, captureButton, importTimesButton, reconcileButton, undoButton, redoButton, diagnosticsButton, startPresenceButton} {
+			button.Disable()
+		}
+	}
+
 	content.Add(searchEntry)
 	content.Add(watchButton)
-	content.Add(addTimeButton)
+	content.Add(container.NewHBox(addTimeButton, rapidEntryButton, manualTimesButton, captureButton, importTimesButton, reconcileButton))
+	content.Add(container.NewHBox(undoButton, redoButton, historyButton))
+	content.Add(diagnosticsButton)
+	content.Add(startPresenceButton)
 	content.Add(exportButton)
 	content.Add(widget.NewLabel("Klicka på en rad för att markera/avmarkera den som felaktig"))
 	content.Add(tableContainer)
@@ -416,12 +499,12 @@ func showResults(resultTable *widget.Table, race Race, races []Race, index int,
 		}
 		// Ta även bort watchern från stopWatchers om den finns där
 		if race.LiveUpdate {
-			if sw, exists := appState.stopWatchers[race.Name]; exists {
-				sw()
-				delete(appState.stopWatchers, race.Name)
+			if appState.RemoveStopWatcher(race.ID) {
 				race.LiveUpdate = false
 				races[index] = race
-				saveRaces(races)
+				if err := saveRace(race); err != nil {
+					getLogger().Log("Kunde inte spara loppet %s: %v", race.Name, err)
+				}
 				updateRaceList()
 			}
 		}
@@ -460,28 +543,90 @@ func makeRaceListItem(race Race, races []Race, index int, app fyne.App, updateUI
 	nameLabel.TextStyle = fyne.TextStyle{Bold: true}
 
 	// Hämta resultat
-	results := getAllResults(race)
+	results := readAllResults(race)
 
 	startTimeStr := race.StartTime.Format("2006-01-02 15:04")
 	timeLabel := widget.NewLabel(fmt.Sprintf("Starttid: %s", startTimeStr))
 
-	participantsLabel := widget.NewLabel(fmt.Sprintf("Anmälda: %d", len(race.Chips)))
+	participantsText := fmt.Sprintf("Anmälda: %d", len(race.Chips))
+	if len(race.DNS) > 0 {
+		participantsText += fmt.Sprintf(" (DNS: %d)", len(race.DNS))
+	}
+	participantsLabel := widget.NewLabel(participantsText)
 
 	finishersLabel := widget.NewLabel(fmt.Sprintf("Antal i mål: %d", len(results)-len(race.InvalidTimes)))
 
+	statusLabel := widget.NewLabel(fmt.Sprintf("Status: %s", raceStatusLabel(raceStatus(race))))
+	statusLabel.TextStyle = fyne.TextStyle{Italic: true}
+
 	buttons := raceListButtons(race, races, index, app, updateUI, appState)
 
 	// Skapa en container för all information
-	return container.NewVBox(
+	item := container.NewVBox(
 		nameLabel,
 		container.NewHBox(
 			timeLabel,
 			participantsLabel,
 			finishersLabel,
+			statusLabel,
 		),
-		buttons,
-		widget.NewSeparator(),
 	)
+
+	// Visa läsarstatus för lopp som pågår, etiketten uppdateras av läsarövervakningen
+	healthLabel := widget.NewLabel("")
+	appState.SetHealthLabel(race.ID, healthLabel)
+	item.Add(healthLabel)
+	appState.RefreshReaderHealth([]Race{race})
+
+	item.Add(buttons)
+	item.Add(raceStatusButtons(race, races, index, app.Driver().AllWindows()[0], updateUI, appState))
+	item.Add(widget.NewSeparator())
+	return item
+}
+
+// Hjälpfunktion för att beskriva läsarstatus i klartext
+func formatReaderHealth(health ReaderHealth) string {
+	lastRead := "inga läsningar"
+	if !health.LastRead.IsZero() {
+		lastRead = "senaste " + health.LastRead.Format("15:04:05")
+	}
+
+	seenShare := 0
+	if health.ChipsRegistered > 0 {
+		seenShare = health.ChipsSeen * 100 / health.ChipsRegistered
+	}
+
+	return fmt.Sprintf("Läsare: %d läsningar/min, %s, %d%% av startnumren sedda (%d av %d)",
+		health.ReadsLastMinute, lastRead, seenShare, health.ChipsSeen, health.ChipsRegistered)
+}
+
+// Skapa varningar för läsare som varit tysta för länge under pågående lopp
+func makeReaderAlarms(races []Race, appState *AppState) []fyne.CanvasObject {
+	var alarms []fyne.CanvasObject
+	now := time.Now()
+
+	for _, race := range races {
+		if !isRaceRunning(race, now) {
+			continue
+		}
+		health, exists := appState.GetReaderHealth(race.ID)
+		if !exists {
+			continue
+		}
+
+		silence := readerSilence(race, health, now)
+		if silence <= silenceAlarmLimit(race) {
+			continue
+		}
+
+		alarm := widget.NewLabel(fmt.Sprintf("VARNING: Läsaren för %s har inte skrivit något på %d minuter (%s)",
+			race.Name, int(silence.Minutes()), health.File))
+		alarm.Importance = widget.DangerImportance
+		alarm.TextStyle = fyne.TextStyle{Bold: true}
+		alarms = append(alarms, alarm)
+	}
+
+	return alarms
 }
 
 func raceListButtons(race Race, races []Race, index int, app fyne.App, updateUI func(), appState *AppState) *fyne.Container {
@@ -504,6 +649,12 @@ func raceListButtons(race Race, races []Race, index int, app fyne.App, updateUI
 			watchButton.SetText("Starta automatisk uppdatering")
 			watchButton.Importance = widget.SuccessImportance // Grön för att starta
 		}
+		// Övervakningen kan bara startas medan loppet pågår
+		if race.LiveUpdate || raceCanWatch(race) {
+			watchButton.Enable()
+		} else {
+			watchButton.Disable()
+		}
 	}
 
 	// Sätt initialt utseende
@@ -511,7 +662,9 @@ func raceListButtons(race Race, races []Race, index int, app fyne.App, updateUI
 
 	// Sätt OnTapped
 	watchButton.OnTapped = func() {
-		toggleLiveUpdate(&race, races, index, updateUI, appState)
+		if err := toggleLiveUpdate(&race, races, index, updateUI, appState); err != nil {
+			dialog.ShowError(err, app.Driver().AllWindows()[0])
+		}
 	}
 
 	// Skapa knapp för att välja resultatfil
@@ -532,7 +685,10 @@ func raceListButtons(race Race, races []Race, index int, app fyne.App, updateUI
 			// Uppdatera loppet med den nya filen
 			race.ResultsFile = filename
 			races[index] = race
-			saveRaces(races)
+			if err := saveRace(race); err != nil {
+				dialog.ShowError(err, app.Driver().AllWindows()[0])
+				return
+			}
 
 			// Visa resultat direkt efter att filen valts
 			showResults(nil, race, races, index, app, updateUI, appState)
@@ -543,6 +699,17 @@ func raceListButtons(race Race, races []Race, index int, app fyne.App, updateUI
 		d.Show()
 	})
 
+	// Skapa knapp för att ändra loppets inställningar
+	editButton := widget.NewButtonWithIcon("Ändra", theme.DocumentCreateIcon(), func() {
+		showEditRace(race, races, index, app.Driver().AllWindows()[0], updateUI, appState)
+	})
+
+	// Skapa startknappen, tiden tas i samma ögonblick som knappen trycks
+	startButton := widget.NewButtonWithIcon("Starta nu", theme.MediaRecordIcon(), func() {
+		showStartNow(race, races, index, app.Driver().AllWindows()[0], updateUI, appState)
+	})
+	startButton.Importance = widget.WarningImportance
+
 	// Skapa ta bort-knappen
 	deleteButton := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
 		dialog.ShowConfirm("Ta bort lopp",
@@ -550,32 +717,24 @@ func raceListButtons(race Race, races []Race, index int, app fyne.App, updateUI
 			func(ok bool) {
 				if ok {
 					// Ta bort eventuell watcher
-					appState.RemoveStopWatcher(race.Name)
-
-					// Ta bort loppet från slicen
-					// Läs in den aktuella listan med lopp
-					currentRaces, err := loadRaces()
-					if err != nil {
-						dialog.ShowError(err, app.Driver().AllWindows()[0])
-						return
-					}
+					appState.RemoveStopWatcher(race.ID)
 
-					// Hitta och ta bort rätt lopp baserat på namn och starttid
-					for i, r := range currentRaces {
-						if r.Name == race.Name && r.StartTime.Equal(race.StartTime) {
-							currentRaces = append(currentRaces[:i], currentRaces[i+1:]...)
-							break
+					// Ta bort loppet ur den aktuella listan på disk
+					err := updateRaces(func(loaded []Race) ([]Race, error) {
+						for i, r := range loaded {
+							if r.ID == race.ID {
+								return append(loaded[:i], loaded[i+1:]...), nil
+							}
 						}
-					}
-
-					// Spara den uppdaterade listan
-					if err := saveRaces(currentRaces); err != nil {
+						return loaded, nil
+					})
+					if err != nil {
 						dialog.ShowError(err, app.Driver().AllWindows()[0])
 						return
 					}
 
 					// Ta bort cachade resultat
-					os.Remove(fmt.Sprintf("results_%s.json", race.Name))
+					os.Remove(resultsCacheFilename(race.ID))
 
 					// Uppdatera UI med den nya listan av lopp
 					updateUI()
@@ -585,12 +744,29 @@ func raceListButtons(race Race, races []Race, index int, app fyne.App, updateUI
 	deleteButton.Importance = widget.DangerImportance
 
 	// Skapa en container för knapparna
-	buttons := container.NewHBox(resultsButton, fileButton, watchButton, deleteButton)
+	// Officiella resultat låses, starten kan bara registreras innan loppet avslutats
+	editable := raceResultsEditable(race)
+	if !editable {
+		fileButton.Disable()
+		editButton.Disable()
+	}
+
+	buttons := container.NewHBox(resultsButton, fileButton, watchButton)
+	if raceCanStart(race) {
+		buttons.Add(startButton)
+	}
+	if race.StartChip != "" && raceCanStart(race) {
+		buttons.Add(widget.NewButton("Start från startchip", func() {
+			showStartFromChip(race, races, index, app.Driver().AllWindows()[0], updateUI, appState)
+		}))
+	}
+	buttons.Add(editButton)
+	buttons.Add(deleteButton)
 	return buttons
 }
 
 // Lägg till denna hjälpfunktion för att hantera exporten
-func exportToSheets(race Race, races []Race, index int, resultWindow fyne.Window) {
+func exportToSheets(race *Race, races []Race, index int, resultWindow fyne.Window) {
 	// Hitta exportknappen och inaktivera den
 	content := resultWindow.Content().(*fyne.Container)
 	var exportButton *widget.Button
@@ -624,46 +800,7 @@ func exportToSheets(race Race, races []Race, index int, resultWindow fyne.Window
 		return
 	}
 
-	// Konvertera resultat till sheets.Result
-	results := getAllResults(race)
-
-	// Skapa en map för att hålla alla tider för varje startnummer
-	chipTimes := make(map[string][]sheets.Result)
-
-	// Samla alla tider per startnummer
-	for _, r := range results {
-		chipTimes[r.Chip] = append(chipTimes[r.Chip], sheets.Result{
-			Chip:     r.Chip,
-			Time:     r.Time,
-			Duration: r.Duration,
-			Invalid:  r.Invalid,
-			Manual:   r.Manual,
-		})
-	}
-
-	// Välj den första giltiga tiden för varje startnummer
-	var sheetsResults []sheets.Result
-	for _, times := range chipTimes {
-		// Sortera tider för detta startnummer efter tidpunkt
-		sort.Slice(times, func(i, j int) bool {
-			return times[i].Time.Before(times[j].Time)
-		})
-
-		// Hitta första giltiga tiden
-		for _, time := range times {
-			if !time.Invalid {
-				sheetsResults = append(sheetsResults, time)
-				break
-			}
-		}
-	}
-
-	// Sortera resultaten efter startnummer
-	sort.Slice(sheetsResults, func(i, j int) bool {
-		ni, _ := strconv.Atoi(sheetsResults[i].Chip)
-		nj, _ := strconv.Atoi(sheetsResults[j].Chip)
-		return ni < nj
-	})
+	sheetsResults := sheetsResultsForRace(*race)
 
 	// Exportera resultaten
 	err = sheetsService.ExportResults(race.SpreadsheetId, race.SheetName, sheetsResults)
@@ -679,6 +816,13 @@ func exportToSheets(race Race, races []Race, index int, resultWindow fyne.Window
 		dialog.ShowError(fmt.Errorf("kunde inte exportera resultat: %v", err), resultWindow)
 		return
 	}
+
+	// Spara vilka resultat som exporterades så att senare ändringar av loppet kan varna
+	markResultsExported(race)
+	races[index] = *race
+	if err := saveRace(*race); err != nil {
+		dialog.ShowError(err, resultWindow)
+	}
 }
 
 // Lägg till denna hjälpfunktion för att hitta saknade nummer
@@ -694,7 +838,7 @@ func getMissingNumbers(race Race, results []ChipResult) []string {
 	// Samla alla saknade nummer
 	var missing []string
 	for chip := range race.Chips {
-		if !hasTime[chip] {
+		if !hasTime[chip] && !race.DNS[chip] {
 			missing = append(missing, chip)
 		}
 	}
@@ -2,61 +2,59 @@ package main
 
 import (
 	"fmt"
-	"fyne.io/fyne/v2"
+	"io"
 	"os"
+	"strings"
 	"time"
 )
 
-func CreateFileWatcher(race Race, races []Race, index int, window fyne.Window, updateUI func(), appState *AppState) (func(), error) {
-	return watchFile(race.ResultsFile, race.Name, func() {
+// Hur länge en läsare får vara tyst under ett pågående lopp om inget annat angetts
+const defaultSilenceAlarm = 5 * time.Minute
+
+// Hur ofta läsarstatus räknas om för pågående lopp
+const readerMonitorInterval = 10 * time.Second
+
+// Övervaka loppets läsarfil och räkna om resultat och cache när filen ändras. Läsarstatus
+// sköts av startReaderMonitor. onResults anropas med de nya resultaten, utan koppling till något gränssnitt.
+func watchRaceResults(race Race, onResults func(results []ChipResult)) (func(), error) {
+	return watchFile(race.ResultsFile, race, func() {
 		getLogger().Log("Processar resultat för lopp: %s", race.Name)
 
 		// Hämta nya resultat
-		newResults := getAllResults(race)
+		race.InvalidTimes = savedInvalidTimes(race)
+		newResults := readAllResults(race)
 		getLogger().Log("Hämtade %d nya resultat", len(newResults))
 
-		// Uppdatera resultatfönstret om det är öppet
-		windowID := fmt.Sprintf("results_%s", race.Name)
-		if rw, exists := appState.GetResultWindow(windowID); exists {
-			getLogger().Log("Uppdaterar öppet resultatfönster för %s", race.Name)
-
-			// Uppdatera data
-			rw.originalResults = newResults
-
-			// Uppdatera currentResults med hänsyn till sökning
-			if rw.searchEntry != nil && rw.searchEntry.Text != "" {
-				rw.currentResults = updateResults(newResults, rw.searchEntry.Text)
-			} else {
-				rw.currentResults = newResults
-			}
-
-			// Uppdatera tabellen
-			if rw.table != nil {
-				// Uppdatera längdfunktionen
-				rw.table.Length = func() (int, int) {
-					return len(rw.currentResults) + 1, 3
-				}
-				rw.table.Refresh()
-				getLogger().Log("Uppdaterade tabell med %d resultat", len(rw.currentResults))
-			}
-		}
-
 		// Spara de nya resultaten i cache
-		if err := cacheResults(race.Name, newResults); err != nil {
+		if err := cacheResults(race.ID, newResults); err != nil {
 			getLogger().Log("Fel vid cachning av resultat: %v", err)
 		}
 
-		// Uppdatera huvudfönstret
-		updateUI()
+		onResults(newResults)
 	})
 }
 
-func watchFile(filename string, raceName string, callback func()) (func(), error) {
+// Felmarkeringarna kan ha ändrats sedan övervakningen startade, läs de senast sparade
+func savedInvalidTimes(race Race) map[string]bool {
+	races, err := loadRaces()
+	if err != nil {
+		getLogger().Log("Kunde inte läsa felmarkeringar för %s: %v", race.Name, err)
+		return race.InvalidTimes
+	}
+	for _, saved := range races {
+		if saved.ID == race.ID {
+			return saved.InvalidTimes
+		}
+	}
+	return race.InvalidTimes
+}
+
+func watchFile(filename string, race Race, callback func()) (func(), error) {
 	if filename == "" {
 		return nil, fmt.Errorf("ingen fil att övervaka")
 	}
 
-	getLogger().Log("Startar övervakning av fil: %s för lopp: %s", filename, raceName)
+	getLogger().Log("Startar övervakning av fil: %s för lopp: %s", filename, race.Name)
 
 	lastModified, err := getFileModTime(filename)
 	if err != nil {
@@ -73,7 +71,7 @@ func watchFile(filename string, raceName string, callback func()) (func(), error
 		for {
 			select {
 			case <-quit:
-				getLogger().Log("Stoppar övervakning av fil: %s för lopp: %s", filename, raceName)
+				getLogger().Log("Stoppar övervakning av fil: %s för lopp: %s", filename, race.Name)
 				done <- true
 				return
 			case <-ticker.C:
@@ -87,8 +85,7 @@ func watchFile(filename string, raceName string, callback func()) (func(), error
 					getLogger().Log("Fil ändrad: %s, anropar callback", filename)
 
 					// Ta bort cache innan vi läser nya resultat
-					cacheFile := fmt.Sprintf("results_%s.json", raceName)
-					if err := os.Remove(cacheFile); err != nil && !os.IsNotExist(err) {
+					if err := os.Remove(resultsCacheFilename(race.ID)); err != nil && !os.IsNotExist(err) {
 						getLogger().Log("Kunde inte ta bort cache: %v", err)
 					}
 
@@ -111,3 +108,264 @@ func getFileModTime(filename string) (time.Time, error) {
 	}
 	return info.ModTime(), nil
 }
+
+// Ett lopp räknas som pågående när det har startat och övervakas
+func isRaceRunning(race Race, now time.Time) bool {
+	return race.LiveUpdate && race.ResultsFile != "" && now.After(race.StartTime)
+}
+
+// Hur länge läsaren har varit tyst, räknat tidigast från när de första löparna kan gå i mål
+func readerSilence(race Race, health ReaderHealth, now time.Time) time.Duration {
+	lastActivity := health.LastChange
+	if firstExpected := race.StartTime.Add(race.MinTime); firstExpected.After(lastActivity) {
+		lastActivity = firstExpected
+	}
+	if now.Before(lastActivity) {
+		return 0
+	}
+	return now.Sub(lastActivity)
+}
+
+// Gränsen för när en tyst läsare ska larma
+func silenceAlarmLimit(race Race) time.Duration {
+	if race.SilenceAlarm > 0 {
+		return race.SilenceAlarm
+	}
+	return defaultSilenceAlarm
+}
+
+// Läsarstatus som räknas fram stegvis, varje uppdatering läser bara rader som
+// tillkommit i läsarfilen sedan förra gången
+type readerHealthTracker struct {
+	file      string
+	startTime time.Time
+	offset    int64
+	parser    *readerRecordParser
+	lastRead  time.Time
+	recent    []time.Time
+	seenChips map[string]bool
+}
+
+func newReaderHealthTracker(race Race) *readerHealthTracker {
+	return &readerHealthTracker{
+		file:      race.ResultsFile,
+		startTime: race.StartTime,
+		parser:    newReaderRecordParser(race.ResultsFile, race.StartTime),
+		seenChips: make(map[string]bool),
+	}
+}
+
+// Läs nya rader i läsarfilen och räkna fram läsarens status
+func (t *readerHealthTracker) update(race Race, now time.Time) (ReaderHealth, error) {
+	health := ReaderHealth{
+		RaceName:        race.Name,
+		File:            race.ResultsFile,
+		ChipsRegistered: len(race.Chips),
+	}
+
+	info, err := os.Stat(t.file)
+	if err != nil {
+		return health, fmt.Errorf("kunde inte läsa filtid: %v", err)
+	}
+	health.LastChange = info.ModTime()
+
+	// Filen har tömts eller ersatts, börja om från början
+	if info.Size() < t.offset {
+		*t = *newReaderHealthTracker(race)
+	}
+
+	lines, offset, err := readNewLines(t.file, t.offset, info.Size())
+	if err != nil {
+		return health, err
+	}
+	t.offset = offset
+	for _, line := range lines {
+		chip, recordTime, err := t.parser.parse(strings.Split(line, "\t"))
+		if err != nil {
+			continue
+		}
+		if recordTime.After(t.lastRead) {
+			t.lastRead = recordTime
+		}
+		t.recent = append(t.recent, recordTime)
+		if recordTime.After(t.startTime) {
+			t.seenChips[chip] = true
+		}
+	}
+
+	// Läsningar äldre än en minut behövs inte längre
+	var recent []time.Time
+	for _, recordTime := range t.recent {
+		if now.Sub(recordTime) > time.Minute {
+			continue
+		}
+		recent = append(recent, recordTime)
+		if !recordTime.After(now) {
+			health.ReadsLastMinute++
+		}
+	}
+	t.recent = recent
+
+	health.LastRead = t.lastRead
+	for chip := range t.seenChips {
+		if race.Chips[chip] {
+			health.ChipsSeen++
+		}
+	}
+	return health, nil
+}
+
+// Starta en bakgrundsrutin som regelbundet räknar om läsarstatus för pågående lopp.
+// getRaces ska returnera en egen kopia av loppen, den anropas från bakgrundsrutinen.
+func startReaderMonitor(getRaces func() []Race, state *WatchState, onUpdate func()) func() {
+	quit := make(chan bool)
+	done := make(chan bool)
+
+	go func() {
+		ticker := time.NewTicker(readerMonitorInterval)
+		defer ticker.Stop()
+
+		trackers := make(map[string]*readerHealthTracker)
+		for {
+			select {
+			case <-quit:
+				done <- true
+				return
+			case <-ticker.C:
+				now := time.Now()
+				changed := false
+				for _, race := range getRaces() {
+					if !isRaceRunning(race, now) {
+						delete(trackers, race.ID)
+						if _, exists := state.GetReaderHealth(race.ID); exists {
+							state.RemoveReaderHealth(race.ID)
+							changed = true
+						}
+						continue
+					}
+
+					// Ny fil eller ny starttid ger en ny räkning från början
+					tracker := trackers[race.ID]
+					if tracker == nil || tracker.file != race.ResultsFile || !tracker.startTime.Equal(race.StartTime) {
+						tracker = newReaderHealthTracker(race)
+						trackers[race.ID] = tracker
+					}
+					health, err := tracker.update(race, now)
+					if err != nil {
+						getLogger().Log("Kunde inte räkna fram läsarstatus för %s: %v", race.Name, err)
+					}
+					state.SetReaderHealth(race.ID, health)
+					changed = true
+				}
+				if changed {
+					onUpdate()
+				}
+			}
+		}
+	}()
+
+	return func() {
+		quit <- true
+		<-done
+	}
+}
+
+// Följ en läsarfil och anropa onRead för varje ny rad som skrivs efter att bevakningen startat
+func tailReaderFile(filename string, onRead func(chip string, readTime time.Time)) (func(), error) {
+	if filename == "" {
+		return nil, fmt.Errorf("ingen fil att övervaka")
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, fmt.Errorf("kunde inte läsa fil: %v", err)
+	}
+	offset := info.Size()
+	parser := newReaderRecordParser("", time.Now())
+
+	getLogger().Log("Startar avläsning av nya rader i fil: %s", filename)
+
+	quit := make(chan bool)
+	done := make(chan bool)
+
+	go func() {
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-quit:
+				getLogger().Log("Stoppar avläsning av fil: %s", filename)
+				done <- true
+				return
+			case <-ticker.C:
+				info, err := os.Stat(filename)
+				if err != nil {
+					getLogger().Log("Fel vid kontroll av fil %s: %v", filename, err)
+					continue
+				}
+
+				// Filen har tömts eller ersatts, börja om från början
+				if info.Size() < offset {
+					offset = 0
+				}
+
+				lines, newOffset, err := readNewLines(filename, offset, info.Size())
+				if err != nil {
+					getLogger().Log("Fel vid läsning av fil %s: %v", filename, err)
+					continue
+				}
+				offset = newOffset
+
+				for _, line := range lines {
+					chip, readTime, err := parser.parse(strings.Split(line, "\t"))
+					if err != nil {
+						getLogger().Log("Hoppar över rad i %s: %v", filename, err)
+						continue
+					}
+					onRead(chip, readTime)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		quit <- true
+		<-done
+	}, nil
+}
+
+// Läs hela rader som skrivits i filen efter offset. Returnerar raderna och var nästa
+// läsning ska börja, en ofullständig sista rad läses nästa gång.
+func readNewLines(filename string, offset, size int64) ([]string, int64, error) {
+	if size <= offset {
+		return nil, offset, nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, offset, err
+	}
+	defer file.Close()
+
+	data := make([]byte, size-offset)
+	n, err := file.ReadAt(data, offset)
+	if err != nil && err != io.EOF {
+		return nil, offset, err
+	}
+	data = data[:n]
+
+	end := strings.LastIndexByte(string(data), '\n')
+	if end < 0 {
+		return nil, offset, nil
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(data[:end]), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, offset + int64(end+1), nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReaderHealthTrackerReadsOnlyNewLines(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "lasare.txt")
+	race := testRace("")
+	race.ResultsFile = filename
+	race.Chips["3"] = true
+	start := race.StartTime
+
+	write := func(data string, flag int) {
+		t.Helper()
+		file, err := os.OpenFile(filename, flag|os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := file.WriteString(data); err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+	}
+
+	tracker := newReaderHealthTracker(race)
+	now := start.Add(40 * time.Minute)
+
+	// Före starten räknas inte, den ofullständiga sista raden väntar till nästa gång
+	write("1\t2026-05-17 09:55:00.000\n1\t2026-05-17 10:39:30.000\n2\t2026-05-17 10:3", os.O_TRUNC)
+	health, err := tracker.update(race, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.ChipsSeen != 1 || health.ReadsLastMinute != 1 {
+		t.Errorf("efter första läsningen: sett %d, senaste minuten %d, väntade 1 och 1", health.ChipsSeen, health.ReadsLastMinute)
+	}
+
+	write("9:45.000\n", os.O_APPEND)
+	health, err = tracker.update(race, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.ChipsSeen != 2 || health.ReadsLastMinute != 2 {
+		t.Errorf("efter ny rad: sett %d, senaste minuten %d, väntade 2 och 2", health.ChipsSeen, health.ReadsLastMinute)
+	}
+	if want := start.Add(39*time.Minute + 45*time.Second); !health.LastRead.Equal(want) {
+		t.Errorf("senaste läsning %v, väntade %v", health.LastRead, want)
+	}
+
+	// En minut senare räknas läsningarna inte längre som nya
+	health, err = tracker.update(race, now.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.ReadsLastMinute != 0 {
+		t.Errorf("senaste minuten %d, väntade 0", health.ReadsLastMinute)
+	}
+
+	// En fil som ersatts läses från början
+	write("3\t2026-05-17 10:41:00.000\n", os.O_TRUNC)
+	health, err = tracker.update(race, now.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.ChipsSeen != 1 {
+		t.Errorf("efter ny fil: sett %d, väntade 1", health.ChipsSeen)
+	}
+}
+
+func TestStopWatcherWhileUpdatingReaderHealth(t *testing.T) {
+	state := NewWatchState()
+	stopped := make(chan bool)
+
+	// Övervakningen väntar på en uppdatering av läsarstatus innan den stoppas
+	stop := func() {
+		done := make(chan bool)
+		go func() {
+			state.SetReaderHealth("lopp1", ReaderHealth{})
+			close(done)
+		}()
+		<-done
+	}
+	state.AddStopWatcher("lopp1", stop)
+	state.AddStopWatcher("lopp2", stop)
+
+	go func() {
+		state.RemoveStopWatcher("lopp1")
+		state.StopAll()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("övervakningen stoppades aldrig")
+	}
+	if state.HasStopWatcher("lopp2") {
+		t.Errorf("övervakningen finns kvar efter StopAll")
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Adressen som resultatsidorna lyssnar på när de startas från gränssnittet. Porten skiljer
+// sig från serve så att gränssnittet och en server kan köras samtidigt.
+const defaultLiveResultsAddr = ":8081"
+
+// Fil med adressen som resultatsidorna senast startades på
+func liveResultsAddrFilename() string {
+	return dataPath("live_results_addr.txt")
+}
+
+// Läs evenemangets adress för resultatsidorna, standardadressen om ingen sparats
+func loadLiveResultsAddr() string {
+	data, err := os.ReadFile(liveResultsAddrFilename())
+	if err != nil {
+		return defaultLiveResultsAddr
+	}
+	if addr := strings.TrimSpace(string(data)); addr != "" {
+		return addr
+	}
+	return defaultLiveResultsAddr
+}
+
+// Spara adressen för resultatsidorna till nästa gång
+func saveLiveResultsAddr(addr string) error {
+	return writeFileAtomic(liveResultsAddrFilename(), []byte(addr+"\n"))
+}
+
+// Kontrollera en adress att lyssna på, t.ex. ":8081" eller "127.0.0.1:8081"
+func validateListenAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("Ogiltig adress %q, använd t.ex. :8081 eller 127.0.0.1:8081", addr)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("Ogiltig port %q", port)
+	}
+	return nil
+}
+
+// Adresser som resultatsidorna nås på. Lyssnar servern på alla nätverk visas datorns
+// adresser i det lokala nätverket.
+func liveResultsBaseURLs(addr string) []string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil
+	}
+
+	var hosts []string
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		hosts = localAddresses()
+		if len(hosts) == 0 {
+			hosts = append(hosts, "localhost")
+		}
+	} else {
+		hosts = []string{host}
+	}
+
+	var urls []string
+	for _, h := range hosts {
+		urls = append(urls, fmt.Sprintf("http://%s", net.JoinHostPort(h, port)))
+	}
+	return urls
+}
+
+// Hur ofta resultatsidan hämtar resultaten även utan händelser, i millisekunder
+const resultsPageRefresh = 30000
+
+// Gemensam stil för resultatsidorna, anpassad för mobilen
+const webPageStyle = `
+body { font-family: -apple-system, "Segoe UI", Roboto, sans-serif; margin: 0; background: #f4f4f4; color: #222; }
+header { background: #1f4e79; color: #fff; padding: 12px 16px; }
+header h1 { font-size: 1.3em; margin: 0; }
+header p { margin: 4px 0 0; font-size: 0.85em; opacity: 0.85; }
+main { padding: 12px; max-width: 800px; margin: 0 auto; }
+a { color: #1f4e79; }
+ul.races { list-style: none; padding: 0; }
+ul.races li { background: #fff; margin-bottom: 8px; border-radius: 6px; }
+ul.races a { display: block; padding: 14px 16px; text-decoration: none; font-size: 1.1em; }
+ul.races span { display: block; font-size: 0.8em; color: #666; }
+input[type=search] { width: 100%; box-sizing: border-box; font-size: 1.1em; padding: 10px; border: 1px solid #ccc; border-radius: 6px; }
+nav { display: flex; flex-wrap: wrap; gap: 6px; margin: 10px 0; }
+nav button { font-size: 1em; padding: 8px 12px; border: 1px solid #1f4e79; background: #fff; color: #1f4e79; border-radius: 16px; }
+nav button.active { background: #1f4e79; color: #fff; }
+table { width: 100%; border-collapse: collapse; background: #fff; }
+th, td { padding: 8px 6px; text-align: left; border-bottom: 1px solid #e4e4e4; }
+th { font-size: 0.8em; color: #666; text-transform: uppercase; }
+td.num, th.num { text-align: right; white-space: nowrap; }
+tr.new td { background: #fff6c7; }
+.empty { text-align: center; color: #666; padding: 24px; }
+`
+
+var indexPageTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="sv">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="30">
+<title>Resultat - {{.Event}}</title>
+<style>{{.Style}}</style>
+</head>
+<body>
+<header><h1>{{.Event}}</h1><p>Välj lopp för att se resultaten</p></header>
+<main>
+{{if .Races}}
+<ul class="races">
+{{range .Races}}<li><a href="/lopp/{{.ID}}">{{.Name}}<span>{{.Status}} · {{.Finished}} av {{.Registered}} i mål</span></a></li>
+{{end}}
+</ul>
+{{else}}
+<p class="empty">Inga lopp ännu</p>
+{{end}}
+</main>
+</body>
+</html>
+`))
+
+var resultsPageTemplate = template.Must(template.New("results").Parse(`<!DOCTYPE html>
+<html lang="sv">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}} - {{.Event}}</title>
+<style>{{.Style}}</style>
+</head>
+<body>
+<header><h1>{{.Name}}</h1><p id="status">{{.Status}}</p></header>
+<main>
+<p><a href="/">&larr; Alla lopp</a></p>
+<input type="search" id="search" placeholder="Sök startnummer eller namn">
+<nav id="classes"></nav>
+<table>
+<thead><tr><th class="num">Plac</th><th class="num">Nr</th><th>Namn</th><th id="classHeader">Klass</th><th class="num">Tid</th></tr></thead>
+<tbody id="results"></tbody>
+</table>
+<p class="empty" id="empty" hidden>Inga resultat ännu</p>
+</main>
+<script>
+const raceID = {{.ID}};
+const refresh = {{.Refresh}};
+let rows = [];
+let seen = null;
+let selectedClass = "";
+
+function text(value) {
+	const cell = document.createElement("td");
+	cell.textContent = value;
+	return cell;
+}
+
+function render() {
+	const search = document.getElementById("search").value.trim().toLowerCase();
+	const classes = [...new Set(rows.map(r => r.class).filter(c => c))].sort();
+	if (selectedClass && !classes.includes(selectedClass)) {
+		selectedClass = "";
+	}
+
+	const nav = document.getElementById("classes");
+	nav.replaceChildren();
+	if (classes.length > 0) {
+		for (const name of ["", ...classes]) {
+			const button = document.createElement("button");
+			button.textContent = name || "Totalt";
+			button.className = name === selectedClass ? "active" : "";
+			button.onclick = () => { selectedClass = name; render(); };
+			nav.appendChild(button);
+		}
+	}
+	document.getElementById("classHeader").hidden = classes.length === 0;
+
+	const body = document.getElementById("results");
+	body.replaceChildren();
+	let shown = 0;
+	for (const row of rows) {
+		if (selectedClass && row.class !== selectedClass) {
+			continue;
+		}
+		if (search && !row.chip.toLowerCase().includes(search) && !row.name.toLowerCase().includes(search)) {
+			continue;
+		}
+		const tr = document.createElement("tr");
+		if (seen && !seen.has(row.chip)) {
+			tr.className = "new";
+		}
+		const place = text(selectedClass ? row.classPlace : row.place);
+		place.className = "num";
+		tr.appendChild(place);
+		const chip = text(row.chip);
+		chip.className = "num";
+		tr.appendChild(chip);
+		tr.appendChild(text(row.name));
+		const cls = text(row.class || "");
+		cls.hidden = classes.length === 0;
+		tr.appendChild(cls);
+		const time = text(row.time);
+		time.className = "num";
+		tr.appendChild(time);
+		body.appendChild(tr);
+		shown++;
+	}
+	document.getElementById("empty").hidden = shown > 0;
+}
+
+async function load() {
+	try {
+		const [raceResponse, resultsResponse] = await Promise.all([
+			fetch("/api/v1/races/" + encodeURIComponent(raceID)),
+			fetch("/api/v1/races/" + encodeURIComponent(raceID) + "/results"),
+		]);
+		if (!raceResponse.ok || !resultsResponse.ok) {
+			throw new Error("HTTP " + raceResponse.status + "/" + resultsResponse.status);
+		}
+		const race = await raceResponse.json();
+		const previous = rows;
+		rows = await resultsResponse.json();
+		if (previous.length > 0 || seen) {
+			seen = new Set(previous.map(r => r.chip));
+		} else {
+			seen = new Set(rows.map(r => r.chip));
+		}
+		const updated = race.resultsUpdatedAt ? new Date(race.resultsUpdatedAt).toLocaleTimeString("sv-SE") : "-";
+		document.getElementById("status").textContent =
+			race.finished + " av " + race.registered + " i mål · uppdaterad " + updated;
+		render();
+	} catch (err) {
+		document.getElementById("status").textContent = "Ingen kontakt med tidtagningen, försöker igen...";
+	}
+}
+
+document.getElementById("search").addEventListener("input", render);
+load();
+
+// Hämta resultaten på nytt när tidtagningen meddelar en ändring
+let pending = null;
+const events = new EventSource("/api/v1/races/" + encodeURIComponent(raceID) + "/events");
+events.onmessage = () => {
+	if (!pending) {
+		pending = setTimeout(() => { pending = null; load(); }, 300);
+	}
+};
+setInterval(load, refresh);
+</script>
+</body>
+</html>
+`))
+
+// Startsidan med länkar till resultaten för varje lopp
+func (s *timingServer) handleIndexPage(w http.ResponseWriter, r *http.Request) {
+	type raceLink struct {
+		ID         string
+		Name       string
+		Status     string
+		Finished   int
+		Registered int
+	}
+
+	var links []raceLink
+	for _, race := range s.getRaces() {
+		if raceStatus(race) == RaceStatusArchived {
+			continue
+		}
+		summary := s.summarize(race)
+		links = append(links, raceLink{
+			ID:         race.ID,
+			Name:       race.Name,
+			Status:     raceStatusLabel(summary.Status),
+			Finished:   summary.Finished,
+			Registered: summary.Registered,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexPageTemplate.Execute(w, map[string]interface{}{
+		"Event": workspaceName(),
+		"Style": template.CSS(webPageStyle),
+		"Races": links,
+	}); err != nil {
+		getLogger().Log("Kunde inte visa startsidan: %v", err)
+	}
+}
+
+// Resultatsidan för ett lopp, sidan hämtar resultaten själv och uppdaterar dem vid varje händelse
+func (s *timingServer) handleResultsPage(w http.ResponseWriter, r *http.Request) {
+	race, exists := s.getRace(r.PathValue("id"))
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := resultsPageTemplate.Execute(w, map[string]interface{}{
+		"Event":   workspaceName(),
+		"Style":   template.CSS(webPageStyle),
+		"ID":      race.ID,
+		"Name":    race.Name,
+		"Status":  raceStatusLabel(raceStatus(race)),
+		"Refresh": resultsPageRefresh,
+	}); err != nil {
+		getLogger().Log("Kunde inte visa resultatsidan för %s: %v", race.Name, err)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Antal evenemang som visas i listan över senast öppnade
+const keepRecentWorkspaces = 10
+
+// Mappen för det öppna evenemanget, alla datafiler läses och skrivs här
+var workspaceDir = "."
+
+type RecentWorkspace struct {
+	Path       string    `json:"path"`
+	Name       string    `json:"name"`
+	LastOpened time.Time `json:"lastOpened"`
+}
+
+// Sökväg till en fil i det öppna evenemanget
+func dataPath(name string) string {
+	return filepath.Join(workspaceDir, name)
+}
+
+// Namnet på det öppna evenemanget
+func workspaceName() string {
+	return filepath.Base(workspaceDir)
+}
+
+// Programmets egen konfigurationsmapp
+func appConfigDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(configDir, "hogby-tidtagning")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// Standardmappen där nya evenemang skapas
+func defaultWorkspaceRoot() (string, error) {
+	configDir, err := appConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "events"), nil
+}
+
+// Öppna ett evenemang och lägg det först i listan över senast öppnade
+func openWorkspace(dir string) error {
+	if err := useWorkspace(dir); err != nil {
+		return err
+	}
+
+	if err := rememberWorkspace(workspaceDir); err != nil {
+		getLogger().Log("Kunde inte spara senaste evenemang: %v", err)
+	}
+	return nil
+}
+
+// Mappen innehåller ett evenemang om den har en races.json
+func workspaceExists(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "races.json"))
+	return err == nil
+}
+
+// Använd ett evenemang, alla filer läses och skrivs i dess mapp från och med nu
+func useWorkspace(dir string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(absDir, 0755); err != nil {
+		return fmt.Errorf("kunde inte skapa evenemangsmapp: %v", err)
+	}
+
+	workspaceDir = absDir
+
+	if err := getLogger().SetFile(dataPath("tidtagning.log")); err != nil {
+		return err
+	}
+	getLogger().Log("Öppnade evenemang: %s", workspaceDir)
+
+	if err := initializeEmptyDataIfNeeded(); err != nil {
+		return fmt.Errorf("fel vid initiering av data: %v", err)
+	}
+	return nil
+}
+
+// Filen där senast öppnade evenemang sparas
+func recentWorkspacesFilename() (string, error) {
+	configDir, err := appConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "recent_events.json"), nil
+}
+
+// Läs listan över senast öppnade evenemang, nyaste först
+func loadRecentWorkspaces() ([]RecentWorkspace, error) {
+	filename, err := recentWorkspacesFilename()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []RecentWorkspace{}, nil
+		}
+		return nil, err
+	}
+
+	var recent []RecentWorkspace
+	if err := json.Unmarshal(data, &recent); err != nil {
+		return nil, err
+	}
+	return recent, nil
+}
+
+// Lägg evenemanget först i listan över senast öppnade
+func rememberWorkspace(dir string) error {
+	recent, err := loadRecentWorkspaces()
+	if err != nil {
+		recent = []RecentWorkspace{}
+	}
+
+	updated := []RecentWorkspace{{
+		Path:       dir,
+		Name:       filepath.Base(dir),
+		LastOpened: time.Now(),
+	}}
+	for _, workspace := range recent {
+		if workspace.Path != dir && len(updated) < keepRecentWorkspaces {
+			updated = append(updated, workspace)
+		}
+	}
+
+	filename, err := recentWorkspacesFilename()
+	if err != nil {
+		return err
+	}
+	return writeJSONAtomic(filename, updated)
+}
+
+// Filer som programmet sparade i arbetsmappen innan det fanns evenemang
+var legacyDataPatterns = []string{"races.json", "manual_times_*.json", "journal_*.jsonl", "finish_stamps_*.json"}
+
+// Hitta data från innan evenemang fanns, när allt sparades i mappen programmet startades i.
+// En mapp som redan är ett öppnat evenemang räknas inte.
+func findLegacyData(dir string) ([]string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if recent, err := loadRecentWorkspaces(); err == nil {
+		for _, workspace := range recent {
+			if workspace.Path == absDir {
+				return nil, nil
+			}
+		}
+	}
+	if !workspaceExists(absDir) {
+		return nil, nil
+	}
+
+	var files []string
+	for _, pattern := range legacyDataPatterns {
+		matches, err := filepath.Glob(filepath.Join(absDir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			files = append(files, filepath.Base(match))
+		}
+	}
+	return files, nil
+}
+
+// Kopiera data från en gammal arbetsmapp till ett nytt evenemang och öppna det. Originalen
+// lämnas kvar. Läsarfiler med relativ sökväg pekas om till sin plats i den gamla mappen,
+// eftersom läsaren fortsätter att skriva där.
+func importLegacyData(src, dest string) error {
+	absSrc, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+	files, err := findLegacyData(absSrc)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("hittade inga tidigare lopp i %s", absSrc)
+	}
+	if workspaceExists(dest) {
+		return fmt.Errorf("evenemanget %s finns redan", filepath.Base(dest))
+	}
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return fmt.Errorf("kunde inte skapa evenemangsmapp: %v", err)
+	}
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join(absSrc, name))
+		if err != nil {
+			return fmt.Errorf("kunde inte läsa %s: %v", name, err)
+		}
+		if err := writeFileAtomic(filepath.Join(dest, name), data); err != nil {
+			return fmt.Errorf("kunde inte kopiera %s: %v", name, err)
+		}
+	}
+
+	// Loppen läses in i det nya evenemanget, äldre format migreras då som vanligt
+	if err := openWorkspace(dest); err != nil {
+		return err
+	}
+	races, err := loadRaces()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for i := range races {
+		if races[i].ResultsFile != "" && !filepath.IsAbs(races[i].ResultsFile) {
+			races[i].ResultsFile = filepath.Join(absSrc, races[i].ResultsFile)
+			changed = true
+		}
+	}
+	if changed {
+		if err := saveRaces(races); err != nil {
+			return err
+		}
+	}
+
+	getLogger().Log("Importerade %d filer med tidigare lopp från %s", len(files), absSrc)
+	return nil
+}
@@ -0,0 +1,184 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Visa val av evenemang i huvudfönstret, onOpen anropas när ett evenemang har öppnats
+func showWorkspaceChooser(window fyne.Window, onOpen func()) {
+	open := func(dir string) {
+		if err := openWorkspace(dir); err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		onOpen()
+	}
+
+	content := container.NewVBox(widget.NewLabel("Välj evenemang:"))
+
+	recent, err := loadRecentWorkspaces()
+	if err != nil {
+		getLogger().Log("Kunde inte läsa senaste evenemang: %v", err)
+	}
+	for _, workspace := range recent {
+		workspace := workspace
+		if _, err := os.Stat(workspace.Path); err != nil {
+			continue
+		}
+		content.Add(widget.NewButton(fmt.Sprintf("%s (senast öppnat %s)",
+			workspace.Name, workspace.LastOpened.Format("2006-01-02 15:04")), func() {
+			open(workspace.Path)
+		}))
+	}
+	content.Add(widget.NewSeparator())
+
+	newButton := widget.NewButton("Nytt evenemang", func() {
+		nameEntry := widget.NewEntry()
+		nameEntry.SetPlaceHolder("Evenemangets namn (t.ex. 'Höstloppet 2026')")
+
+		dialog.ShowForm("Nytt evenemang", "Skapa", "Avbryt", []*widget.FormItem{
+			{Text: "Namn", Widget: nameEntry},
+		}, func(submitted bool) {
+			if !submitted {
+				return
+			}
+
+			name := strings.TrimSpace(nameEntry.Text)
+			if name == "" || strings.ContainsAny(name, `/\:`) {
+				dialog.ShowError(fmt.Errorf("Ogiltigt namn på evenemang"), window)
+				return
+			}
+
+			root, err := defaultWorkspaceRoot()
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+			dir := filepath.Join(root, name)
+			if _, err := os.Stat(dir); err == nil {
+				dialog.ShowError(fmt.Errorf("Evenemanget %s finns redan", name), window)
+				return
+			}
+			open(dir)
+		}, window)
+	})
+	newButton.Importance = widget.HighImportance
+
+	folderButton := widget.NewButton("Öppna mapp...", func() {
+		d := dialog.NewFolderOpen(func(uri fyne.ListableURI, err error) {
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+			if uri == nil {
+				return
+			}
+			open(uri.Path())
+		}, window)
+		d.Resize(fyne.NewSize(1200, 800))
+		d.Show()
+	})
+
+	importButton := widget.NewButton("Importera evenemang...", func() {
+		d := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+			if reader == nil {
+				return
+			}
+
+			archiveFile := reader.URI().Path()
+			reader.Close()
+
+			eventName, err := archiveEventName(archiveFile)
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+			dest, err := importDestination(eventName)
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+			if _, err := importEventArchive(archiveFile, dest); err != nil {
+				dialog.ShowError(fmt.Errorf("kunde inte importera evenemang: %v", err), window)
+				return
+			}
+			open(dest)
+		}, window)
+		d.SetFilter(storage.NewExtensionFileFilter([]string{".zip"}))
+		d.Resize(fyne.NewSize(1200, 800))
+		d.Show()
+	})
+
+	content.Add(container.NewHBox(newButton, folderButton, importButton))
+
+	window.SetTitle("Tidtagning")
+	window.SetContent(container.NewPadded(content))
+
+	if !legacyImportOffered {
+		legacyImportOffered = true
+		offerLegacyImport(window, onOpen)
+	}
+}
+
+// Importen av tidigare lopp erbjuds bara första gången valet av evenemang visas
+var legacyImportOffered bool
+
+// Erbjud att flytta in lopp som sparats i mappen programmet startades i, från innan evenemang fanns
+func offerLegacyImport(window fyne.Window, onOpen func()) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	files, err := findLegacyData(cwd)
+	if err != nil {
+		getLogger().Log("Kunde inte leta efter tidigare lopp i %s: %v", cwd, err)
+		return
+	}
+	if len(files) == 0 {
+		return
+	}
+
+	nameEntry := widget.NewEntry()
+	nameEntry.SetText("Tidigare lopp")
+
+	dialog.ShowForm("Tidigare lopp hittades", "Importera", "Hoppa över", []*widget.FormItem{
+		{Text: "", Widget: widget.NewLabel(fmt.Sprintf("Mappen %s innehåller lopp från en tidigare version (%s).\nVill du kopiera dem till ett nytt evenemang?",
+			cwd, strings.Join(files, ", ")))},
+		{Text: "Namn", Widget: nameEntry},
+	}, func(submitted bool) {
+		if !submitted {
+			return
+		}
+
+		name := strings.TrimSpace(nameEntry.Text)
+		if name == "" || strings.ContainsAny(name, `/\:`) {
+			dialog.ShowError(fmt.Errorf("Ogiltigt namn på evenemang"), window)
+			return
+		}
+		root, err := defaultWorkspaceRoot()
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		if err := importLegacyData(cwd, filepath.Join(root, name)); err != nil {
+			dialog.ShowError(fmt.Errorf("kunde inte importera tidigare lopp: %v", err), window)
+			return
+		}
+		onOpen()
+	}, window)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportLegacyData(t *testing.T) {
+	useTestWorkspace(t)
+	legacy := t.TempDir()
+
+	races := `[{"name":"Milen","startTime":"2020-05-17T10:00:00Z","minTime":"0s","resultsFile":"lasare.txt"}]`
+	manual := `[{"id":"m1","chip":"1","time":"2020-05-17T10:40:00Z","raceName":"Milen"}]`
+	for name, data := range map[string]string{
+		"races.json":              races,
+		"manual_times_Milen.json": manual,
+		"lasare.txt":              "1\t2020-05-17 10:40:00.000\n",
+	} {
+		if err := os.WriteFile(filepath.Join(legacy, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := findLegacyData(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("väntade races.json och manuella tider, hittade %v", files)
+	}
+
+	dest := filepath.Join(t.TempDir(), "Tidigare lopp")
+	if err := importLegacyData(legacy, dest); err != nil {
+		t.Fatal(err)
+	}
+	if workspaceDir != dest {
+		t.Errorf("det nya evenemanget öppnades inte, öppet är %s", workspaceDir)
+	}
+
+	loaded, err := loadRaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 1 {
+		t.Fatalf("väntade 1 lopp, fick %d", len(loaded))
+	}
+	if want := filepath.Join(legacy, "lasare.txt"); loaded[0].ResultsFile != want {
+		t.Errorf("läsarfil %s, väntade %s", loaded[0].ResultsFile, want)
+	}
+	manualTimes, err := loadManualTimes(loaded[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manualTimes) != 1 {
+		t.Errorf("manuella tider följde inte med: %+v", manualTimes)
+	}
+
+	// Originalen lämnas kvar
+	if _, err := os.Stat(filepath.Join(legacy, "races.json")); err != nil {
+		t.Errorf("originalet försvann: %v", err)
+	}
+
+	// Ett evenemang som redan finns skrivs inte över
+	if err := importLegacyData(legacy, dest); err == nil {
+		t.Errorf("väntade fel när evenemanget redan finns")
+	}
+}